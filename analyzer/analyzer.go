@@ -3,8 +3,15 @@ package analyzer
 import (
 	"encoding/hex"
 	"fmt"
+	"gaslens/disasm"
+	"gaslens/eof"
+	"gaslens/layout"
+	"gaslens/metadata"
+	"gaslens/signatures"
+	"gaslens/srcmap"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"sort"
+	"strings"
 )
 
 type opGasPair struct {
@@ -12,155 +19,344 @@ type opGasPair struct {
 	Gas uint64
 }
 
-// AnalyzeBytecode prints opcode gas and charts
-func AnalyzeBytecode(code []byte, detailed bool) {
-	pc := 0
-	var totalGas uint64
+// Options controls how AnalyzeBytecode prices and reports a contract.
+type Options struct {
+	Detailed   bool
+	Schedule   *GasSchedule
+	Signatures *signatures.DB
+	Layout     *layout.Layout
+	SourceMap  *srcmap.Map
+	Contract   string // name the report carries, when known
+	ReportName string // base name of the exported reports, "analysis_report" when empty
+}
 
-	loopTracker := NewLoopTracker()
-	functionTracker := NewFunctionTracker()
-	opcodeCount := map[vm.OpCode]int{}
-	opcodeGas := map[vm.OpCode]uint64{}
-	engine := &StackEngine{}
-	storage := NewStorageTracker()
+// analysis holds everything gathered about one contract, either statically
+// or from an execution, before it is printed and exported.
+type analysis struct {
+	report          *AnalysisReport
+	trace           []traceEntry
+	opcodeCount     map[vm.OpCode]int
+	opcodeGas       map[vm.OpCode]uint64
+	storage         *StorageTracker
+	loopTracker     *LoopTracker
+	functionTracker *FunctionTracker
+	cfg             *CFG
+	maxSSTORERun    int
+	positions       map[int]srcmap.Position // source position by pc
+	optimizations   []Suggestion            // the report's suggestions, in order
+}
 
-	var consecutiveSSTORE int
-	var maxConsecutiveSSTORE int
+// traceEntry is one line of the per-instruction trace.
+type traceEntry struct {
+	ins     disasm.Instruction
+	static  uint64
+	dynamic DynamicCost
+	defined bool
+	dead    bool // unreachable, and left out of the totals
+}
 
-	for pc < len(code) {
-		currentPC := pc
-		op := vm.OpCode(code[pc])
-		if op == vm.PUSH4 && pc+5 <= len(code) {
-			selectorBytes := code[pc+1 : pc+5]
-			selector := fmt.Sprintf("0x%x", selectorBytes)
-			functionTracker.AddFunction(selector, pc)
-		}
-		switch {
-		case op >= vm.PUSH1 && op <= vm.PUSH32:
-			size := int(op - vm.PUSH1 + 1)
-			if pc+1+size <= len(code) {
-				valueBytes := code[pc+1 : pc+1+size]
-				var v uint64
-				for _, b := range valueBytes {
-					v = (v << 8) | uint64(b)
-				}
-				engine.Push(v)
-			}
+// AnalyzeBytecode prints opcode gas and charts. It fails only for EOF
+// containers that do not validate.
+func AnalyzeBytecode(code []byte, opts Options) error {
+	a, err := analyze(code, opts.Schedule)
+	if err != nil {
+		return err
+	}
+	a.name(opts.Signatures)
+	a.applyLayout(opts.Layout)
+	a.applySourceMap(opts.SourceMap)
+	a.report.Contract = opts.Contract
+	a.print(opts)
+	a.export(opts.ReportName)
+	return nil
+}
 
-		case op == vm.POP:
-			engine.Pop()
-
-		case op >= vm.DUP1 && op <= vm.DUP16:
-			n := int(op - vm.DUP1 + 1)
-			engine.Dup(n)
-
-		case op >= vm.SWAP1 && op <= vm.SWAP16:
-			n := int(op - vm.SWAP1 + 1)
-			engine.Swap(n)
-
-		case op == vm.SLOAD:
-			slot := engine.Pop()
-			storage.SLoadCount[slot]++
-			engine.Push(0)
-
-		case op == vm.SSTORE:
-			slot := engine.Pop()
-			_ = engine.Pop()
-			storage.SStoreCount[slot]++
-		}
-		opcodeCount[op]++
-		gas := GetGasCost(op)
-		totalGas += gas
-		opcodeGas[op] += gas
-		functionTracker.AddGas(currentPC, gas)
-		if op == vm.SSTORE {
-			consecutiveSSTORE++
-			if consecutiveSSTORE > maxConsecutiveSSTORE {
-				maxConsecutiveSSTORE = consecutiveSSTORE
-			}
+// analyze prices every instruction in code under schedule. Creation code
+// is split: the report covers its runtime code, plus the deployment cost.
+// EOF containers are validated and priced per code section.
+func analyze(code []byte, schedule *GasSchedule) (*analysis, error) {
+	if eof.IsEOF(code) {
+		return analyzeEOF(code, schedule)
+	}
+	creation, ok := SplitCreationCode(code)
+	if !ok {
+		return analyzeCode(code, schedule), nil
+	}
+	a := analyzeCode(creation.Runtime, schedule)
+	init := analyzeCode(creation.Init, schedule)
+	a.report.Deployment = deploymentCost(creation, init.report, schedule)
+	a.report.DeadCode.addInitCodeSaving(len(code), schedule)
+	return a, nil
+}
+
+// analyzeCode prices every instruction in runtime or init code.
+func analyzeCode(code []byte, schedule *GasSchedule) *analysis {
+	a := newAnalysis()
+	engine := &StackEngine{}
+	p := newPricer(a, schedule)
+
+	// The metadata trailer is data, never executed.
+	code, md := metadata.Split(code)
+	instrs := disasm.Disassemble(code)
+	a.cfg = BuildCFG(instrs)
+	a.functionTracker.Discover(code, instrs, schedule)
+
+	// Each block starts from the state the CFG enters it with. Unreachable
+	// code is still simulated, so that the stack reads the same as the
+	// bytes that follow, but never priced.
+	entries := a.cfg.EntryStacks()
+	dc, dead := deadCode(a.cfg, code, schedule)
+	for _, ins := range instrs {
+		if entry, ok := entries[ins.PC]; ok {
+			engine = entry.clone()
+		} else if ins.Op == vm.JUMPDEST {
+			engine.Forget()
+		}
+		if dead[ins.PC] {
+			static, _ := schedule.GetGasCost(ins.Op)
+			dc.ExcludedGas += static
+			a.trace = append(a.trace, traceEntry{ins: ins, dead: true})
 		} else {
-			consecutiveSSTORE = 0
-		}
-
-		fmt.Printf("%04d: %-10s Gas: %d\n", pc, op.String(), gas)
-		pc++
-		if op == vm.JUMP || op == vm.JUMPI {
-			if currentPC > 0 {
-				prevOp := vm.OpCode(code[currentPC-1])
-
-				if prevOp >= vm.PUSH1 && prevOp <= vm.PUSH32 {
-					pushSize := int(prevOp - vm.PUSH1 + 1)
-
-					destStart := currentPC - pushSize
-					if destStart >= 0 {
-						destBytes := code[destStart:currentPC]
-						dest := 0
-						for _, b := range destBytes {
-							dest = (dest << 8) | int(b)
-						}
-
-						if dest < currentPC {
-							loopTracker.RecordLoop(dest, currentPC)
-						}
-					}
-				}
-			}
+			p.price(ins, engine)
 		}
-		if op >= vm.PUSH1 && op <= vm.PUSH32 {
-			pushBytes := int(op - vm.PUSH1 + 1)
-			if pc+pushBytes > len(code) {
-				break
-			}
-			value := code[pc : pc+pushBytes]
-			fmt.Printf("      PUSH Data: 0x%s\n", hex.EncodeToString(value))
-			pc += pushBytes
+		engine.Step(ins)
+	}
+
+	a.functionTracker.AttributeGas(a.cfg, p.gasByPC)
+	a.functionTracker.FindSubroutines(a.cfg, p.gasByPC)
+	a.loopTracker.FromCFG(a.cfg, p.gasByPC)
+	a.functionTracker.AttributePaths(a.cfg, p.gasByPC, a.loopTracker.Loops)
+	a.report = p.report()
+	a.report.Metadata = md
+	a.report.DeadCode = dc
+	a.finishReport()
+	return a
+}
+
+func newAnalysis() *analysis {
+	return &analysis{
+		opcodeCount:     map[vm.OpCode]int{},
+		opcodeGas:       map[vm.OpCode]uint64{},
+		storage:         NewStorageTracker(),
+		loopTracker:     NewLoopTracker(),
+		functionTracker: NewFunctionTracker(),
+	}
+}
+
+// pricer accumulates the static estimate one instruction at a time.
+type pricer struct {
+	a                 *analysis
+	schedule          *GasSchedule
+	memory            *MemoryTracker
+	totalGas          uint64
+	dynamicGas        uint64
+	unbounded         []UnboundedOp
+	undefinedOps      map[string]int
+	gasByPC           map[int]uint64
+	consecutiveSSTORE int
+}
+
+func newPricer(a *analysis, schedule *GasSchedule) *pricer {
+	return &pricer{
+		a:            a,
+		schedule:     schedule,
+		memory:       NewMemoryTracker(),
+		undefinedOps: map[string]int{},
+		gasByPC:      map[int]uint64{},
+	}
+}
+
+// price records the gas of ins given the operands on the engine's stack,
+// and returns it. It must be called before ins is applied to the engine.
+func (p *pricer) price(ins disasm.Instruction, engine *StackEngine) uint64 {
+	a, schedule, op := p.a, p.schedule, ins.Op
+	a.storage.Track(ins, engine)
+	static, known := schedule.GetGasCost(op)
+	if !known {
+		p.undefinedOps[op.String()]++
+	}
+	dynamic := p.memory.Charge(op, engine, schedule)
+	dynamic.Gas += a.storage.Charge(op, engine, schedule)
+
+	a.opcodeCount[op]++
+	gas := static + dynamic.Gas
+	p.totalGas += gas
+	p.dynamicGas += dynamic.Gas
+	if !dynamic.Bounded {
+		p.unbounded = append(p.unbounded, UnboundedOp{PC: ins.PC, Opcode: op.String(), LowerBound: gas})
+	}
+	a.opcodeGas[op] += gas
+	p.gasByPC[ins.PC] = gas
+	if op == vm.SSTORE {
+		p.consecutiveSSTORE++
+		if p.consecutiveSSTORE > a.maxSSTORERun {
+			a.maxSSTORERun = p.consecutiveSSTORE
 		}
+	} else {
+		p.consecutiveSSTORE = 0
 	}
+	a.trace = append(a.trace, traceEntry{ins: ins, static: static, dynamic: dynamic, defined: known})
+	return gas
+}
 
-	if maxConsecutiveSSTORE > 1 {
-		fmt.Printf("\nDetected %d consecutive SSTORE instructions. Consider packing variables.\n", maxConsecutiveSSTORE)
+// report returns the analysis report for everything priced so far.
+func (p *pricer) report() *AnalysisReport {
+	a := p.a
+	return &AnalysisReport{
+		Fork:          p.schedule.Fork,
+		TotalGas:      p.totalGas,
+		StorageGas:    a.storage.Gas,
+		AccountAccess: a.storage.Accounts,
+		DynamicGas:    p.dynamicGas,
+		MemoryBytes:   p.memory.Words * 32,
+		UnboundedOps:  p.unbounded,
+		UndefinedOps:  p.undefinedOps,
 	}
+}
 
-	// Create analysis report
-	report := &AnalysisReport{
-		TotalGas:        totalGas,
-		OpcodeFrequency: make(map[string]int),
-		OpcodeGas:       make(map[string]uint64),
-		StorageReads:    storage.SLoadCount,
-		StorageWrites:   storage.SStoreCount,
-		Loops:           loopTracker.Loops,
-		Functions:       functionTracker.Functions,
-		TopExpensiveOps: convertToOpGasPairs(topExpensiveOpcodes(opcodeGas, 10)),
-		Optimizations:   GenerateOptimizationSuggestions(storage, loopTracker.Loops, opcodeGas),
+// finishReport fills the report fields derived from the trackers.
+func (a *analysis) finishReport() {
+	report := a.report
+	report.OpcodeFrequency = make(map[string]int)
+	report.OpcodeGas = make(map[string]uint64)
+	report.StorageReads = a.storage.SLoadCount
+	report.StorageWrites = a.storage.SStoreCount
+	report.StorageVariables = a.storage.SortedVariables()
+	report.Loops = a.loopTracker.Loops
+	report.Functions = a.functionTracker.Functions
+	report.Subroutines = a.functionTracker.Subroutines
+	if a.cfg != nil {
+		report.StackFaults = a.cfg.StackFaults
 	}
+	report.Packing = a.advisePacking()
+	report.TransientReads = a.storage.TLoadCount
+	report.TransientWrites = a.storage.TStoreCount
+	report.ReentrancyGuards = a.findReentrancyGuards()
+	report.RedundantLoads = a.findRedundantLoads()
+	report.TopExpensiveOps = convertToOpGasPairs(topExpensiveOpcodes(a.opcodeGas, 10))
+	a.setSuggestions()
 
 	// Convert opcode maps to string keys for JSON export
-	for op, count := range opcodeCount {
+	for op, count := range a.opcodeCount {
 		report.OpcodeFrequency[op.String()] = count
 	}
-	for op, gas := range opcodeGas {
+	for op, gas := range a.opcodeGas {
 		report.OpcodeGas[op.String()] = gas
 	}
+}
+
+// name attaches text signatures from db to the discovered functions and
+// lists the known events the code emits. A nil db leaves them unnamed.
+func (a *analysis) name(db *signatures.DB) {
+	if db == nil {
+		return
+	}
+	a.functionTracker.Name(db)
+	a.report.Functions = a.functionTracker.Functions
+	a.report.Subroutines = a.functionTracker.Subroutines
+	a.report.Events = findEvents(a.trace, db)
+	a.report.Packing = a.advisePacking()
+	a.report.RedundantLoads = a.findRedundantLoads()
+	a.setSuggestions()
+}
+
+// applyLayout names storage variables from a solc storage layout, and
+// regenerates the suggestions so that packing advice names variables. A
+// nil layout leaves the report as it is.
+func (a *analysis) applyLayout(l *layout.Layout) {
+	if l == nil {
+		return
+	}
+	a.storage.Layout = l
+	a.loopTracker.applyLayout(l)
+	a.report.StorageVariables = a.storage.SortedVariables()
+	a.report.ReentrancyGuards = a.findReentrancyGuards()
+	a.setSuggestions()
+	a.report.Packing = a.advisePacking()
+}
+
+// suggestions generates the optimization suggestions, including caching
+// redundant reads and moving reentrancy guards to transient storage.
+func (a *analysis) suggestions() []Suggestion {
+	out := cacheSuggestions(a.storage, a.report.RedundantLoads)
+	out = append(out, GenerateOptimizationSuggestions(a.storage, a.loopTracker.Loops, a.opcodeGas)...)
+	needsFork := ""
+	if s, err := NewGasSchedule(a.report.Fork); err == nil && !s.IsAtLeast("cancun") {
+		needsFork = "cancun"
+	}
+	return append(out, guardSuggestions(a.report.ReentrancyGuards, needsFork)...)
+}
+
+// print writes the trace followed by the simple or detailed report.
+func (a *analysis) print(opts Options) {
+	sectionAt := map[int]EOFCodeSection{}
+	if a.report.EOF != nil {
+		for _, sec := range a.report.EOF.CodeSections {
+			sectionAt[sec.Offset] = sec
+		}
+	}
+	for _, t := range a.trace {
+		ins, gas := t.ins, t.static+t.dynamic.Gas
+		if sec, ok := sectionAt[ins.PC]; ok {
+			fmt.Printf("--- Code %s, max stack %d ---\n", sec.Label(), sec.MaxStackHeight)
+		}
+		switch {
+		case t.dead:
+			fmt.Printf("%04d: %-10s Gas: - (unreachable, excluded)\n", ins.PC, ins.Op.String())
+		case !t.dynamic.Bounded:
+			fmt.Printf("%04d: %-10s Gas: >=%d (dynamic, unbounded)\n", ins.PC, ins.Op.String(), gas)
+		case t.dynamic.Gas > 0:
+			fmt.Printf("%04d: %-10s Gas: %d (%d static + %d dynamic)\n", ins.PC, ins.Op.String(), gas, t.static, t.dynamic.Gas)
+		case t.defined:
+			fmt.Printf("%04d: %-10s Gas: %d\n", ins.PC, ins.Op.String(), gas)
+		default:
+			fmt.Printf("%04d: %-10s Gas: unknown (not defined in %s)\n", ins.PC, ins.Op.String(), a.report.Fork)
+		}
+		switch {
+		case disasm.ImmediateSize(ins.Op) > 0:
+			fmt.Printf("      PUSH Data: 0x%s\n", hex.EncodeToString(ins.Immediate))
+		case len(ins.Immediate) > 0:
+			fmt.Printf("      Immediate: 0x%s\n", hex.EncodeToString(ins.Immediate))
+		}
+		if src := a.source(ins.PC); src != "" {
+			fmt.Printf("      Source: %s\n", src)
+		}
+	}
+
+	if a.maxSSTORERun > 1 {
+		fmt.Printf("\nDetected %d consecutive SSTORE instructions. Consider packing variables.\n", a.maxSSTORERun)
+	}
+
+	if a.report.Execution != nil {
+		PrintExecutionSummary(a.report)
+	}
 
 	// Choose output format based on detailed flag
-	if detailed {
-		printDetailedReport(opcodeCount, opcodeGas, totalGas, storage, loopTracker, functionTracker, report.Optimizations)
+	if opts.Detailed {
+		printDetailedReport(a)
 	} else {
-		PrintSimpleReport(report)
+		PrintSimpleReport(a.report)
 	}
+}
 
+// export writes the JSON and CSV reports to the working directory, as
+// name.json and name.csv.
+func (a *analysis) export(name string) {
+	if name == "" {
+		name = "analysis_report"
+	}
 	// Export reports (always generate these)
 	fmt.Println("\n📄 Reports saved:")
-	if err := ExportToJSON(report, "analysis_report.json"); err != nil {
+	if err := ExportToJSON(a.report, name+".json"); err != nil {
 		fmt.Printf("❌ Failed to export JSON: %v\n", err)
 	} else {
-		fmt.Println("✓ analysis_report.json")
+		fmt.Println("✓ " + name + ".json")
 	}
 
-	if err := ExportToCSV(report, "analysis_report.csv"); err != nil {
+	if err := ExportToCSV(a.report, name+".csv"); err != nil {
 		fmt.Printf("❌ Failed to export CSV: %v\n", err)
 	} else {
-		fmt.Println("✓ analysis_report.csv")
+		fmt.Println("✓ " + name + ".csv")
 	}
 }
 
@@ -178,6 +374,14 @@ func topExpensiveOpcodes(opcodeGas map[vm.OpCode]uint64, topN int) []opGasPair {
 	return pairs
 }
 
+// acrossSlots notes how many slots a mapping or array access count covers.
+func acrossSlots(v StorageVariable) string {
+	if len(v.Locations) > 1 {
+		return fmt.Sprintf(" across %d slots", len(v.Locations))
+	}
+	return ""
+}
+
 func convertToOpGasPairs(pairs []opGasPair) []OpGasPair {
 	result := make([]OpGasPair, len(pairs))
 	for i, pair := range pairs {
@@ -211,11 +415,72 @@ func printBarChart(label string, data map[string]uint64, maxWidth int) {
 	}
 }
 
-func printDetailedReport(opcodeCount map[vm.OpCode]int, opcodeGas map[vm.OpCode]uint64, totalGas uint64, storage *StorageTracker, loopTracker *LoopTracker, functionTracker *FunctionTracker, suggestions []string) {
+func printDetailedReport(a *analysis) {
+	report, opcodeCount, opcodeGas := a.report, a.opcodeCount, a.opcodeGas
+	loopTracker, functionTracker, cfg := a.loopTracker, a.functionTracker, a.cfg
+	fmt.Printf("\nGas priced under %s rules\n", report.Fork)
+
+	if d := report.Deployment; d != nil {
+		fmt.Println("\n=== Deployment Cost ===")
+		fmt.Printf("Init code: %d bytes, runtime code: %d bytes, constructor arguments: %d bytes\n",
+			d.InitCodeSize, d.RuntimeSize, d.ConstructorArgsSize)
+		fmt.Printf("Intrinsic (base + calldata + init code words): %d gas\n", d.IntrinsicGas)
+		if d.InitUnbounded {
+			fmt.Printf("Constructor execution: >=%d gas (dynamic, unbounded)\n", d.InitExecutionGas)
+		} else {
+			fmt.Printf("Constructor execution: %d gas\n", d.InitExecutionGas)
+		}
+		fmt.Printf("Code deposit (200 gas/byte): %d gas\n", d.CodeDepositGas)
+		if d.FloorGas > 0 {
+			fmt.Printf("Calldata floor (EIP-7623): %d gas\n", d.FloorGas)
+		}
+		fmt.Printf("Total deployment: %d gas\n", d.TotalGas)
+		for _, w := range d.Warnings {
+			fmt.Printf("Warning: %s\n", w)
+		}
+		fmt.Println("The rest of this report covers the runtime code.")
+	}
+
+	if e := report.EOF; e != nil {
+		fmt.Println("\n=== EOF Container ===")
+		fmt.Printf("Version %d: %d code sections, %d subcontainers, %d data bytes\n",
+			e.Version, len(e.CodeSections), e.Containers, e.DataSize)
+		for _, sec := range e.CodeSections {
+			bound := ""
+			if sec.Unbounded {
+				bound = ">="
+			}
+			fmt.Printf("Code %s at offset %d: %d bytes, max stack %d, %s%d gas\n",
+				sec.Label(), sec.Offset, sec.Size, sec.MaxStackHeight, bound, sec.Gas)
+			for _, callee := range sec.Calls {
+				fmt.Printf("  calls section %d\n", callee)
+			}
+		}
+	}
+
+	if md := report.Metadata; md != nil {
+		fmt.Println("\n=== Compiler Metadata ===")
+		fmt.Printf("Compiler: %s %s\n", md.Compiler, md.Version)
+		if md.SourceHash != "" {
+			fmt.Printf("Source hash: %s\n", md.SourceHash)
+		}
+		if md.Experimental {
+			fmt.Println("Compiled with experimental features")
+		}
+		fmt.Printf("Trailer: %d bytes excluded from analysis\n", md.Size)
+	}
+
 	// Summary
 	fmt.Println("\n=== Opcode Frequency Summary ===")
 	for op, count := range opcodeCount {
-		fmt.Printf("%-10s : %d times, approx gas: %d\n", op.String(), count, count*int(GetGasCost(op)))
+		fmt.Printf("%-10s : %d times, approx gas: %d\n", op.String(), count, opcodeGas[op])
+	}
+
+	if len(report.UndefinedOps) > 0 {
+		fmt.Printf("\n=== Opcodes Not Defined in %s ===\n", report.Fork)
+		for op, count := range report.UndefinedOps {
+			fmt.Printf("%-10s : %d times, not priced\n", op, count)
+		}
 	}
 
 	fmt.Println("\n=== Top 5 Expensive Opcodes ===")
@@ -223,7 +488,15 @@ func printDetailedReport(opcodeCount map[vm.OpCode]int, opcodeGas map[vm.OpCode]
 		fmt.Printf("%d. %-10s : %d gas\n", i+1, pair.Op.String(), pair.Gas)
 	}
 
-	fmt.Println("\nTotal Approximate Gas Cost:", totalGas)
+	fmt.Println("\nTotal Approximate Gas Cost:", report.TotalGas)
+	fmt.Printf("Dynamic Gas (memory expansion, copies, hashing, logs): %d\n", report.DynamicGas)
+	fmt.Printf("Peak Memory Modelled: %d bytes\n", report.MemoryBytes)
+	if len(report.UnboundedOps) > 0 {
+		fmt.Printf("Total is a lower bound: %d instructions have unbounded dynamic cost\n", len(report.UnboundedOps))
+		for _, u := range report.UnboundedOps {
+			fmt.Printf("  PC %d %-14s >= %d gas (dynamic, unbounded)\n", u.PC, u.Opcode, u.LowerBound)
+		}
+	}
 
 	// Charts
 	opcodeChart := map[string]uint64{}
@@ -231,19 +504,88 @@ func printDetailedReport(opcodeCount map[vm.OpCode]int, opcodeGas map[vm.OpCode]
 		opcodeChart[op.String()] = gas
 	}
 	printBarChart("Top Gas-Consuming Opcodes", opcodeChart, 50)
+	printSourceHeatmap(report.SourceLines, 20, 40)
+
+	fmt.Println("\n=== Storage Gas Breakdown ===")
+	fmt.Printf("Cold slot access : %d gas\n", report.StorageGas.ColdAccess)
+	fmt.Printf("Warm slot access : %d gas\n", report.StorageGas.WarmAccess)
+	fmt.Printf("Set              : %d gas\n", report.StorageGas.Set)
+	fmt.Printf("Reset            : %d gas\n", report.StorageGas.Reset)
+	fmt.Printf("Refund           : %d gas\n", report.StorageGas.Refund)
+	fmt.Printf("Transient        : %d gas\n", report.StorageGas.Transient)
+	fmt.Printf("Account access   : %d cold (%d gas), %d warm\n",
+		report.AccountAccess.ColdAccesses, report.AccountAccess.ColdGas, report.AccountAccess.WarmAccesses)
+
+	fmt.Println("\n=== Storage Variables ===")
+	for _, v := range report.StorageVariables {
+		fmt.Printf("%-20s %d reads, %d writes\n", v.Label(), v.Reads, v.Writes)
+		if len(v.Fields) > 1 {
+			for _, f := range v.Fields {
+				fmt.Printf("  %s %s: bytes %d-%d\n", f.Type, f.Name, f.Offset, f.Offset+f.Bytes-1)
+			}
+		}
+		for _, loc := range v.Locations {
+			fmt.Printf("  %s\n", loc)
+		}
+		if len(v.Sources) > 0 {
+			fmt.Printf("  accessed at %s\n", strings.Join(v.Sources, ", "))
+		}
+	}
 
 	fmt.Println("\n=== Storage Write Hotspots ===")
-	for slot, count := range storage.SStoreCount {
-		if count > 1 {
-			fmt.Printf("Slot %d written %d times – consider packing or caching\n", slot, count)
+	for _, v := range report.StorageVariables {
+		if v.Writes > 1 && v.Kind != VariableUnknown {
+			fmt.Printf("%s written %d times%s – consider packing or caching\n", v.Label(), v.Writes, acrossSlots(v))
+		}
+	}
+
+	fmt.Println("\n=== Redundant Storage Reads ===")
+	if len(report.RedundantLoads) == 0 {
+		fmt.Println("No slot is read twice on a path without a write or call in between")
+	}
+	for _, l := range report.RedundantLoads {
+		fmt.Printf("PC %-6d %-24s slot %s, already read at PC %d – reuse it to save %d gas\n",
+			l.PC, l.Function, a.storage.describe(l.Slot), l.FirstPC, l.GasSaved)
+		if l.Source != "" {
+			fmt.Printf("  at %s\n", l.Source)
+		}
+	}
+
+	fmt.Println("\n=== Storage Packing Advisor ===")
+	if report.Packing == nil {
+		fmt.Println("No slots found that are always accessed together and fit in one slot")
+	} else {
+		for _, slot := range report.Packing.Slots {
+			fmt.Printf("Slot %s (%d bytes):\n", slot.Slot, slot.Bytes)
+			for _, v := range slot.Variables {
+				fmt.Printf("  bytes %d-%d: %s\n", v.Offset, v.Offset+v.Bytes-1, v.Label())
+			}
+		}
+		for _, s := range report.Packing.Savings {
+			fmt.Printf("%-30s saves ~%d gas per call\n", s.Function, s.GasSaved)
 		}
 	}
 
-	fmt.Println("\n=== Repeated Storage Reads ===")
-	for slot, count := range storage.SLoadCount {
-		if count > 2 {
-			fmt.Printf("Slot %d read %d times – cache in memory variable\n", slot, count)
+	fmt.Println("\n=== Transient Storage ===")
+	if len(report.TransientReads) == 0 && len(report.TransientWrites) == 0 {
+		fmt.Println("No TLOAD or TSTORE instructions")
+	}
+	for _, slot := range sortedSlotKeys(report.TransientReads, report.TransientWrites) {
+		fmt.Printf("Slot %-15s %d reads, %d writes\n", slot, report.TransientReads[slot], report.TransientWrites[slot])
+	}
+
+	fmt.Println("\n=== Reentrancy Guards ===")
+	if len(report.ReentrancyGuards) == 0 {
+		fmt.Println("No storage-based reentrancy guards detected")
+	}
+	for _, g := range report.ReentrancyGuards {
+		fmt.Printf("%s: set to %s at PC %d, call at PC %d, reset to %s at PC %d\n",
+			g.Label(), g.LockValue, g.LockPC, g.CallPC, g.UnlockValue, g.UnlockPC)
+		for _, fn := range g.Functions {
+			fmt.Printf("  guards %s\n", fn)
 		}
+		fmt.Printf("  storage: %d gas (%d refunded), transient: %d gas, saves ~%d gas per call\n",
+			g.StorageGas, g.Refund, g.TransientGas, g.GasSaved)
 	}
 
 	fmt.Println("\n=== Loop Detection ===")
@@ -251,15 +593,50 @@ func printDetailedReport(opcodeCount map[vm.OpCode]int, opcodeGas map[vm.OpCode]
 		fmt.Println("No backward jumps detected (no loops found)")
 	} else {
 		for _, loop := range loopTracker.Loops {
-			fmt.Printf(
-				"Loop detected: PC %d -> %d (executed %d times) – consider optimizing or limiting iterations\n",
-				loop.StartPC,
-				loop.EndPC,
-				loop.Count,
-			)
+			fmt.Printf("Loop at PC %d -> %d: %s\n", loop.StartPC, loop.EndPC, loop.Summary())
+			if loop.Source != "" {
+				fmt.Printf("  at %s\n", loop.Source)
+			}
+			if loop.Condition != "" {
+				fmt.Printf("  exits at PC %d on %s\n", loop.ExitPC, loop.Condition)
+			}
+			if loop.Induction != "" {
+				fmt.Printf("  counter %s\n", loop.Induction)
+			}
+			if loop.Count > 0 {
+				fmt.Printf("  executed %d times\n", loop.Count)
+			}
 		}
 	}
 
+	fmt.Println("\n=== Control Flow ===")
+	edges := 0
+	for _, b := range cfg.Blocks {
+		edges += len(b.Succs)
+	}
+	fmt.Printf("%d basic blocks, %d edges, %d unresolved jumps, %d invalid jumps\n",
+		len(cfg.Blocks), edges, len(cfg.Unresolved), len(cfg.Invalid))
+	for _, pc := range cfg.Unresolved {
+		fmt.Printf("Unresolved jump at PC %d\n", pc)
+	}
+	for _, pc := range cfg.Invalid {
+		fmt.Printf("Jump at PC %d targets a non-JUMPDEST\n", pc)
+	}
+	for _, f := range cfg.StackFaults {
+		fmt.Println(f)
+	}
+
+	fmt.Println("\n=== Unreachable Code ===")
+	if dc := report.DeadCode; dc == nil {
+		fmt.Println("No unreachable blocks found")
+	} else {
+		for _, r := range dc.Regions {
+			fmt.Printf("PC %d-%d (%d bytes, %s) can never execute\n", r.Start, r.End, r.Bytes, r.Kind)
+		}
+		fmt.Printf("%d bytes, %d instructions excluded from the totals (%d gas)\n", dc.Bytes, dc.Instructions, dc.ExcludedGas)
+		fmt.Printf("Removing them would save ~%d gas at deployment\n", dc.DeploymentSaving)
+	}
+
 	fmt.Println("\n=== Function Gas Usage ===")
 	if len(functionTracker.Functions) == 0 {
 		fmt.Println("No function selectors detected")
@@ -268,21 +645,55 @@ func printDetailedReport(opcodeCount map[vm.OpCode]int, opcodeGas map[vm.OpCode]
 		topFunctions := GetTopExpensiveFunctions(functionTracker.Functions, 5)
 		fmt.Println("\n=== Top 5 Most Expensive Functions ===")
 		for i, fn := range topFunctions {
-			fmt.Printf("%d. Function %s at PC %d used approx %d gas\n",
-				i+1, fn.Selector, fn.EntryPC, fn.Gas)
+			fmt.Printf("%d. Function %s at PC %d (%s dispatch) used approx %d gas\n",
+				i+1, fn.Label(), fn.EntryPC, fn.Discovery, fn.Gas)
 		}
 		
 		fmt.Println("\n=== All Functions ===")
 		for _, fn := range functionTracker.Functions {
-			fmt.Printf("Function %s at PC %d used approx %d gas\n",
-				fn.Selector, fn.EntryPC, fn.Gas)
+			fmt.Printf("Function %s at PC %d (%s dispatch) used approx %d gas\n",
+				fn.Label(), fn.EntryPC, fn.Discovery, fn.Gas)
+			if fn.MaxGas > 0 {
+				fmt.Printf("  per call: %s\n", fn.PathSummary())
+				fmt.Printf("  worst path: %s\n", joinPCs(fn.WorstPath))
+			}
+		}
+	}
+
+	if len(functionTracker.Subroutines) > 0 {
+		fmt.Println("\n=== Internal Functions ===")
+		for _, sub := range functionTracker.Subroutines {
+			fmt.Printf("%s: %d gas exclusive, %d inclusive, called at PC %s\n",
+				sub.Label(), sub.ExclusiveGas, sub.InclusiveGas, joinInts(sub.CallSites))
+			fmt.Printf("  callers: %s\n", strings.Join(sub.Callers, ", "))
+			if sub.Shared() {
+				fmt.Printf("  shared by %d functions: %s\n", len(sub.Functions), strings.Join(sub.Functions, ", "))
+			}
+		}
+
+		fmt.Println("\n=== Call Graph ===")
+		printed := map[int]bool{}
+		for _, fn := range functionTracker.Functions {
+			fmt.Printf("%s (PC %d)\n", fn.Label(), fn.EntryPC)
+			printCallTree(functionTracker, fn.Calls, 1, printed)
+		}
+		if calls := functionTracker.entryCalls(); len(calls) > 0 {
+			fmt.Println(functionTracker.callerLabel(entryCaller))
+			printCallTree(functionTracker, calls, 1, printed)
+		}
+	}
+
+	if len(report.Events) > 0 {
+		fmt.Println("\n=== Events ===")
+		for _, e := range report.Events {
+			fmt.Printf("%s (topic %s) at PC %d\n", e.Label(), e.Topic, e.PC)
 		}
 	}
 
 	// Generate optimization suggestions
-	if len(suggestions) > 0 {
+	if len(report.Optimizations) > 0 {
 		fmt.Println("\n=== Optimization Suggestions ===")
-		for i, suggestion := range suggestions {
+		for i, suggestion := range report.Optimizations {
 			fmt.Printf("%d. %s\n", i+1, suggestion)
 		}
 	}
@@ -0,0 +1,265 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// sampleSliceLen is the length of dynamic arrays in boundary samples.
+const sampleSliceLen = 3
+
+// EncodeCall ABI-encodes a call to method with arguments given as JSON
+// values: numbers or numeric strings for integers, hex strings for
+// addresses and bytes, arrays for lists, and arrays or objects for tuples.
+func EncodeCall(method abi.Method, args []json.RawMessage) ([]byte, error) {
+	if len(args) != len(method.Inputs) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", method.Sig, len(method.Inputs), len(args))
+	}
+	values := make([]interface{}, len(args))
+	for i, input := range method.Inputs {
+		v, err := jsonValue(input.Type, args[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s argument %d (%s): %v", method.Sig, i, input.Type, err)
+		}
+		values[i] = v.Interface()
+	}
+	return packCall(method, values)
+}
+
+// SampleCalls builds calldata for method from generated arguments: one call
+// with every argument zero or empty, and one with boundary values (maximum
+// integers, all-ones bytes and addresses, multi-word strings and non-empty
+// arrays). Methods without inputs get a single call.
+func SampleCalls(method abi.Method) ([]ProfileCall, error) {
+	if len(method.Inputs) == 0 {
+		data, err := packCall(method, nil)
+		return []ProfileCall{{Label: "no arguments", Calldata: data}}, err
+	}
+	var calls []ProfileCall
+	for _, boundary := range []bool{false, true} {
+		values := make([]interface{}, len(method.Inputs))
+		for i, input := range method.Inputs {
+			values[i] = sampleValue(input.Type, boundary).Interface()
+		}
+		data, err := packCall(method, values)
+		if err != nil {
+			return nil, err
+		}
+		label := "zero values"
+		if boundary {
+			label = "boundary values"
+		}
+		calls = append(calls, ProfileCall{Label: label, Calldata: data})
+	}
+	return calls, nil
+}
+
+func packCall(method abi.Method, values []interface{}) ([]byte, error) {
+	packed, err := method.Inputs.Pack(values...)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, method.ID...), packed...), nil
+}
+
+// sampleValue returns a value of type t for SampleCalls.
+func sampleValue(t abi.Type, boundary bool) reflect.Value {
+	typ := t.GetType()
+	v := reflect.New(typ).Elem()
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		n := new(big.Int)
+		if boundary {
+			bits := t.Size
+			if t.T == abi.IntTy {
+				bits--
+			}
+			n.Lsh(big.NewInt(1), uint(bits)).Sub(n, big.NewInt(1))
+		}
+		setInteger(v, n)
+	case abi.BoolTy:
+		v.SetBool(boundary)
+	case abi.StringTy:
+		if boundary {
+			v.SetString(strings.Repeat("x", 64))
+		}
+	case abi.BytesTy:
+		size := 0
+		if boundary {
+			size = 64
+		}
+		v.SetBytes(filledBytes(size, boundary))
+	case abi.AddressTy, abi.FixedBytesTy, abi.HashTy, abi.FunctionTy:
+		reflect.Copy(v, reflect.ValueOf(filledBytes(v.Len(), boundary)))
+	case abi.SliceTy:
+		size := 0
+		if boundary {
+			size = sampleSliceLen
+		}
+		v.Set(reflect.MakeSlice(typ, size, size))
+		for i := 0; i < size; i++ {
+			v.Index(i).Set(sampleValue(*t.Elem, boundary))
+		}
+	case abi.ArrayTy:
+		for i := 0; i < t.Size; i++ {
+			v.Index(i).Set(sampleValue(*t.Elem, boundary))
+		}
+	case abi.TupleTy:
+		for i, elem := range t.TupleElems {
+			v.Field(i).Set(sampleValue(*elem, boundary))
+		}
+	}
+	return v
+}
+
+func filledBytes(size int, ones bool) []byte {
+	b := make([]byte, size)
+	if ones {
+		for i := range b {
+			b[i] = 0xff
+		}
+	}
+	return b
+}
+
+// jsonValue decodes raw into a value of type t, as accepted by abi.Pack.
+func jsonValue(t abi.Type, raw json.RawMessage) (reflect.Value, error) {
+	typ := t.GetType()
+	v := reflect.New(typ).Elem()
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			s = string(raw)
+		}
+		n, ok := new(big.Int).SetString(strings.TrimSpace(s), 0)
+		if !ok {
+			return v, fmt.Errorf("invalid integer %s", raw)
+		}
+		if !fitsType(t, n) {
+			return v, fmt.Errorf("%s out of range", n)
+		}
+		setInteger(v, n)
+	case abi.BoolTy:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case abi.StringTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return v, err
+		}
+		v.SetString(s)
+	case abi.AddressTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil || !common.IsHexAddress(s) {
+			return v, fmt.Errorf("invalid address %s", raw)
+		}
+		v.Set(reflect.ValueOf(common.HexToAddress(s)))
+	case abi.BytesTy, abi.FixedBytesTy, abi.HashTy, abi.FunctionTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return v, err
+		}
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return v, err
+		}
+		if t.T == abi.BytesTy {
+			v.SetBytes(b)
+			break
+		}
+		if len(b) > v.Len() {
+			return v, fmt.Errorf("%d bytes do not fit in %s", len(b), t)
+		}
+		reflect.Copy(v, reflect.ValueOf(b))
+	case abi.SliceTy, abi.ArrayTy:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return v, err
+		}
+		if t.T == abi.ArrayTy && len(elems) != t.Size {
+			return v, fmt.Errorf("expected %d elements, got %d", t.Size, len(elems))
+		}
+		if t.T == abi.SliceTy {
+			v.Set(reflect.MakeSlice(typ, len(elems), len(elems)))
+		}
+		for i, elem := range elems {
+			ev, err := jsonValue(*t.Elem, elem)
+			if err != nil {
+				return v, fmt.Errorf("element %d: %v", i, err)
+			}
+			v.Index(i).Set(ev)
+		}
+	case abi.TupleTy:
+		fields, err := tupleFields(t, raw)
+		if err != nil {
+			return v, err
+		}
+		for i, elem := range t.TupleElems {
+			fv, err := jsonValue(*elem, fields[i])
+			if err != nil {
+				return v, fmt.Errorf("field %s: %v", t.TupleRawNames[i], err)
+			}
+			v.Field(i).Set(fv)
+		}
+	default:
+		return v, fmt.Errorf("unsupported type %s", t)
+	}
+	return v, nil
+}
+
+// tupleFields splits a tuple given as a JSON array of fields in order, or
+// as an object keyed by field name.
+func tupleFields(t abi.Type, raw json.RawMessage) ([]json.RawMessage, error) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err == nil {
+		if len(fields) != len(t.TupleElems) {
+			return nil, fmt.Errorf("expected %d fields, got %d", len(t.TupleElems), len(fields))
+		}
+		return fields, nil
+	}
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &named); err != nil {
+		return nil, fmt.Errorf("tuple must be an array or object: %s", raw)
+	}
+	fields = make([]json.RawMessage, len(t.TupleElems))
+	for i, name := range t.TupleRawNames {
+		field, ok := named[name]
+		if !ok {
+			return nil, fmt.Errorf("missing field %s", name)
+		}
+		fields[i] = field
+	}
+	return fields, nil
+}
+
+// fitsType reports whether n is in range for the integer type t.
+func fitsType(t abi.Type, n *big.Int) bool {
+	if t.T == abi.UintTy {
+		return n.Sign() >= 0 && n.BitLen() <= t.Size
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+	return n.Cmp(new(big.Int).Neg(limit)) >= 0 && n.Cmp(limit) < 0
+}
+
+// setInteger stores n in v, which is either a sized Go integer or *big.Int.
+func setInteger(v reflect.Value, n *big.Int) {
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(n.Int64())
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(n.Uint64())
+	default:
+		v.Set(reflect.ValueOf(new(big.Int).Set(n)))
+	}
+}
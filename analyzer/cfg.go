@@ -0,0 +1,564 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gaslens/disasm"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// maxStatesPerBlock bounds how many distinct entry stacks a block is
+// explored with, so propagation terminates on loops that grow the stack.
+const maxStatesPerBlock = 64
+
+// stateKeyDepth is how many top stack entries distinguish two entry states.
+const stateKeyDepth = 32
+
+type EdgeKind int
+
+const (
+	EdgeFallthrough EdgeKind = iota
+	EdgeJump
+	// EdgeReturn is a jump to a return address: one pushed by another block
+	// before it jumped away, which is how internal functions return to
+	// their caller.
+	EdgeReturn
+	// EdgeCall enters another EOF code section through CALLF or JUMPF.
+	EdgeCall
+)
+
+// Edge connects two blocks, identified by their start pcs.
+type Edge struct {
+	From     int
+	To       int
+	Kind     EdgeKind
+	CallSite int // for EdgeReturn, the block that pushed the return address
+}
+
+type Block struct {
+	disasm.BasicBlock
+	Succs     []Edge
+	Preds     []Edge
+	Reachable bool
+}
+
+// CFG is the control-flow graph of a contract's basic blocks.
+type CFG struct {
+	Blocks     []*Block
+	JumpDests  map[int]bool
+	Unresolved []int // pcs of reachable jumps whose target is not a known constant
+	Invalid    []int // pcs of reachable jumps to a constant that is not a JUMPDEST
+	// StackFaults are the instructions some path reaches with too few stack
+	// items, or with too many for what they push.
+	StackFaults []StackFault
+	byStart     map[int]*Block
+}
+
+// StackFault is an instruction that halts with a stack underflow or
+// overflow on at least one path. Height is the stack height on the worst
+// such path; Needs is how many items it must find on the stack.
+type StackFault struct {
+	PC       int    `json:"pc"`
+	Opcode   string `json:"opcode"`
+	Overflow bool   `json:"overflow,omitempty"`
+	Height   int    `json:"height"`
+	Needs    int    `json:"needs"`
+}
+
+func (f StackFault) String() string {
+	if f.Overflow {
+		return fmt.Sprintf("Stack overflow at PC %d: %s is reached with the stack growing past %d items", f.PC, f.Opcode, params.StackLimit)
+	}
+	return fmt.Sprintf("Stack underflow at PC %d: %s needs %d items, a path reaches it with %d", f.PC, f.Opcode, f.Needs, f.Height)
+}
+
+// cfgValue is an abstract stack entry: a constant computed at origin, or
+// unknown. Symbols are dropped, since only constants resolve jumps and
+// keeping them would multiply the entry states of every block.
+type cfgValue struct {
+	value  Value
+	origin int
+}
+
+type cfgState struct {
+	start int
+	stack []cfgValue
+}
+
+// BuildCFG splits instrs into basic blocks and connects them, resolving jump
+// targets by propagating constants across blocks on an abstract stack.
+func BuildCFG(instrs []disasm.Instruction) *CFG {
+	g := &CFG{
+		JumpDests: make(map[int]bool),
+		byStart:   make(map[int]*Block),
+	}
+	for _, bb := range disasm.SplitBlocks(instrs) {
+		b := &Block{BasicBlock: bb}
+		g.Blocks = append(g.Blocks, b)
+		g.byStart[b.Start] = b
+		if bb.Instructions[0].Op == vm.JUMPDEST {
+			g.JumpDests[b.Start] = true
+		}
+	}
+	if len(g.Blocks) == 0 {
+		return g
+	}
+
+	edges := map[Edge]bool{}
+	unresolved := map[int]bool{}
+	invalid := map[int]bool{}
+	faults := map[int]StackFault{}
+	seen := map[int]map[string]bool{}
+	// highest and growth track each block's entry heights: a block entered
+	// higher every time until its state budget runs out is in a loop that
+	// grows the stack, which overflows however many iterations it takes.
+	highest := map[int]int{}
+	growth := map[int]int{}
+	work := []cfgState{{start: 0}}
+
+	for len(work) > 0 {
+		st := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		key := stateKey(st.stack)
+		if seen[st.start] == nil {
+			seen[st.start] = map[string]bool{}
+		}
+		if seen[st.start][key] {
+			continue
+		}
+		height := len(st.stack)
+		if len(seen[st.start]) >= maxStatesPerBlock {
+			if height > highest[st.start] && growth[st.start] >= maxStatesPerBlock/2 {
+				first := g.byStart[st.start].Instructions[0]
+				faults[first.PC] = StackFault{PC: first.PC, Opcode: first.Op.String(), Overflow: true, Height: height}
+			}
+			continue
+		}
+		seen[st.start][key] = true
+		if height > highest[st.start] {
+			highest[st.start] = height
+			growth[st.start]++
+		}
+
+		b := g.byStart[st.start]
+		b.Reachable = true
+		stack := append([]cfgValue(nil), st.stack...)
+		last := b.Last()
+
+		halted := false
+		for _, ins := range b.Instructions {
+			if f, ok := checkStackHeight(ins, len(stack)); !ok {
+				// The EVM halts here, so the path goes no further.
+				if prev, seen := faults[ins.PC]; !seen || worseFault(f, prev) {
+					faults[ins.PC] = f
+				}
+				halted = true
+				break
+			}
+			if ins.Op == vm.JUMP || ins.Op == vm.JUMPI {
+				break
+			}
+			stack = stepCFGStack(stack, ins)
+		}
+		if halted {
+			continue
+		}
+
+		follow := func(to int, kind EdgeKind, callSite int, next []cfgValue) {
+			edges[Edge{From: b.Start, To: to, Kind: kind, CallSite: callSite}] = true
+			work = append(work, cfgState{start: to, stack: next})
+		}
+
+		switch last.Op {
+		case vm.JUMP, vm.JUMPI:
+			var target cfgValue
+			target, stack = popCFG(stack)
+			if last.Op == vm.JUMPI {
+				_, stack = popCFG(stack)
+			}
+			dest, fits := target.value.Uint64()
+			switch {
+			case !target.value.IsConcrete():
+				unresolved[last.PC] = true
+			case !fits || !g.JumpDests[int(dest)]:
+				invalid[last.PC] = true
+			default:
+				if caller := g.returnSite(b, target.origin); caller != nil {
+					follow(int(dest), EdgeReturn, caller.Start, stack)
+				} else {
+					follow(int(dest), EdgeJump, 0, stack)
+				}
+			}
+			if last.Op == vm.JUMPI && g.byStart[b.End] != nil {
+				follow(b.End, EdgeFallthrough, 0, stack)
+			}
+		case vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID, vm.SELFDESTRUCT:
+		default:
+			if g.byStart[b.End] != nil {
+				follow(b.End, EdgeFallthrough, 0, stack)
+			}
+		}
+	}
+
+	for e := range edges {
+		g.byStart[e.From].Succs = append(g.byStart[e.From].Succs, e)
+		g.byStart[e.To].Preds = append(g.byStart[e.To].Preds, e)
+	}
+	for _, b := range g.Blocks {
+		sortEdges(b.Succs)
+		sortEdges(b.Preds)
+	}
+	g.Unresolved = sortedKeys(unresolved)
+	g.Invalid = sortedKeys(invalid)
+	for _, f := range faults {
+		g.StackFaults = append(g.StackFaults, f)
+	}
+	sort.Slice(g.StackFaults, func(i, j int) bool { return g.StackFaults[i].PC < g.StackFaults[j].PC })
+	return g
+}
+
+// returnSite returns the block that pushed a jump target found at origin
+// when the target is a return address: pushed by another block that then
+// jumped away unconditionally, leaving it on the stack to be jumped back
+// to. A target pushed by a block that falls or branches into the jump, as
+// loop heads and shared tails often are, is an ordinary jump.
+func (g *CFG) returnSite(b *Block, origin int) *Block {
+	if origin >= b.Start && origin < b.End {
+		return nil
+	}
+	caller := g.BlockAt(origin)
+	if caller == nil || caller.Last().Op != vm.JUMP {
+		return nil
+	}
+	return caller
+}
+
+// checkStackHeight reports whether ins can execute with height items on the
+// stack, and the fault it raises if not.
+func checkStackHeight(ins disasm.Instruction, height int) (StackFault, bool) {
+	// The table counts DUPn as popping n and pushing n+1, and SWAPn as
+	// popping and pushing n+1, which is exactly their height requirement.
+	pops, pushes := StackArity(ins.Op)
+	f := StackFault{PC: ins.PC, Opcode: ins.Op.String(), Height: height, Needs: pops}
+	switch {
+	case height < pops:
+		return f, false
+	case height-pops+pushes > int(params.StackLimit):
+		f.Overflow = true
+		return f, false
+	}
+	return f, true
+}
+
+// worseFault prefers overflows, then the lowest height an underflow is
+// reached with.
+func worseFault(f, prev StackFault) bool {
+	if f.Overflow != prev.Overflow {
+		return f.Overflow
+	}
+	if f.Overflow {
+		return f.Height > prev.Height
+	}
+	return f.Height < prev.Height
+}
+
+// Block returns the block starting at pc, or nil.
+func (g *CFG) Block(start int) *Block {
+	return g.byStart[start]
+}
+
+// BlockAt returns the block containing pc, or nil.
+func (g *CFG) BlockAt(pc int) *Block {
+	i := sort.Search(len(g.Blocks), func(i int) bool { return g.Blocks[i].End > pc })
+	if i < len(g.Blocks) && g.Blocks[i].Start <= pc {
+		return g.Blocks[i]
+	}
+	return nil
+}
+
+// Successors returns the start pcs of the blocks that may follow start.
+func (g *CFG) Successors(start int) []int {
+	var out []int
+	for _, e := range g.byStart[start].Succs {
+		out = append(out, e.To)
+	}
+	return out
+}
+
+// Predecessors returns the start pcs of the blocks that may precede start.
+func (g *CFG) Predecessors(start int) []int {
+	var out []int
+	for _, e := range g.byStart[start].Preds {
+		out = append(out, e.From)
+	}
+	return out
+}
+
+// ReachableFrom returns every block reachable from start, following calls
+// into internal functions but not their returns.
+func (g *CFG) ReachableFrom(start int) []*Block {
+	succs := g.flowGraph()
+	visited := map[int]bool{start: true}
+	queue := []int{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range succs[cur] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	var out []*Block
+	for _, b := range g.Blocks {
+		if visited[b.Start] {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// BackEdges returns the edges whose target dominates their source, i.e. the
+// latches of natural loops.
+func (g *CFG) BackEdges() []Edge {
+	if len(g.Blocks) == 0 {
+		return nil
+	}
+	succs := g.flowGraph()
+	idom := dominators(g.Blocks[0].Start, succs)
+	var out []Edge
+	for _, b := range g.Blocks {
+		if _, ok := idom[b.Start]; !ok {
+			continue
+		}
+		for _, to := range succs[b.Start] {
+			if dominates(idom, to, b.Start) {
+				out = append(out, Edge{From: b.Start, To: to, Kind: EdgeJump})
+			}
+		}
+	}
+	return out
+}
+
+// Unreachable returns the blocks that no execution can reach. When some
+// jumps could not be resolved every JUMPDEST is treated as a possible
+// target, so only code that cannot be entered at all is reported.
+func (g *CFG) Unreachable() []*Block {
+	live := map[int]bool{}
+	for i, b := range g.Blocks {
+		entered := b.Reachable || (len(g.Unresolved) > 0 && g.JumpDests[b.Start])
+		if !entered && i > 0 && live[g.Blocks[i-1].Start] && fallsThrough(g.Blocks[i-1]) {
+			entered = true
+		}
+		live[b.Start] = entered
+	}
+	var out []*Block
+	for _, b := range g.Blocks {
+		if !live[b.Start] {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// flowGraph returns the successor lists used for structural analyses:
+// internal function returns are replaced by an edge from the call site to
+// the return address, so that a helper called twice does not look like a
+// loop.
+func (g *CFG) flowGraph() map[int][]int {
+	succs := make(map[int][]int, len(g.Blocks))
+	for _, b := range g.Blocks {
+		for _, e := range b.Succs {
+			if e.Kind == EdgeReturn {
+				succs[e.CallSite] = append(succs[e.CallSite], e.To)
+			} else {
+				succs[e.From] = append(succs[e.From], e.To)
+			}
+		}
+	}
+	return succs
+}
+
+func fallsThrough(b *Block) bool {
+	switch b.Last().Op {
+	case vm.JUMP, vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID, vm.SELFDESTRUCT:
+		return false
+	}
+	return true
+}
+
+func stepCFGStack(stack []cfgValue, ins disasm.Instruction) []cfgValue {
+	op := ins.Op
+	switch {
+	case op == vm.PUSH0:
+		return append(stack, cfgValue{value: ConstUint64(0), origin: ins.PC})
+	case op >= vm.PUSH1 && op <= vm.PUSH32:
+		return append(stack, cfgValue{value: pushValue(ins), origin: ins.PC})
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		n := int(op-vm.DUP1) + 1
+		stack = padCFG(stack, n)
+		return append(stack, stack[len(stack)-n])
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		n := int(op-vm.SWAP1) + 1
+		stack = padCFG(stack, n+1)
+		top := len(stack) - 1
+		stack[top], stack[top-n] = stack[top-n], stack[top]
+		return stack
+	}
+	pops, pushes := StackArity(op)
+	args := make([]Value, pops)
+	for i := range args {
+		var v cfgValue
+		v, stack = popCFG(stack)
+		args[i] = v.value
+	}
+	if pushes == 1 {
+		// Masked or offset jump targets are folded like any constant.
+		v := evalOp(op, args, ins.PC)
+		if !v.IsConcrete() {
+			v = Unknown()
+		}
+		stack = append(stack, cfgValue{value: v, origin: ins.PC})
+	}
+	return stack
+}
+
+func popCFG(stack []cfgValue) (cfgValue, []cfgValue) {
+	if len(stack) == 0 {
+		return cfgValue{}, stack
+	}
+	return stack[len(stack)-1], stack[:len(stack)-1]
+}
+
+// padCFG grows stack from the bottom with unknown values to at least n items.
+func padCFG(stack []cfgValue, n int) []cfgValue {
+	if len(stack) >= n {
+		return stack
+	}
+	padded := make([]cfgValue, n-len(stack), n)
+	return append(padded, stack...)
+}
+
+func stateKey(stack []cfgValue) string {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(len(stack)))
+	for i := len(stack) - 1; i >= 0 && i >= len(stack)-stateKeyDepth; i-- {
+		sb.WriteByte('|')
+		if stack[i].value.IsConcrete() {
+			sb.WriteString(stack[i].value.String())
+			sb.WriteByte('@')
+			sb.WriteString(strconv.Itoa(stack[i].origin))
+		} else {
+			sb.WriteByte('?')
+		}
+	}
+	return sb.String()
+}
+
+// dominators computes immediate dominators for every node reachable from
+// entry using the Cooper-Harvey-Kennedy iterative algorithm.
+func dominators(entry int, succs map[int][]int) map[int]int {
+	var order []int
+	visited := map[int]bool{}
+	var dfs func(n int)
+	dfs = func(n int) {
+		visited[n] = true
+		for _, s := range succs[n] {
+			if !visited[s] {
+				dfs(s)
+			}
+		}
+		order = append(order, n)
+	}
+	dfs(entry)
+
+	rpo := map[int]int{}
+	for i, n := range order {
+		rpo[n] = len(order) - 1 - i
+	}
+	preds := map[int][]int{}
+	for n := range visited {
+		for _, s := range succs[n] {
+			preds[s] = append(preds[s], n)
+		}
+	}
+
+	idom := map[int]int{entry: entry}
+	intersect := func(a, b int) int {
+		for a != b {
+			for rpo[a] > rpo[b] {
+				a = idom[a]
+			}
+			for rpo[b] > rpo[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(order) - 1; i >= 0; i-- {
+			n := order[i]
+			if n == entry {
+				continue
+			}
+			newIdom, ok := -1, false
+			for _, p := range preds[n] {
+				if _, done := idom[p]; !done {
+					continue
+				}
+				if !ok {
+					newIdom, ok = p, true
+				} else {
+					newIdom = intersect(p, newIdom)
+				}
+			}
+			if cur, has := idom[n]; ok && (!has || cur != newIdom) {
+				idom[n] = newIdom
+				changed = true
+			}
+		}
+	}
+	return idom
+}
+
+// dominates reports whether a dominates b.
+func dominates(idom map[int]int, a, b int) bool {
+	for {
+		if a == b {
+			return true
+		}
+		parent, ok := idom[b]
+		if !ok || parent == b {
+			return false
+		}
+		b = parent
+	}
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		if edges[i].To != edges[j].To {
+			return edges[i].To < edges[j].To
+		}
+		return edges[i].Kind < edges[j].Kind
+	})
+}
+
+func sortedKeys(m map[int]bool) []int {
+	out := make([]int, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Ints(out)
+	return out
+}
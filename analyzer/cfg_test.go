@@ -0,0 +1,131 @@
+package analyzer
+
+import (
+	"testing"
+
+	"gaslens/disasm"
+)
+
+func TestBuildCFGEdges(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		want []Edge
+	}{
+		{
+			name: "jump to a target pushed in the same block",
+			// 0: PUSH1 4  2: JUMP  3: INVALID  4: JUMPDEST  5: STOP
+			code: []byte{0x60, 0x04, 0x56, 0xfe, 0x5b, 0x00},
+			want: []Edge{{From: 0, To: 4, Kind: EdgeJump}},
+		},
+		{
+			name: "conditional jump falls through",
+			// 0: PUSH1 1  2: PUSH1 6  4: JUMPI  5: STOP  6: JUMPDEST  7: STOP
+			code: []byte{0x60, 0x01, 0x60, 0x06, 0x57, 0x00, 0x5b, 0x00},
+			want: []Edge{
+				{From: 0, To: 5, Kind: EdgeFallthrough},
+				{From: 0, To: 6, Kind: EdgeJump},
+			},
+		},
+		{
+			name: "loop head pushed by the block falling into it",
+			// 0: PUSH1 2  2: JUMPDEST  3: DUP1  4: JUMP
+			code: []byte{0x60, 0x02, 0x5b, 0x80, 0x56},
+			want: []Edge{
+				{From: 0, To: 2, Kind: EdgeFallthrough},
+				{From: 2, To: 2, Kind: EdgeJump},
+			},
+		},
+		{
+			name: "internal call returns to the address its caller pushed",
+			// 0: PUSH1 6  2: PUSH1 9  4: JUMP  5: INVALID
+			// 6: JUMPDEST  7: STOP  8: INVALID  9: JUMPDEST  10: JUMP
+			code: []byte{0x60, 0x06, 0x60, 0x09, 0x56, 0xfe, 0x5b, 0x00, 0xfe, 0x5b, 0x56},
+			want: []Edge{
+				{From: 0, To: 9, Kind: EdgeJump},
+				{From: 9, To: 6, Kind: EdgeReturn, CallSite: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := BuildCFG(disasm.Disassemble(tt.code))
+			var got []Edge
+			for _, b := range g.Blocks {
+				got = append(got, b.Succs...)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("edges = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("edge %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildCFGJumpProblems(t *testing.T) {
+	// 0: CALLVALUE  1: JUMP  2: PUSH1 3  4: JUMP
+	g := BuildCFG(disasm.Disassemble([]byte{0x34, 0x56, 0x60, 0x03, 0x56}))
+	if len(g.Unresolved) != 1 || g.Unresolved[0] != 1 {
+		t.Errorf("Unresolved = %v, want [1]", g.Unresolved)
+	}
+	// 0: PUSH1 3  2: JUMP  3: STOP
+	g = BuildCFG(disasm.Disassemble([]byte{0x60, 0x03, 0x56, 0x00}))
+	if len(g.Invalid) != 1 || g.Invalid[0] != 2 {
+		t.Errorf("Invalid = %v, want [2]", g.Invalid)
+	}
+}
+
+func TestBuildCFGStackFaults(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		want []StackFault
+	}{
+		{
+			name: "balanced",
+			// 0: PUSH1 1  2: PUSH1 2  4: ADD  5: POP  6: STOP
+			code: []byte{0x60, 0x01, 0x60, 0x02, 0x01, 0x50, 0x00},
+		},
+		{
+			name: "underflow",
+			// 0: PUSH1 1  2: ADD
+			code: []byte{0x60, 0x01, 0x01},
+			want: []StackFault{{PC: 2, Opcode: "ADD", Height: 1, Needs: 2}},
+		},
+		{
+			name: "underflow on one path only",
+			// 0: PUSH0  1: CALLVALUE  2: PUSH1 7  4: JUMPI  5: POP  6: POP
+			// 7: JUMPDEST  8: STOP
+			code: []byte{0x5f, 0x34, 0x60, 0x07, 0x57, 0x50, 0x50, 0x5b, 0x00},
+			want: []StackFault{{PC: 6, Opcode: "POP", Height: 0, Needs: 1}},
+		},
+		{
+			name: "loop that grows the stack",
+			// 0: JUMPDEST  1: PUSH0  2: PUSH0  3: JUMP
+			code: []byte{0x5b, 0x5f, 0x5f, 0x56},
+			want: []StackFault{{PC: 0, Opcode: "JUMPDEST", Overflow: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildCFG(disasm.Disassemble(tt.code)).StackFaults
+			if len(got) != len(tt.want) {
+				t.Fatalf("StackFaults = %+v, want %+v", got, tt.want)
+			}
+			for i, f := range got {
+				want := tt.want[i]
+				if f.Overflow {
+					// The height depends on the state budget, not the code.
+					want.Height = f.Height
+				}
+				if f != want {
+					t.Errorf("fault %d = %+v, want %+v", i, f, want)
+				}
+			}
+		})
+	}
+}
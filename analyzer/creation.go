@@ -0,0 +1,110 @@
+package analyzer
+
+import (
+	"encoding/hex"
+
+	"gaslens/disasm"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// CreationCode is creation bytecode split into the init code that runs
+// once, the runtime code it returns, and whatever follows the runtime copy,
+// which is where constructor arguments are appended.
+type CreationCode struct {
+	Init            []byte
+	Runtime         []byte
+	ConstructorArgs []byte
+}
+
+// SplitCreationCode recognises the deployment pattern compilers emit: a
+// CODECOPY of a constant region of the code into memory, followed by a
+// RETURN of exactly that memory. It reports false for runtime code.
+func SplitCreationCode(code []byte) (*CreationCode, bool) {
+	type copied struct{ dst, src, size uint64 }
+	var copies []copied
+	engine := &StackEngine{}
+
+	for _, ins := range disasm.Disassemble(code) {
+		switch ins.Op {
+		case vm.CODECOPY:
+			dst, dstOK := engine.PeekKnown(0)
+			src, srcOK := engine.PeekKnown(1)
+			size, sizeOK := engine.PeekKnown(2)
+			if dstOK && srcOK && sizeOK && size > 0 && src > 0 && src+size <= uint64(len(code)) {
+				copies = append(copies, copied{dst, src, size})
+			}
+
+		case vm.JUMPDEST:
+			// A jump target may be entered with different values.
+			engine.Forget()
+
+		case vm.RETURN:
+			off, offOK := engine.PeekKnown(0)
+			size, sizeOK := engine.PeekKnown(1)
+			for _, c := range copies {
+				if offOK && sizeOK && c.dst == off && c.size == size {
+					return &CreationCode{
+						Init:            code[:c.src],
+						Runtime:         code[c.src : c.src+c.size],
+						ConstructorArgs: code[c.src+c.size:],
+					}, true
+				}
+			}
+		}
+		engine.Step(ins)
+	}
+	return nil, false
+}
+
+// DeploymentCost is the gas of the transaction that deploys creation code:
+// the intrinsic cost of sending the whole creation code as calldata, the
+// init code's own execution and the per-byte deposit for the runtime code.
+type DeploymentCost struct {
+	InitCodeSize        int      `json:"init_code_size"`
+	RuntimeSize         int      `json:"runtime_size"`
+	ConstructorArgsSize int      `json:"constructor_args_size"`
+	ConstructorArgs     string   `json:"constructor_args,omitempty"`
+	IntrinsicGas        uint64   `json:"intrinsic_gas"`
+	InitExecutionGas    uint64   `json:"init_execution_gas"`
+	InitUnbounded       bool     `json:"init_unbounded,omitempty"`
+	CodeDepositGas      uint64   `json:"code_deposit_gas"`
+	FloorGas            uint64   `json:"floor_gas,omitempty"`
+	TotalGas            uint64   `json:"total_gas"`
+	Warnings            []string `json:"warnings,omitempty"`
+}
+
+// deploymentCost prices deploying creation, given the static analysis of
+// its init code.
+func deploymentCost(creation *CreationCode, init *AnalysisReport, schedule *GasSchedule) *DeploymentCost {
+	data := make([]byte, 0, len(creation.Init)+len(creation.Runtime)+len(creation.ConstructorArgs))
+	data = append(append(append(data, creation.Init...), creation.Runtime...), creation.ConstructorArgs...)
+
+	rules := schedule.rules
+	intrinsic, _ := core.IntrinsicGas(data, nil, nil, true, rules.IsHomestead, rules.IsIstanbul, rules.IsShanghai)
+	dc := &DeploymentCost{
+		InitCodeSize:        len(creation.Init),
+		RuntimeSize:         len(creation.Runtime),
+		ConstructorArgsSize: len(creation.ConstructorArgs),
+		ConstructorArgs:     hex.EncodeToString(creation.ConstructorArgs),
+		IntrinsicGas:        intrinsic,
+		InitExecutionGas:    init.TotalGas,
+		InitUnbounded:       len(init.UnboundedOps) > 0,
+		CodeDepositGas:      uint64(len(creation.Runtime)) * params.CreateDataGas,
+	}
+	dc.TotalGas = dc.IntrinsicGas + dc.InitExecutionGas + dc.CodeDepositGas
+	if rules.IsPrague {
+		// EIP-7623: calldata-heavy transactions pay at least the floor.
+		dc.FloorGas, _ = core.FloorDataGas(data)
+		dc.TotalGas = max(dc.TotalGas, dc.FloorGas)
+	}
+
+	if rules.IsEIP158 && len(creation.Runtime) > params.MaxCodeSize {
+		dc.Warnings = append(dc.Warnings, "runtime code exceeds the 24576-byte limit (EIP-170), deployment would fail")
+	}
+	if rules.IsShanghai && len(data) > params.MaxInitCodeSize {
+		dc.Warnings = append(dc.Warnings, "init code exceeds the 49152-byte limit (EIP-3860), deployment would fail")
+	}
+	return dc
+}
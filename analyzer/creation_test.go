@@ -0,0 +1,130 @@
+package analyzer
+
+import (
+	"bytes"
+	"testing"
+)
+
+// constructor is the init code solc emits for a constructor without
+// arguments, copying the 6 bytes of runtime code that follow it.
+//
+//	0: PUSH1 0x80  2: PUSH1 0x40  4: MSTORE  5: CALLVALUE  6: DUP1  7: ISZERO
+//	8: PUSH1 14  10: JUMPI  11: PUSH0  12: DUP1  13: REVERT
+//	14: JUMPDEST  15: POP  16: PUSH1 6  18: DUP1  19: PUSH1 26  21: PUSH0
+//	22: CODECOPY  23: PUSH0  24: RETURN  25: INVALID
+var constructor = []byte{
+	0x60, 0x80, 0x60, 0x40, 0x52, 0x34, 0x80, 0x15, 0x60, 0x0e, 0x57, 0x5f, 0x80, 0xfd,
+	0x5b, 0x50, 0x60, 0x06, 0x80, 0x60, 0x1a, 0x5f, 0x39, 0x5f, 0xf3, 0xfe,
+}
+
+// runtimeCode is PUSH1 1  PUSH1 0  SSTORE  STOP.
+var runtimeCode = []byte{0x60, 0x01, 0x60, 0x00, 0x55, 0x00}
+
+func creationCode(args []byte) []byte {
+	code := append(append([]byte(nil), constructor...), runtimeCode...)
+	return append(code, args...)
+}
+
+func TestSplitCreationCode(t *testing.T) {
+	args := bytes.Repeat([]byte{0}, 31)
+	args = append(args, 0x2a)
+	tests := []struct {
+		name  string
+		code  []byte
+		split bool
+	}{
+		{"constructor with arguments", creationCode(args), true},
+		{"constructor alone", creationCode(nil), true},
+		{"runtime code", runtimeCode, false},
+		// 0: PUSH1 6  2: PUSH1 26  4: PUSH0  5: CODECOPY  6: PUSH1 32  8: PUSH0  9: RETURN
+		{"return of other memory", []byte{0x60, 0x06, 0x60, 0x1a, 0x5f, 0x39, 0x60, 0x20, 0x5f, 0xf3}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := SplitCreationCode(tt.code)
+			if ok != tt.split {
+				t.Fatalf("split = %v, want %v", ok, tt.split)
+			}
+			if !ok {
+				return
+			}
+			if !bytes.Equal(c.Init, constructor) || !bytes.Equal(c.Runtime, runtimeCode) || !bytes.Equal(c.ConstructorArgs, tt.code[len(constructor)+len(runtimeCode):]) {
+				t.Errorf("split into init %x, runtime %x, arguments %x", c.Init, c.Runtime, c.ConstructorArgs)
+			}
+		})
+	}
+}
+
+func TestDeploymentCost(t *testing.T) {
+	// The constructor is 26 nonzero bytes and the runtime code 4 nonzero
+	// and 2 zero bytes.
+	tests := []struct {
+		name      string
+		fork      string
+		args      []byte
+		intrinsic uint64
+		floor     uint64
+		total     uint64
+	}{
+		{
+			name: "cancun",
+			fork: "cancun",
+			args: append(bytes.Repeat([]byte{0}, 31), 0x2a),
+			// 31 nonzero and 33 zero bytes in two init code words
+			intrinsic: 53000 + 31*16 + 33*4 + 2*2,
+			total:     53000 + 31*16 + 33*4 + 2*2 + 1000 + 6*200,
+		},
+		{
+			name: "prague floor on calldata-heavy deployment",
+			fork: "prague",
+			args: bytes.Repeat([]byte{0xff}, 2000),
+			// 2030 nonzero and 2 zero bytes in 64 init code words
+			intrinsic: 53000 + 2030*16 + 2*4 + 64*2,
+			floor:     21000 + 10*(2+4*2030),
+			total:     21000 + 10*(2+4*2030),
+		},
+		{
+			name:      "before shanghai no init code words",
+			fork:      "london",
+			args:      nil,
+			intrinsic: 53000 + 30*16 + 2*4,
+			total:     53000 + 30*16 + 2*4 + 1000 + 6*200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := NewGasSchedule(tt.fork)
+			if err != nil {
+				t.Fatal(err)
+			}
+			creation, ok := SplitCreationCode(creationCode(tt.args))
+			if !ok {
+				t.Fatal("creation code not split")
+			}
+			dc := deploymentCost(creation, &AnalysisReport{TotalGas: 1000}, schedule)
+			if dc.IntrinsicGas != tt.intrinsic || dc.FloorGas != tt.floor || dc.TotalGas != tt.total {
+				t.Errorf("intrinsic %d, floor %d, total %d; want %d, %d, %d",
+					dc.IntrinsicGas, dc.FloorGas, dc.TotalGas, tt.intrinsic, tt.floor, tt.total)
+			}
+			if dc.InitCodeSize != len(constructor) || dc.RuntimeSize != len(runtimeCode) || dc.ConstructorArgsSize != len(tt.args) {
+				t.Errorf("sizes %d, %d, %d; want %d, %d, %d", dc.InitCodeSize, dc.RuntimeSize, dc.ConstructorArgsSize,
+					len(constructor), len(runtimeCode), len(tt.args))
+			}
+			if dc.CodeDepositGas != 6*200 || len(dc.Warnings) != 0 {
+				t.Errorf("deposit %d, warnings %v; want 1200 and none", dc.CodeDepositGas, dc.Warnings)
+			}
+		})
+	}
+}
+
+func TestDeploymentCostWarnings(t *testing.T) {
+	schedule, err := NewGasSchedule("cancun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creation := &CreationCode{Init: constructor, Runtime: make([]byte, 24577), ConstructorArgs: make([]byte, 24576)}
+	dc := deploymentCost(creation, &AnalysisReport{}, schedule)
+	if len(dc.Warnings) != 2 {
+		t.Errorf("warnings = %v, want the EIP-170 and EIP-3860 limits", dc.Warnings)
+	}
+}
@@ -0,0 +1,97 @@
+package analyzer
+
+import (
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Kinds of dead code region.
+const (
+	DeadAfterHalt      = "after_halt"        // code after a halt or JUMP that no jump enters
+	DeadOrphanJumpdest = "orphaned_jumpdest" // a JUMPDEST that no jump targets
+	DeadPadding        = "padding"           // zero or INVALID filler bytes
+)
+
+// DeadCode is the code no execution can reach. It is left out of the
+// opcode counts and gas totals. DeploymentSaving is what removing it would
+// save when deploying: the code deposit, the transaction data and, for
+// creation code, the EIP-3860 init code words it frees. Bytes read with CODECOPY also look
+// unreachable, so check a region is not data before removing it.
+type DeadCode struct {
+	Regions          []DeadRegion `json:"regions"`
+	Bytes            int          `json:"bytes"`
+	Instructions     int          `json:"instructions"`
+	ExcludedGas      uint64       `json:"excluded_gas"`
+	DeploymentSaving uint64       `json:"deployment_saving"`
+}
+
+// DeadRegion is a run of unreachable bytes, from Start to End inclusive.
+type DeadRegion struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Bytes int    `json:"bytes"`
+	Kind  string `json:"kind"`
+}
+
+// deadCode collects the CFG's unreachable blocks into regions of adjacent
+// blocks, and returns them with the set of pcs they cover. It returns nil
+// when every block can run.
+func deadCode(g *CFG, code []byte, schedule *GasSchedule) (*DeadCode, map[int]bool) {
+	blocks := g.Unreachable()
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	dc := &DeadCode{}
+	dead := map[int]bool{}
+	for _, b := range blocks {
+		for _, ins := range b.Instructions {
+			dead[ins.PC] = true
+		}
+		dc.Instructions += len(b.Instructions)
+		n := len(dc.Regions)
+		if n > 0 && dc.Regions[n-1].End+1 == b.Start {
+			dc.Regions[n-1].End = b.End - 1
+			dc.Regions[n-1].Bytes += b.End - b.Start
+			continue
+		}
+		kind := DeadAfterHalt
+		if b.Instructions[0].Op == vm.JUMPDEST {
+			kind = DeadOrphanJumpdest
+		}
+		dc.Regions = append(dc.Regions, DeadRegion{Start: b.Start, End: b.End - 1, Bytes: b.End - b.Start, Kind: kind})
+	}
+
+	nonZero := params.TxDataNonZeroGasFrontier
+	if schedule.IsAtLeast("istanbul") {
+		nonZero = params.TxDataNonZeroGasEIP2028
+	}
+	for i, r := range dc.Regions {
+		padding := true
+		for pc := r.Start; pc <= r.End && pc < len(code); pc++ {
+			switch c := code[pc]; {
+			case c == 0:
+				dc.DeploymentSaving += params.TxDataZeroGas
+			default:
+				dc.DeploymentSaving += nonZero
+				padding = padding && vm.OpCode(c) == vm.INVALID
+			}
+		}
+		if padding {
+			dc.Regions[i].Kind = DeadPadding
+		}
+		dc.Bytes += r.Bytes
+	}
+	dc.DeploymentSaving += uint64(dc.Bytes) * params.CreateDataGas
+	return dc, dead
+}
+
+// addInitCodeSaving adds the EIP-3860 init code words that removing the
+// dead code would free from creation code of initLen bytes. Only the words
+// the whole init code no longer starts are saved.
+func (dc *DeadCode) addInitCodeSaving(initLen int, schedule *GasSchedule) {
+	if dc == nil || !schedule.IsAtLeast("shanghai") {
+		return
+	}
+	words := func(n int) uint64 { return uint64((n + 31) / 32) }
+	dc.DeploymentSaving += (words(initLen) - words(initLen-dc.Bytes)) * params.InitCodeWordGas
+}
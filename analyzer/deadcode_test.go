@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"testing"
+
+	"gaslens/disasm"
+)
+
+func TestDeadCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		fork   string
+		code   []byte
+		bytes  int
+		kind   string
+		saving uint64
+	}{
+		{
+			name: "after a halt",
+			fork: "shanghai",
+			// 0: STOP  1: PUSH1 1  3: STOP
+			code:  []byte{0x00, 0x60, 0x01, 0x00},
+			bytes: 3,
+			kind:  DeadAfterHalt,
+			// two nonzero and one zero calldata bytes, and the deposit
+			saving: 2*16 + 4 + 3*200,
+		},
+		{
+			name:   "before istanbul calldata pricing",
+			fork:   "byzantium",
+			code:   []byte{0x00, 0x60, 0x01, 0x00},
+			bytes:  3,
+			kind:   DeadAfterHalt,
+			saving: 2*68 + 4 + 3*200,
+		},
+		{
+			name: "orphaned jumpdest",
+			fork: "cancun",
+			// 0: STOP  1: JUMPDEST  2: STOP
+			code:   []byte{0x00, 0x5b, 0x00},
+			bytes:  2,
+			kind:   DeadOrphanJumpdest,
+			saving: 16 + 4 + 2*200,
+		},
+		{
+			name:   "invalid padding",
+			fork:   "cancun",
+			code:   []byte{0x00, 0xfe, 0xfe},
+			bytes:  2,
+			kind:   DeadPadding,
+			saving: 2*16 + 2*200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := NewGasSchedule(tt.fork)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dc, _ := deadCode(BuildCFG(disasm.Disassemble(tt.code)), tt.code, schedule)
+			if dc == nil {
+				t.Fatal("no dead code found")
+			}
+			if dc.Bytes != tt.bytes || len(dc.Regions) != 1 || dc.Regions[0].Kind != tt.kind {
+				t.Errorf("dead code = %+v, want %d bytes in one %s region", dc, tt.bytes, tt.kind)
+			}
+			if dc.DeploymentSaving != tt.saving {
+				t.Errorf("deployment saving = %d, want %d", dc.DeploymentSaving, tt.saving)
+			}
+		})
+	}
+}
+
+func TestDeadCodeNone(t *testing.T) {
+	schedule, _ := NewGasSchedule(DefaultFork)
+	code := []byte{0x60, 0x01, 0x00}
+	if dc, _ := deadCode(BuildCFG(disasm.Disassemble(code)), code, schedule); dc != nil {
+		t.Errorf("dead code = %+v, want none", dc)
+	}
+}
+
+func TestDeadCodeInitCodeSaving(t *testing.T) {
+	tests := []struct {
+		fork    string
+		initLen int
+		dead    int
+		want    uint64
+	}{
+		{"shanghai", 1024, 3, 0},
+		{"shanghai", 1025, 3, 2},
+		{"shanghai", 1090, 100, 4 * 2},
+		{"london", 1025, 3, 0},
+	}
+	for _, tt := range tests {
+		schedule, err := NewGasSchedule(tt.fork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dc := &DeadCode{Bytes: tt.dead}
+		dc.addInitCodeSaving(tt.initLen, schedule)
+		if dc.DeploymentSaving != tt.want {
+			t.Errorf("%s: removing %d of %d bytes saves %d, want %d", tt.fork, tt.dead, tt.initLen, dc.DeploymentSaving, tt.want)
+		}
+	}
+}
@@ -0,0 +1,633 @@
+package analyzer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"gaslens/disasm"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// How a function selector was discovered, reported in FunctionInfo.
+const (
+	DiscoveryLinear       = "linear"        // a chain of selector comparisons
+	DiscoveryBinarySearch = "binary-search" // below a GT/LT split on the selector
+	DiscoveryHashBucket   = "hash-bucket"   // behind a selector-indexed jump table
+)
+
+const (
+	// maxDispatchSteps bounds the instructions interpreted while searching
+	// for selectors, so that large fallback functions cannot stall it.
+	maxDispatchSteps = 200000
+	// maxDispatchBuckets is the largest modulus of the selector that is
+	// enumerated as a jump table index.
+	maxDispatchBuckets = 1024
+	// maxDispatchMemory caps the memory offsets that are modelled.
+	maxDispatchMemory = 1 << 16
+)
+
+// DispatchEntry is a selector and the PC execution reaches once the
+// dispatcher has matched the calldata against it.
+type DispatchEntry struct {
+	Selector  string
+	EntryPC   int
+	Discovery string
+}
+
+type dispKind int
+
+const (
+	dispUnknown      dispKind = iota
+	dispConst                 // a known constant
+	dispCalldataWord          // CALLDATALOAD(0)
+	dispSelector              // the 4-byte function selector
+	dispDerived               // arithmetic on the selector, e.g. a bucket index
+	dispMatch                 // selector == value, or != value when negated
+	dispRange                 // an ordering comparison of the selector
+)
+
+// dispValue is a stack value in the dispatcher interpreter.
+type dispValue struct {
+	kind    dispKind
+	value   uint256.Int
+	negated bool
+}
+
+func dispConstant(v *uint256.Int) dispValue {
+	return dispValue{kind: dispConst, value: *v}
+}
+
+func (v dispValue) isSelector() bool {
+	return v.kind == dispSelector || v.kind == dispDerived
+}
+
+// dispState is one path through the dispatcher.
+type dispState struct {
+	pc     int
+	stack  []dispValue
+	mem    *dispMemory
+	split  bool
+	bucket bool
+}
+
+func (s *dispState) clone() *dispState {
+	c := *s
+	c.stack = append([]dispValue(nil), s.stack...)
+	c.mem = s.mem.clone()
+	return &c
+}
+
+func (s *dispState) pop() dispValue {
+	if len(s.stack) == 0 {
+		return dispValue{}
+	}
+	v := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	return v
+}
+
+func (s *dispState) push(v dispValue) {
+	s.stack = append(s.stack, v)
+}
+
+// pad grows the stack with unknowns so that n items can be read.
+func (s *dispState) pad(n int) {
+	for len(s.stack) < n {
+		s.stack = append([]dispValue{{}}, s.stack...)
+	}
+}
+
+func (s *dispState) discovery() string {
+	switch {
+	case s.bucket:
+		return DiscoveryHashBucket
+	case s.split:
+		return DiscoveryBinarySearch
+	}
+	return DiscoveryLinear
+}
+
+// key identifies a state for deduplication.
+func (s *dispState) key() string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d %t %t|", s.pc, s.split, s.bucket)
+	for _, v := range s.stack {
+		fmt.Fprintf(h, "%d:%s:%t,", v.kind, v.value.Hex(), v.negated)
+	}
+	s.mem.hash(h)
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// dispMemory models the bytes of memory the dispatcher writes. Unwritten
+// memory is zero. selector is the offset of a word whose low four bytes
+// were filled with the selector by CALLDATACOPY, or -1.
+type dispMemory struct {
+	known    map[uint64]byte
+	unknown  map[uint64]bool
+	lost     bool
+	selector int64
+}
+
+func newDispMemory() *dispMemory {
+	return &dispMemory{known: map[uint64]byte{}, unknown: map[uint64]bool{}, selector: -1}
+}
+
+func (m *dispMemory) clone() *dispMemory {
+	c := &dispMemory{known: make(map[uint64]byte, len(m.known)), unknown: make(map[uint64]bool, len(m.unknown)), lost: m.lost, selector: m.selector}
+	for k, v := range m.known {
+		c.known[k] = v
+	}
+	for k := range m.unknown {
+		c.unknown[k] = true
+	}
+	return c
+}
+
+func (m *dispMemory) hash(h interface{ Write([]byte) (int, error) }) {
+	offsets := make([]uint64, 0, len(m.known)+len(m.unknown))
+	for k := range m.known {
+		offsets = append(offsets, k)
+	}
+	for k := range m.unknown {
+		offsets = append(offsets, k)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for _, k := range offsets {
+		fmt.Fprintf(h, "%d=%d/%t;", k, m.known[k], m.unknown[k])
+	}
+	fmt.Fprintf(h, "%t %d", m.lost, m.selector)
+}
+
+func (m *dispMemory) write(offset uint64, data []byte) {
+	for i, b := range data {
+		delete(m.unknown, offset+uint64(i))
+		m.known[offset+uint64(i)] = b
+	}
+}
+
+func (m *dispMemory) forget(offset, size uint64) {
+	for i := uint64(0); i < size; i++ {
+		delete(m.known, offset+i)
+		m.unknown[offset+i] = true
+	}
+}
+
+func (m *dispMemory) load(offset uint64) dispValue {
+	if m.lost {
+		return dispValue{}
+	}
+	if int64(offset) == m.selector && m.zero(offset, 28) {
+		return dispValue{kind: dispSelector}
+	}
+	var word [32]byte
+	for i := range word {
+		if m.unknown[offset+uint64(i)] {
+			return dispValue{}
+		}
+		word[i] = m.known[offset+uint64(i)]
+	}
+	return dispConstant(new(uint256.Int).SetBytes(word[:]))
+}
+
+// zero reports whether size bytes at offset are known to be zero.
+func (m *dispMemory) zero(offset, size uint64) bool {
+	for i := uint64(0); i < size; i++ {
+		if m.unknown[offset+i] || m.known[offset+i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FindDispatchEntries interprets the dispatcher at the start of code with
+// the selector kept symbolic. It follows solc's linear chains of
+// selector comparisons and its GT/LT binary-search splits, and enumerates
+// every index of a selector-modulo jump table such as Vyper's hash buckets.
+// Each comparison that matches the selector yields the PC execution
+// continues at when it succeeds. Opcodes not defined in schedule halt.
+func FindDispatchEntries(code []byte, instrs []disasm.Instruction, schedule *GasSchedule) []DispatchEntry {
+	byPC := make(map[int]int, len(instrs))
+	for i, ins := range instrs {
+		byPC[ins.PC] = i
+	}
+	d := &dispatcher{code: code, instrs: instrs, schedule: schedule, byPC: byPC, seen: map[string]bool{}, found: map[DispatchEntry]bool{}}
+	d.enqueue(&dispState{mem: newDispMemory()})
+	for len(d.work) > 0 && d.steps < maxDispatchSteps {
+		s := d.work[len(d.work)-1]
+		d.work = d.work[:len(d.work)-1]
+		d.run(s)
+	}
+
+	entries := make([]DispatchEntry, 0, len(d.found))
+	for e := range d.found {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].EntryPC != entries[j].EntryPC {
+			return entries[i].EntryPC < entries[j].EntryPC
+		}
+		return entries[i].Selector < entries[j].Selector
+	})
+	return entries
+}
+
+type dispatcher struct {
+	code     []byte
+	instrs   []disasm.Instruction
+	schedule *GasSchedule
+	byPC     map[int]int
+	work     []*dispState
+	seen     map[string]bool
+	found    map[DispatchEntry]bool
+	steps    int
+}
+
+func (d *dispatcher) enqueue(s *dispState) {
+	if _, ok := d.byPC[s.pc]; !ok {
+		return
+	}
+	key := s.key()
+	if d.seen[key] {
+		return
+	}
+	d.seen[key] = true
+	d.work = append(d.work, s)
+}
+
+// jumpTarget returns the PC of v if it is a valid JUMPDEST.
+func (d *dispatcher) jumpTarget(v dispValue) (int, bool) {
+	if v.kind != dispConst || !v.value.IsUint64() {
+		return 0, false
+	}
+	i, ok := d.byPC[int(v.value.Uint64())]
+	if !ok || d.instrs[i].Op != vm.JUMPDEST {
+		return 0, false
+	}
+	return d.instrs[i].PC, true
+}
+
+func (d *dispatcher) record(s *dispState, selector uint256.Int, pc int) {
+	d.found[DispatchEntry{
+		Selector:  fmt.Sprintf("0x%08x", selector.Uint64()),
+		EntryPC:   pc,
+		Discovery: s.discovery(),
+	}] = true
+}
+
+// run interprets s until it jumps, forks or halts.
+func (d *dispatcher) run(s *dispState) {
+	for i := d.byPC[s.pc]; i < len(d.instrs); i++ {
+		d.steps++
+		ins := d.instrs[i]
+		next := ins.PC + ins.Size
+		if len(s.stack) > 1024 || d.steps >= maxDispatchSteps {
+			return
+		}
+
+		switch op := ins.Op; {
+		case op == vm.PUSH0 || (op >= vm.PUSH1 && op <= vm.PUSH32):
+			imm := make([]byte, disasm.ImmediateSize(op))
+			copy(imm, ins.Immediate)
+			s.push(dispConstant(new(uint256.Int).SetBytes(imm)))
+
+		case op >= vm.DUP1 && op <= vm.DUP16:
+			n := int(op-vm.DUP1) + 1
+			s.pad(n)
+			s.push(s.stack[len(s.stack)-n])
+
+		case op >= vm.SWAP1 && op <= vm.SWAP16:
+			n := int(op-vm.SWAP1) + 1
+			s.pad(n + 1)
+			top := len(s.stack) - 1
+			s.stack[top], s.stack[top-n] = s.stack[top-n], s.stack[top]
+
+		case op == vm.JUMPDEST:
+
+		case op == vm.JUMP:
+			if pc, ok := d.jumpTarget(s.pop()); ok {
+				s.pc = pc
+				d.enqueue(s)
+			}
+			return
+
+		case op == vm.JUMPI:
+			d.branch(s, next)
+			return
+
+		case op == vm.MOD:
+			s.pad(2)
+			x, n := s.stack[len(s.stack)-1], s.stack[len(s.stack)-2]
+			if x.isSelector() && n.kind == dispConst && !n.value.IsZero() && n.value.CmpUint64(maxDispatchBuckets) <= 0 {
+				s.stack = s.stack[:len(s.stack)-2]
+				for r := uint64(0); r < n.value.Uint64(); r++ {
+					fork := s.clone()
+					fork.push(dispConstant(uint256.NewInt(r)))
+					fork.pc, fork.bucket = next, true
+					d.enqueue(fork)
+				}
+				return
+			}
+			s.stack = s.stack[:len(s.stack)-2]
+			s.push(dispBinary(op, x, n))
+
+		case op == vm.ISZERO || op == vm.NOT:
+			s.push(dispUnary(op, s.pop()))
+
+		case op == vm.CALLDATALOAD:
+			if off := s.pop(); off.kind == dispConst && off.value.IsZero() {
+				s.push(dispValue{kind: dispCalldataWord})
+			} else {
+				s.push(dispValue{})
+			}
+
+		case op == vm.CALLDATACOPY || op == vm.CODECOPY:
+			d.copy(s, op)
+
+		case op == vm.MLOAD:
+			if off, ok := dispOffset(s.pop()); ok {
+				s.push(s.mem.load(off))
+			} else {
+				s.push(dispValue{})
+			}
+
+		case op == vm.MSTORE || op == vm.MSTORE8:
+			off, offOK := dispOffset(s.pop())
+			v := s.pop()
+			size := uint64(32)
+			if op == vm.MSTORE8 {
+				size = 1
+			}
+			switch {
+			case !offOK:
+				s.mem.lost = true
+			case v.kind == dispConst:
+				word := v.value.Bytes32()
+				s.mem.write(off, word[32-size:])
+			default:
+				s.mem.forget(off, size)
+			}
+
+		case op == vm.PC:
+			s.push(dispConstant(uint256.NewInt(uint64(ins.PC))))
+
+		case op == vm.CODESIZE:
+			s.push(dispConstant(uint256.NewInt(uint64(len(d.code)))))
+
+		case disasm.IsTerminator(op) || !d.schedule.IsDefined(op):
+			return
+
+		default:
+			pops, pushes := StackArity(op)
+			if pops == 2 && pushes == 1 {
+				s.pad(2)
+				a, b := s.pop(), s.pop()
+				s.push(dispBinary(op, a, b))
+				continue
+			}
+			s.pad(pops)
+			s.stack = s.stack[:len(s.stack)-pops]
+			for j := 0; j < pushes; j++ {
+				s.push(dispValue{})
+			}
+		}
+	}
+}
+
+// branch handles a JUMPI. A selector match records the entry on the taken
+// side and continues only on the other one.
+func (d *dispatcher) branch(s *dispState, next int) {
+	s.pad(2)
+	destValue, cond := s.pop(), s.pop()
+	dest, destOK := d.jumpTarget(destValue)
+
+	switch cond.kind {
+	case dispConst:
+		if cond.value.IsZero() {
+			s.pc = next
+			d.enqueue(s)
+		} else if destOK {
+			s.pc = dest
+			d.enqueue(s)
+		}
+		return
+
+	case dispMatch:
+		if cond.negated {
+			d.record(s, cond.value, next)
+			if destOK {
+				s.pc = dest
+				d.enqueue(s)
+			}
+		} else {
+			if destOK {
+				d.record(s, cond.value, dest)
+			}
+			s.pc = next
+			d.enqueue(s)
+		}
+		return
+
+	case dispRange:
+		s.split = true
+	}
+
+	if destOK {
+		taken := s.clone()
+		taken.pc = dest
+		d.enqueue(taken)
+	}
+	s.pc = next
+	d.enqueue(s)
+}
+
+// copy applies CALLDATACOPY or CODECOPY to the memory model.
+func (d *dispatcher) copy(s *dispState, op vm.OpCode) {
+	s.pad(3)
+	dstValue, srcValue, sizeValue := s.pop(), s.pop(), s.pop()
+	dst, dstOK := dispOffset(dstValue)
+	size, sizeOK := dispOffset(sizeValue)
+	if !dstOK || !sizeOK {
+		s.mem.lost = true
+		return
+	}
+	src, srcOK := dispOffset(srcValue)
+	if op == vm.CALLDATACOPY {
+		s.mem.forget(dst, size)
+		if srcOK && src == 0 && size == 4 && dst >= 28 {
+			s.mem.selector = int64(dst - 28)
+		}
+		return
+	}
+	if !srcOK {
+		s.mem.forget(dst, size)
+		return
+	}
+	data := make([]byte, size)
+	if src < uint64(len(d.code)) {
+		copy(data, d.code[src:])
+	}
+	s.mem.write(dst, data)
+}
+
+// dispOffset returns v as a memory offset or size small enough to model.
+func dispOffset(v dispValue) (uint64, bool) {
+	if v.kind != dispConst || !v.value.IsUint64() || v.value.Uint64() > maxDispatchMemory {
+		return 0, false
+	}
+	return v.value.Uint64(), true
+}
+
+var selectorShift = uint256.NewInt(224)
+var selectorDivisor = new(uint256.Int).Lsh(uint256.NewInt(1), 224)
+var selectorMask = uint256.NewInt(0xffffffff)
+
+func dispUnary(op vm.OpCode, a dispValue) dispValue {
+	switch {
+	case a.kind == dispConst && op == vm.ISZERO:
+		if a.value.IsZero() {
+			return dispConstant(uint256.NewInt(1))
+		}
+		return dispConstant(new(uint256.Int))
+	case a.kind == dispConst && op == vm.NOT:
+		return dispConstant(new(uint256.Int).Not(&a.value))
+	case op != vm.ISZERO:
+		return dispValue{}
+	case a.kind == dispMatch:
+		a.negated = !a.negated
+		return a
+	case a.kind == dispSelector:
+		return dispValue{kind: dispMatch}
+	case a.kind == dispRange:
+		return a
+	}
+	return dispValue{}
+}
+
+// dispBinary applies a two-operand instruction; a is the top of the stack.
+func dispBinary(op vm.OpCode, a, b dispValue) dispValue {
+	if a.kind == dispConst && b.kind == dispConst {
+		if v, ok := evalBinary(op, &a.value, &b.value); ok {
+			return dispConstant(v)
+		}
+		return dispValue{}
+	}
+
+	// Extracting the selector from the first calldata word.
+	switch {
+	case op == vm.SHR && a.kind == dispConst && a.value.Eq(selectorShift) && b.kind == dispCalldataWord,
+		op == vm.DIV && a.kind == dispCalldataWord && b.kind == dispConst && b.value.Eq(selectorDivisor),
+		op == vm.AND && a.kind == dispSelector && b.kind == dispConst && b.value.Eq(selectorMask),
+		op == vm.AND && b.kind == dispSelector && a.kind == dispConst && a.value.Eq(selectorMask):
+		return dispValue{kind: dispSelector}
+	}
+
+	// A match that must hold for the whole condition to go one way.
+	if op == vm.AND && (a.kind == dispMatch && !a.negated || b.kind == dispMatch && !b.negated) {
+		if a.kind == dispMatch && !a.negated {
+			return a
+		}
+		return b
+	}
+	if op == vm.OR && (a.kind == dispMatch && a.negated || b.kind == dispMatch && b.negated) {
+		if a.kind == dispMatch && a.negated {
+			return a
+		}
+		return b
+	}
+
+	sel, c, ok := selectorOperand(a, b)
+	if !ok {
+		return dispValue{}
+	}
+	switch op {
+	case vm.EQ, vm.XOR, vm.SUB:
+		if sel.kind == dispSelector && c.value.CmpUint64(0xffffffff) <= 0 {
+			return dispValue{kind: dispMatch, value: c.value, negated: op != vm.EQ}
+		}
+	case vm.LT, vm.GT, vm.SLT, vm.SGT:
+		return dispValue{kind: dispRange}
+	}
+	return dispValue{kind: dispDerived}
+}
+
+// selectorOperand returns the selector-derived and constant operands of a
+// binary instruction, in that order.
+func selectorOperand(a, b dispValue) (sel, c dispValue, ok bool) {
+	switch {
+	case a.isSelector() && b.kind == dispConst:
+		return a, b, true
+	case b.isSelector() && a.kind == dispConst:
+		return b, a, true
+	}
+	return sel, c, false
+}
+
+// evalBinary computes a two-operand instruction on constants.
+func evalBinary(op vm.OpCode, a, b *uint256.Int) (*uint256.Int, bool) {
+	z := new(uint256.Int)
+	bool256 := func(v bool) *uint256.Int {
+		if v {
+			return z.SetOne()
+		}
+		return z.Clear()
+	}
+	switch op {
+	case vm.ADD:
+		return z.Add(a, b), true
+	case vm.SUB:
+		return z.Sub(a, b), true
+	case vm.MUL:
+		return z.Mul(a, b), true
+	case vm.DIV:
+		return z.Div(a, b), true
+	case vm.SDIV:
+		return z.SDiv(a, b), true
+	case vm.MOD:
+		return z.Mod(a, b), true
+	case vm.SMOD:
+		return z.SMod(a, b), true
+	case vm.EXP:
+		return z.Exp(a, b), true
+	case vm.SIGNEXTEND:
+		return z.ExtendSign(b, a), true
+	case vm.LT:
+		return bool256(a.Lt(b)), true
+	case vm.GT:
+		return bool256(a.Gt(b)), true
+	case vm.SLT:
+		return bool256(a.Slt(b)), true
+	case vm.SGT:
+		return bool256(a.Sgt(b)), true
+	case vm.EQ:
+		return bool256(a.Eq(b)), true
+	case vm.AND:
+		return z.And(a, b), true
+	case vm.OR:
+		return z.Or(a, b), true
+	case vm.XOR:
+		return z.Xor(a, b), true
+	case vm.BYTE:
+		return z.Set(b).Byte(a), true
+	case vm.SHL:
+		if a.LtUint64(256) {
+			return z.Lsh(b, uint(a.Uint64())), true
+		}
+		return z, true
+	case vm.SHR:
+		if a.LtUint64(256) {
+			return z.Rsh(b, uint(a.Uint64())), true
+		}
+		return z, true
+	case vm.SAR:
+		if a.LtUint64(256) {
+			return z.SRsh(b, uint(a.Uint64())), true
+		}
+		if b.Sign() < 0 {
+			return z.SetAllOne(), true
+		}
+		return z, true
+	}
+	return nil, false
+}
@@ -0,0 +1,68 @@
+package analyzer
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"gaslens/disasm"
+)
+
+func TestFindDispatchEntries(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []DispatchEntry
+	}{
+		{
+			name: "linear chain",
+			// 0: PUSH0 CALLDATALOAD PUSH1 0xe0 SHR
+			// 5: DUP1 PUSH4 0xaabbccdd EQ PUSH1 28 JUMPI
+			// 15: DUP1 PUSH4 0x11223344 EQ PUSH1 30 JUMPI
+			// 25: PUSH0 DUP1 REVERT  28: JUMPDEST STOP  30: JUMPDEST STOP
+			code: "5f3560e01c" + "8063aabbccdd14601c57" + "806311223344146" + "01e57" + "5f80fd" + "5b00" + "5b00",
+			want: []DispatchEntry{
+				{Selector: "0xaabbccdd", EntryPC: 28, Discovery: "linear"},
+				{Selector: "0x11223344", EntryPC: 30, Discovery: "linear"},
+			},
+		},
+		{
+			name: "binary search split",
+			// 0: PUSH0 CALLDATALOAD PUSH1 0xe0 SHR
+			// 5: DUP1 PUSH4 0x50000000 GT PUSH1 28 JUMPI
+			// 15: DUP1 PUSH4 0x60000000 EQ PUSH1 42 JUMPI  25: PUSH0 DUP1 REVERT
+			// 28: JUMPDEST DUP1 PUSH4 0x10000000 EQ PUSH1 44 JUMPI  39: PUSH0 DUP1 REVERT
+			// 42: JUMPDEST STOP  44: JUMPDEST STOP
+			code: "5f3560e01c" + "80635000000011601c57" + "8063600000001460" + "2a57" + "5f80fd" +
+				"5b8063100000001460" + "2c57" + "5f80fd" + "5b00" + "5b00",
+			want: []DispatchEntry{
+				{Selector: "0x60000000", EntryPC: 42, Discovery: "binary-search"},
+				{Selector: "0x10000000", EntryPC: 44, Discovery: "binary-search"},
+			},
+		},
+		{
+			name: "no dispatcher",
+			code: "6001600055",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := hex.DecodeString(tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			schedule, err := NewGasSchedule(DefaultFork)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := FindDispatchEntries(code, disasm.Disassemble(code), schedule)
+			if len(got) != len(tt.want) {
+				t.Fatalf("entries = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gaslens/disasm"
+	"gaslens/eof"
+	"gaslens/metadata"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// eofGas is the static gas of the opcodes EOF introduces. No fork in
+// go-ethereum enables EOF yet, so these come from the EIPs.
+var eofGas = map[vm.OpCode]uint64{
+	vm.DATALOAD:        4,
+	vm.DATALOADN:       3,
+	vm.DATASIZE:        2,
+	vm.DATACOPY:        3,
+	vm.RJUMP:           2,
+	vm.RJUMPI:          4,
+	vm.RJUMPV:          4,
+	vm.CALLF:           5,
+	vm.RETF:            3,
+	vm.JUMPF:           5,
+	vm.DUPN:            3,
+	vm.SWAPN:           3,
+	vm.EXCHANGE:        3,
+	vm.EOFCREATE:       32000,
+	vm.RETURNCONTRACT:  0,
+	vm.RETURNDATALOAD:  3,
+	vm.EXTCALL:         100,
+	vm.EXTDELEGATECALL: 100,
+	vm.EXTSTATICCALL:   100,
+}
+
+// eofDynamic are the EOF opcodes with memory or account access costs.
+var eofDynamic = []vm.OpCode{
+	vm.DATACOPY, vm.EOFCREATE, vm.RETURNCONTRACT, vm.EXTCALL, vm.EXTDELEGATECALL, vm.EXTSTATICCALL,
+}
+
+// withEOF returns a copy of the schedule for pricing EOF code: the opcodes
+// EOF removes are undefined and the ones it adds are priced.
+func (gs *GasSchedule) withEOF() *GasSchedule {
+	s := *gs
+	s.eof = true
+	for i := range s.defined {
+		s.defined[i] = s.defined[i] && eof.IsValid(vm.OpCode(i))
+	}
+	for op, gas := range eofGas {
+		s.defined[op] = true
+		s.constant[op] = gas
+	}
+	for _, op := range eofDynamic {
+		s.dynamic[op] = true
+	}
+	return &s
+}
+
+// EOFReport describes an EOF container and the estimate for each of its
+// code sections.
+type EOFReport struct {
+	Version      int              `json:"version"`
+	CodeSections []EOFCodeSection `json:"code_sections"`
+	Containers   int              `json:"containers"`
+	DataSize     int              `json:"data_size"`
+}
+
+// EOFCodeSection is one function of an EOF container. Offset is where the
+// section starts in the container; trace PCs are container offsets too.
+type EOFCodeSection struct {
+	Index          int    `json:"index"`
+	Offset         int    `json:"offset"`
+	Size           int    `json:"size"`
+	Inputs         int    `json:"inputs"`
+	Outputs        int    `json:"outputs"`
+	NonReturning   bool   `json:"non_returning,omitempty"`
+	MaxStackHeight int    `json:"max_stack_height"`
+	Gas            uint64 `json:"gas"`
+	Unbounded      bool   `json:"unbounded,omitempty"`
+	Calls          []int  `json:"calls,omitempty"`
+}
+
+// Label describes the section's signature, e.g. "section 1 (2 → 1)".
+func (s EOFCodeSection) Label() string {
+	if s.NonReturning {
+		return fmt.Sprintf("section %d (%d → non-returning)", s.Index, s.Inputs)
+	}
+	return fmt.Sprintf("section %d (%d → %d)", s.Index, s.Inputs, s.Outputs)
+}
+
+// analyzeEOF validates an EOF container and prices each of its code
+// sections. Only the top-level container is priced; nested containers are
+// validated and counted.
+func analyzeEOF(code []byte, schedule *GasSchedule) (*analysis, error) {
+	c, err := eof.Parse(code)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EOF container: %w", err)
+	}
+	schedule = schedule.withEOF()
+	a := newAnalysis()
+	p := newPricer(a, schedule)
+
+	sections := make([][]disasm.Instruction, len(c.Code))
+	for i, section := range c.Code {
+		instrs := disasm.DisassembleEOF(section)
+		for j := range instrs {
+			instrs[j].PC += c.CodeOffsets[i]
+		}
+		sections[i] = instrs
+	}
+	a.cfg = buildEOFCFG(c, sections)
+
+	report := &EOFReport{Version: c.Version, Containers: len(c.Containers), DataSize: c.DataSize}
+	for i, instrs := range sections {
+		typ := c.Types[i]
+		sec := EOFCodeSection{
+			Index:          i,
+			Offset:         c.CodeOffsets[i],
+			Size:           len(c.Code[i]),
+			Inputs:         typ.Inputs,
+			Outputs:        typ.Outputs,
+			NonReturning:   typ.Outputs == eof.NonReturning,
+			MaxStackHeight: typ.MaxStackHeight,
+		}
+		if sec.NonReturning {
+			sec.Outputs = 0
+		}
+		engine := &StackEngine{}
+		for n := 0; n < typ.Inputs; n++ {
+			engine.PushUnknown()
+		}
+		unbounded := len(p.unbounded)
+		for _, ins := range instrs {
+			if isJumpTarget(a.cfg.Block(ins.PC)) {
+				// A jump target may be entered with different values.
+				engine.Forget()
+			}
+			sec.Gas += p.price(ins, engine)
+			stepEOF(engine, ins, c)
+			if ins.Op == vm.CALLF || ins.Op == vm.JUMPF {
+				sec.Calls = append(sec.Calls, int(binary.BigEndian.Uint16(ins.Immediate)))
+			}
+		}
+		sec.Unbounded = len(p.unbounded) > unbounded
+		report.CodeSections = append(report.CodeSections, sec)
+	}
+
+	a.loopTracker.FromCFG(a.cfg, p.gasByPC)
+	a.report = p.report()
+	a.report.EOF = report
+	// solc appends its metadata to the data section of EOF contracts.
+	if _, md := metadata.Split(c.Data); md != nil {
+		a.report.Metadata = md
+	}
+	a.finishReport()
+	return a, nil
+}
+
+// stepEOF applies an EOF instruction to the engine. Opcodes EOF shares
+// with legacy code are left to the engine.
+func stepEOF(engine *StackEngine, ins disasm.Instruction, c *eof.Container) {
+	op := ins.Op
+	switch {
+	case op == vm.DUPN:
+		engine.Dup(int(ins.Immediate[0]) + 1)
+	case op == vm.SWAPN:
+		engine.Swap(int(ins.Immediate[0]) + 1)
+	case op == vm.EXCHANGE:
+		n, m := int(ins.Immediate[0]>>4)+1, int(ins.Immediate[0]&0x0f)+1
+		engine.Exchange(n, n+m)
+	case op == vm.DATALOADN:
+		off := int(binary.BigEndian.Uint16(ins.Immediate))
+		word := make([]byte, 32)
+		if off < len(c.Data) {
+			copy(word, c.Data[off:])
+		}
+		engine.Push(Const(new(uint256.Int).SetBytes(word)))
+	case op == vm.CALLF:
+		t := c.Types[binary.BigEndian.Uint16(ins.Immediate)]
+		popPush(engine, t.Inputs, t.Outputs)
+	case op == vm.RETF || op == vm.JUMPF:
+		// The section ends here.
+	case eof.IsValid(op) && !isLegacy(op):
+		engine.clobberWrites(op)
+		pops, pushes := eof.StackArity(op, ins.Immediate)
+		popPush(engine, pops, pushes)
+	default:
+		engine.Step(ins)
+	}
+}
+
+func popPush(engine *StackEngine, pops, pushes int) {
+	for i := 0; i < pops; i++ {
+		engine.Pop()
+	}
+	for i := 0; i < pushes; i++ {
+		engine.PushUnknown()
+	}
+}
+
+// isLegacy reports whether op is defined outside EOF too.
+func isLegacy(op vm.OpCode) bool {
+	_, ok := eofGas[op]
+	return !ok
+}
+
+func isJumpTarget(b *Block) bool {
+	if b == nil {
+		return false
+	}
+	for _, e := range b.Preds {
+		if e.Kind == EdgeJump {
+			return true
+		}
+	}
+	return false
+}
+
+// buildEOFCFG connects the basic blocks of every code section. Relative
+// jumps have constant targets, so no stack propagation is needed; CALLF
+// and JUMPF add an edge into the section they enter.
+func buildEOFCFG(c *eof.Container, sections [][]disasm.Instruction) *CFG {
+	g := &CFG{
+		JumpDests: make(map[int]bool),
+		byStart:   make(map[int]*Block),
+	}
+	for _, instrs := range sections {
+		for _, bb := range disasm.SplitEOFBlocks(instrs) {
+			b := &Block{BasicBlock: bb}
+			g.Blocks = append(g.Blocks, b)
+			g.byStart[b.Start] = b
+		}
+	}
+
+	for _, b := range g.Blocks {
+		last := b.Last()
+		add := func(to int, kind EdgeKind) {
+			e := Edge{From: b.Start, To: to, Kind: kind}
+			for _, s := range b.Succs {
+				if s == e {
+					return
+				}
+			}
+			b.Succs = append(b.Succs, e)
+			g.byStart[to].Preds = append(g.byStart[to].Preds, e)
+		}
+		for _, t := range last.RelativeTargets() {
+			add(t, EdgeJump)
+		}
+		switch last.Op {
+		case vm.JUMPF:
+			add(c.CodeOffsets[binary.BigEndian.Uint16(last.Immediate)], EdgeCall)
+		case vm.RJUMP, vm.RETF, vm.RETURNCONTRACT, vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID:
+		default:
+			if g.byStart[b.End] != nil {
+				add(b.End, EdgeFallthrough)
+			}
+		}
+		for _, ins := range b.Instructions {
+			if ins.Op == vm.CALLF {
+				add(c.CodeOffsets[binary.BigEndian.Uint16(ins.Immediate)], EdgeCall)
+			}
+		}
+	}
+	for _, b := range g.ReachableFrom(c.CodeOffsets[0]) {
+		b.Reachable = true
+	}
+	for _, b := range g.Blocks {
+		sortEdges(b.Succs)
+		sortEdges(b.Preds)
+	}
+	return g
+}
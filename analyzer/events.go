@@ -0,0 +1,38 @@
+package analyzer
+
+import (
+	"strings"
+
+	"gaslens/signatures"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// EventInfo is a known event topic pushed by the contract, usually just
+// before the LOG that emits it.
+type EventInfo struct {
+	Topic      string   `json:"topic"`
+	Signatures []string `json:"signatures"`
+	PC         int      `json:"pc"`
+}
+
+// Label returns the event's candidate signatures.
+func (e EventInfo) Label() string {
+	return strings.Join(e.Signatures, " | ")
+}
+
+// findEvents returns every reachable PUSH32 in trace whose value is a topic
+// in db.
+func findEvents(trace []traceEntry, db *signatures.DB) []EventInfo {
+	var events []EventInfo
+	for _, t := range trace {
+		if t.dead || t.ins.Op != vm.PUSH32 || t.ins.Truncated() {
+			continue
+		}
+		topic := hexutil.Encode(t.ins.Immediate)
+		if sigs := db.Event(topic); len(sigs) > 0 {
+			events = append(events, EventInfo{Topic: topic, Signatures: sigs, PC: t.ins.PC})
+		}
+	}
+	return events
+}
@@ -0,0 +1,394 @@
+package analyzer
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"gaslens/disasm"
+	"gaslens/layout"
+	"gaslens/signatures"
+	"gaslens/srcmap"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+)
+
+// DefaultExecGasLimit is the gas given to a call when none is requested. It
+// matches a typical mainnet block gas limit, since a failing call consumes
+// all of it.
+const DefaultExecGasLimit = 30_000_000
+
+// ExecOptions describes the call made by ExecuteBytecode.
+type ExecOptions struct {
+	Detailed   bool
+	Schedule   *GasSchedule
+	Signatures *signatures.DB
+	Layout     *layout.Layout
+	SourceMap  *srcmap.Map
+	Calldata   []byte
+	Value      *big.Int
+	Caller     common.Address
+	GasLimit   uint64 // 0 means DefaultExecGasLimit
+}
+
+// ExecutionResult compares the gas a real call paid with the static estimate.
+type ExecutionResult struct {
+	GasUsed        uint64 `json:"gas_used"`
+	IntrinsicGas   uint64 `json:"intrinsic_gas"`
+	Refund         uint64 `json:"refund"`
+	TransactionGas uint64 `json:"transaction_gas"`
+	StaticEstimate uint64 `json:"static_estimate"`
+	Reverted       bool   `json:"reverted"`
+	Error          string `json:"error,omitempty"`
+	ReturnData     string `json:"return_data"`
+}
+
+// ExecuteBytecode deploys code into an in-memory state, running its
+// constructor first when it is creation code, calls it, and prints a
+// report built from the opcodes that actually ran.
+func ExecuteBytecode(code []byte, opts ExecOptions) error {
+	static, err := analyze(code, opts.Schedule)
+	if err != nil {
+		return err
+	}
+	a, err := execute(code, static, opts)
+	if err != nil {
+		return err
+	}
+	a.name(opts.Signatures)
+	a.applyLayout(opts.Layout)
+	if opts.SourceMap != nil {
+		a.applyPositions(static.sourcePositions(opts.SourceMap), opts.SourceMap)
+	}
+	a.print(Options{Detailed: opts.Detailed, Schedule: opts.Schedule})
+	a.export("")
+	return nil
+}
+
+// execute runs one call and returns the analysis of the executed opcodes.
+// static is the static analysis of the same code, used for its CFG,
+// function entry points and estimate.
+func execute(code []byte, static *analysis, opts ExecOptions) (*analysis, error) {
+	schedule := opts.Schedule
+	if static.report.EOF != nil {
+		return nil, errors.New("EOF containers cannot be executed: no fork supported by the local EVM enables EOF")
+	}
+
+	a := &analysis{
+		opcodeCount:     map[vm.OpCode]int{},
+		opcodeGas:       map[vm.OpCode]uint64{},
+		storage:         NewStorageTracker(),
+		loopTracker:     NewLoopTracker(),
+		functionTracker: NewFunctionTracker(),
+		cfg:             static.cfg,
+	}
+	// Iterations are counted against the loops found statically.
+	a.loopTracker.Loops = append(a.loopTracker.Loops, static.loopTracker.Loops...)
+	tracer := &executionTracer{a: a, schedule: schedule, instrs: map[int]disasm.Instruction{}, preimages: map[uint256.Int]Value{}}
+
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(triedb.NewDatabase(rawdb.NewMemoryDatabase(), nil), nil))
+	if err != nil {
+		return nil, err
+	}
+	value := opts.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	if value.Sign() > 0 {
+		v, overflow := uint256.FromBig(value)
+		if overflow {
+			return nil, errors.New("call value does not fit in 256 bits")
+		}
+		statedb.AddBalance(opts.Caller, v, tracing.BalanceChangeUnspecified)
+	}
+	gasLimit := opts.GasLimit
+	if gasLimit == 0 {
+		gasLimit = DefaultExecGasLimit
+	}
+
+	cfg := &runtime.Config{
+		ChainConfig: schedule.ChainConfig(),
+		Origin:      opts.Caller,
+		Value:       value,
+		GasLimit:    gasLimit,
+		State:       statedb,
+	}
+
+	var (
+		ret     []byte
+		execErr error
+	)
+	if _, ok := SplitCreationCode(code); ok {
+		// Run the constructor untraced, then call what it deployed.
+		deployed, address, _, err := runtime.Create(code, &runtime.Config{
+			ChainConfig: cfg.ChainConfig,
+			Origin:      cfg.Origin,
+			GasLimit:    gasLimit,
+			State:       statedb,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("deploying creation code: %w", err)
+		}
+		statedb.Finalise(true)
+		tracer.index(deployed)
+		cfg.EVMConfig = vm.Config{Tracer: tracer.hooks()}
+		ret, _, execErr = runtime.Call(address, opts.Calldata, cfg)
+	} else {
+		tracer.index(code)
+		cfg.EVMConfig = vm.Config{Tracer: tracer.hooks()}
+		ret, _, execErr = runtime.Execute(code, opts.Calldata, cfg)
+	}
+	tracer.flush(nil)
+
+	rules := schedule.rules
+	intrinsic, err := core.IntrinsicGas(opts.Calldata, nil, nil, false, rules.IsHomestead, rules.IsIstanbul, rules.IsShanghai)
+	if err != nil {
+		return nil, err
+	}
+	quotient := params.RefundQuotient
+	if rules.IsLondon {
+		quotient = params.RefundQuotientEIP3529
+	}
+	refund := min(statedb.GetRefund(), (intrinsic+tracer.gasUsed)/quotient)
+
+	result := &ExecutionResult{
+		GasUsed:        tracer.gasUsed,
+		IntrinsicGas:   intrinsic,
+		Refund:         refund,
+		TransactionGas: intrinsic + tracer.gasUsed - refund,
+		StaticEstimate: static.report.TotalGas,
+		Reverted:       execErr != nil,
+		ReturnData:     "0x" + hex.EncodeToString(ret),
+	}
+	if execErr != nil {
+		result.Error = execErr.Error()
+	}
+
+	if len(opts.Calldata) >= 4 {
+		selector := fmt.Sprintf("0x%x", opts.Calldata[:4])
+		fn := FunctionInfo{Selector: selector, EntryPC: -1}
+		for _, f := range static.functionTracker.Functions {
+			if f.Selector == selector {
+				fn = f
+			}
+		}
+		fn.Gas = tracer.gasUsed
+		a.functionTracker.Functions = append(a.functionTracker.Functions, fn)
+	}
+
+	a.report = &AnalysisReport{
+		Fork:          schedule.Fork,
+		TotalGas:      tracer.gasUsed,
+		StorageGas:    a.storage.Gas,
+		AccountAccess: a.storage.Accounts,
+		MemoryBytes:   tracer.memoryBytes,
+		Metadata:      static.report.Metadata,
+		Deployment:    static.report.Deployment,
+		DeadCode:      static.report.DeadCode,
+		Execution:     result,
+	}
+	a.report.StorageGas.Refund = int64(statedb.GetRefund())
+	a.finishReport()
+	return a, nil
+}
+
+// executionTracer feeds the opcodes executed by the contract itself (call
+// depth 1) into an analysis.
+type executionTracer struct {
+	a           *analysis
+	schedule    *GasSchedule
+	instrs      map[int]disasm.Instruction
+	pending     *executedStep
+	gasUsed     uint64
+	memoryBytes uint64
+	sstoreRun   int
+	// preimages names the hashes that derive storage slots, so that
+	// executed accesses are labelled like static ones.
+	preimages map[uint256.Int]Value
+}
+
+type executedStep struct {
+	pc   int
+	op   vm.OpCode
+	gas  uint64
+	cost uint64
+}
+
+// index records the instructions of the code being traced by PC.
+func (t *executionTracer) index(code []byte) {
+	for _, ins := range disasm.Disassemble(code) {
+		t.instrs[ins.PC] = ins
+	}
+}
+
+func (t *executionTracer) hooks() *tracing.Hooks {
+	return &tracing.Hooks{
+		OnOpcode: t.onOpcode,
+		OnTxEnd: func(receipt *types.Receipt, err error) {
+			if receipt != nil {
+				t.gasUsed = receipt.GasUsed
+			}
+		},
+	}
+}
+
+func (t *executionTracer) onOpcode(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, rData []byte, depth int, err error) {
+	if depth != 1 {
+		return
+	}
+	step := &executedStep{pc: int(pc), op: vm.OpCode(op), gas: gas, cost: cost}
+	t.flush(step)
+	t.pending = step
+
+	if size := uint64(len(scope.MemoryData())); size > t.memoryBytes {
+		t.memoryBytes = size
+	}
+	stack := scope.StackData()
+	peek := func(n int) Value {
+		if n >= len(stack) {
+			return Unknown()
+		}
+		return Const(&stack[len(stack)-1-n])
+	}
+	switch step.op {
+	case vm.KECCAK256:
+		t.recordPreimage(step.pc, peek(0), peek(1), scope.MemoryData())
+	case vm.SLOAD:
+		t.a.storage.count(t.label(step.pc, peek(0)), false, step.pc)
+		if t.schedule.IsAtLeast("berlin") && cost >= params.ColdSloadCostEIP2929 {
+			t.a.storage.Gas.ColdAccess += cost
+		} else {
+			t.a.storage.Gas.WarmAccess += cost
+		}
+	case vm.SSTORE:
+		t.a.storage.count(t.label(step.pc, peek(0)), true, step.pc)
+		t.a.storage.noteWrite(step.pc, peek(0), peek(1))
+		t.classifySStore(cost)
+	case vm.TLOAD:
+		t.a.storage.TLoadCount[peek(0).String()]++
+		t.a.storage.Gas.Transient += cost
+	case vm.TSTORE:
+		t.a.storage.TStoreCount[peek(0).String()]++
+		t.a.storage.Gas.Transient += cost
+	}
+}
+
+// recordPreimage remembers a hash of memory that derives a storage slot.
+func (t *executionTracer) recordPreimage(pc int, off, size Value, memory []byte) {
+	at, atOK := off.Uint64()
+	n, nOK := size.Uint64()
+	if !atOK || !nOK || (n != 32 && n != 64) || at+n > uint64(len(memory)) {
+		return
+	}
+	data := memory[at : at+n]
+	words := make([]Value, n/32)
+	for i := range words {
+		w := new(uint256.Int).SetBytes(data[32*i : 32*i+32])
+		if v, ok := t.preimages[*w]; ok {
+			words[i] = v
+		} else {
+			words[i] = Const(w)
+		}
+	}
+	if v, ok := hashSlot(words, pc); ok {
+		t.preimages[*new(uint256.Int).SetBytes(crypto.Keccak256(data))] = v
+	}
+}
+
+// maxArrayIndex bounds how far past an array's first element a slot is
+// still taken to be one of its elements.
+const maxArrayIndex = 1 << 32
+
+// label names a concrete slot from the preimages seen so far: a mapping
+// entry, or an element of an array whose start was hashed.
+func (t *executionTracer) label(pc int, slot Value) Value {
+	w := slot.Word()
+	if w == nil {
+		return slot
+	}
+	if v, ok := t.preimages[*w]; ok {
+		if v.loc.elements {
+			v, _ = offsetSlot(v, ConstUint64(0), pc)
+		}
+		return v
+	}
+	for base, v := range t.preimages {
+		if !v.loc.elements || w.Lt(&base) {
+			continue
+		}
+		if i := new(uint256.Int).Sub(w, &base); i.LtUint64(maxArrayIndex) {
+			v, _ = offsetSlot(v, Const(i), pc)
+			return v
+		}
+	}
+	return slot
+}
+
+// flush charges the pending step now that the next one is known. The gas
+// difference is used rather than the reported cost, because for CALL and
+// CREATE the cost includes gas forwarded to and returned by the callee.
+func (t *executionTracer) flush(next *executedStep) {
+	prev := t.pending
+	if prev == nil {
+		return
+	}
+	gas := prev.cost
+	if next != nil && prev.gas >= next.gas {
+		gas = prev.gas - next.gas
+	}
+	if next != nil && (prev.op == vm.JUMP || prev.op == vm.JUMPI) && next.pc < prev.pc {
+		// Without a CFG every backward jump counts; with one, returns from
+		// internal functions are not loops.
+		if !t.a.loopTracker.RecordIteration(next.pc) && t.a.cfg == nil {
+			t.a.loopTracker.RecordLoop(next.pc, prev.pc)
+		}
+	}
+	if prev.op == vm.SSTORE {
+		t.sstoreRun++
+		t.a.maxSSTORERun = max(t.a.maxSSTORERun, t.sstoreRun)
+	} else {
+		t.sstoreRun = 0
+	}
+
+	ins, ok := t.instrs[prev.pc]
+	if !ok {
+		ins = disasm.Instruction{PC: prev.pc, Op: prev.op, Size: 1}
+	}
+	t.a.opcodeCount[prev.op]++
+	t.a.opcodeGas[prev.op] += gas
+	t.a.trace = append(t.a.trace, traceEntry{ins: ins, static: gas, dynamic: DynamicCost{Bounded: true}, defined: true})
+	t.pending = nil
+}
+
+// classifySStore splits an executed SSTORE's cost into the cold surcharge
+// and the set, reset or warm write it paid for.
+func (t *executionTracer) classifySStore(cost uint64) {
+	gas := &t.a.storage.Gas
+	if t.schedule.IsAtLeast("berlin") {
+		if cost == params.ColdSloadCostEIP2929+params.WarmStorageReadCostEIP2929 ||
+			cost == params.ColdSloadCostEIP2929+params.SstoreSetGasEIP2200 ||
+			cost == params.SstoreResetGasEIP2200 {
+			gas.ColdAccess += params.ColdSloadCostEIP2929
+			cost -= params.ColdSloadCostEIP2929
+		}
+	}
+	switch {
+	case cost >= params.SstoreSetGas:
+		gas.Set += cost
+	case cost >= params.SstoreResetGasEIP2200-params.ColdSloadCostEIP2929:
+		gas.Reset += cost
+	default:
+		gas.WarmAccess += cost
+	}
+}
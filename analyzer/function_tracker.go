@@ -1,13 +1,40 @@
 package analyzer
 
+import (
+	"strings"
+
+	"gaslens/disasm"
+	"gaslens/signatures"
+)
+
 type FunctionInfo struct {
-	Selector string
-	EntryPC  int
-	Gas      uint64
+	Selector   string
+	Signatures []string // candidate text signatures, several on a collision
+	EntryPC    int
+	Gas        uint64
+	Discovery  string // how the dispatcher selected it, see DiscoveryLinear
+	// MinGas and MaxGas price the cheapest and most expensive acyclic paths
+	// from the entry to a halt, WorstPath lists the start pcs of the blocks
+	// on the most expensive one, and OpenLoops the loops on it whose
+	// iterations MaxGas leaves out because their bound is not a constant.
+	MinGas    uint64
+	MaxGas    uint64
+	WorstPath []int
+	OpenLoops []Loop
+	Calls     []int // entry pcs of the internal functions it calls
+}
+
+// Label returns the selector followed by its known signatures.
+func (fn FunctionInfo) Label() string {
+	if len(fn.Signatures) == 0 {
+		return fn.Selector
+	}
+	return fn.Selector + " " + strings.Join(fn.Signatures, " | ")
 }
 
 type FunctionTracker struct {
-	Functions []FunctionInfo
+	Functions   []FunctionInfo
+	Subroutines []Subroutine
 }
 
 func NewFunctionTracker() *FunctionTracker {
@@ -24,10 +51,36 @@ func (ft *FunctionTracker) AddFunction(selector string, pc int) {
 	})
 }
 
-func (ft *FunctionTracker) AddGas(pc int, gas uint64) {
+// Discover runs the dispatcher analysis over code and records every
+// selector it matches, with the PC its function starts at.
+func (ft *FunctionTracker) Discover(code []byte, instrs []disasm.Instruction, schedule *GasSchedule) {
+	for _, e := range FindDispatchEntries(code, instrs, schedule) {
+		ft.Functions = append(ft.Functions, FunctionInfo{
+			Selector:  e.Selector,
+			EntryPC:   e.EntryPC,
+			Discovery: e.Discovery,
+		})
+	}
+}
+
+// Name looks up the text signatures of every function's selector in db.
+func (ft *FunctionTracker) Name(db *signatures.DB) {
+	for i := range ft.Functions {
+		ft.Functions[i].Signatures = db.Function(ft.Functions[i].Selector)
+	}
+	ft.labelCallers()
+}
+
+// AttributeGas sets each function's gas to the cost of every block reachable
+// from its entry, including internal functions it calls.
+func (ft *FunctionTracker) AttributeGas(g *CFG, gasByPC map[int]uint64) {
 	for i := range ft.Functions {
-		if pc >= ft.Functions[i].EntryPC {
-			ft.Functions[i].Gas += gas
+		var gas uint64
+		for _, b := range g.ReachableFrom(ft.Functions[i].EntryPC) {
+			for _, ins := range b.Instructions {
+				gas += gasByPC[ins.PC]
+			}
 		}
+		ft.Functions[i].Gas = gas
 	}
 }
@@ -1,34 +1,233 @@
 package analyzer
 
-import "github.com/ethereum/go-ethereum/core/vm"
-
-// GasTable is the approximate gas cost of EVM opcodes
-var GasTable = map[vm.OpCode]uint64{
-	vm.STOP: 0, vm.ADD: 3, vm.MUL: 5, vm.SUB: 3, vm.DIV: 5, vm.SDIV: 5, vm.MOD: 5, vm.SMOD: 5, vm.ADDMOD: 8, vm.MULMOD: 8,
-	vm.EXP: 10, vm.SIGNEXTEND: 5, vm.LT: 3, vm.GT: 3, vm.SLT: 3, vm.SGT: 3, vm.EQ: 3, vm.ISZERO: 3, vm.AND: 3, vm.OR: 3,
-	vm.XOR: 3, vm.NOT: 3, vm.BYTE: 3, vm.SHL: 3, vm.SHR: 3, vm.SAR: 3, vm.KECCAK256: 30,
-	vm.ADDRESS: 2, vm.BALANCE: 100, vm.ORIGIN: 2, vm.CALLER: 2, vm.CALLVALUE: 2, vm.CALLDATALOAD: 3, vm.CALLDATASIZE: 2,
-	vm.CALLDATACOPY: 3, vm.CODESIZE: 2, vm.CODECOPY: 3, vm.GASPRICE: 2, vm.EXTCODESIZE: 100, vm.EXTCODECOPY: 100,
-	vm.RETURNDATASIZE: 2, vm.RETURNDATACOPY: 3, vm.BLOCKHASH: 20, vm.COINBASE: 2, vm.TIMESTAMP: 2, vm.NUMBER: 2,
-	vm.DIFFICULTY: 2, vm.GASLIMIT: 2, vm.POP: 2, vm.MLOAD: 3, vm.MSTORE: 3, vm.MSTORE8: 3, vm.SLOAD: 100, vm.SSTORE: 20000,
-	vm.JUMP: 8, vm.JUMPI: 10, vm.PC: 2, vm.MSIZE: 2, vm.GAS: 2, vm.JUMPDEST: 1,
-	vm.PUSH1: 3, vm.PUSH2: 3, vm.PUSH3: 3, vm.PUSH4: 3, vm.PUSH5: 3, vm.PUSH6: 3, vm.PUSH7: 3, vm.PUSH8: 3, vm.PUSH9: 3,
-	vm.PUSH10: 3, vm.PUSH11: 3, vm.PUSH12: 3, vm.PUSH13: 3, vm.PUSH14: 3, vm.PUSH15: 3, vm.PUSH16: 3, vm.PUSH17: 3,
-	vm.PUSH18: 3, vm.PUSH19: 3, vm.PUSH20: 3, vm.PUSH21: 3, vm.PUSH22: 3, vm.PUSH23: 3, vm.PUSH24: 3, vm.PUSH25: 3,
-	vm.PUSH26: 3, vm.PUSH27: 3, vm.PUSH28: 3, vm.PUSH29: 3, vm.PUSH30: 3, vm.PUSH31: 3, vm.PUSH32: 3,
-	vm.DUP1: 3, vm.DUP2: 3, vm.DUP3: 3, vm.DUP4: 3, vm.DUP5: 3, vm.DUP6: 3, vm.DUP7: 3, vm.DUP8: 3, vm.DUP9: 3,
-	vm.DUP10: 3, vm.DUP11: 3, vm.DUP12: 3, vm.DUP13: 3, vm.DUP14: 3, vm.DUP15: 3, vm.DUP16: 3,
-	vm.SWAP1: 3, vm.SWAP2: 3, vm.SWAP3: 3, vm.SWAP4: 3, vm.SWAP5: 3, vm.SWAP6: 3, vm.SWAP7: 3, vm.SWAP8: 3,
-	vm.SWAP9: 3, vm.SWAP10: 3, vm.SWAP11: 3, vm.SWAP12: 3, vm.SWAP13: 3, vm.SWAP14: 3, vm.SWAP15: 3, vm.SWAP16: 3,
-	vm.LOG0: 375, vm.LOG1: 750, vm.LOG2: 1125, vm.LOG3: 1500, vm.LOG4: 1875,
-	vm.CREATE: 32000, vm.CALL: 700, vm.CALLCODE: 700, vm.DELEGATECALL: 700, vm.STATICCALL: 700, vm.RETURN: 0,
-	vm.REVERT: 0, vm.SELFDESTRUCT: 5000,
-}
-
-// GetGasCost returns gas for opcode, default 0 if unknown
-func GetGasCost(op vm.OpCode) uint64 {
-	if cost, ok := GasTable[op]; ok {
-		return cost
-	}
-	return 0
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// DefaultFork is the fork used when none is requested.
+const DefaultFork = "osaka"
+
+// Forks lists the supported hardforks from oldest to newest.
+var Forks = []string{
+	"frontier", "homestead", "tangerinewhistle", "spuriousdragon", "byzantium",
+	"constantinople", "petersburg", "istanbul", "berlin", "london", "paris",
+	"shanghai", "cancun", "prague", "osaka",
+}
+
+var forkAliases = map[string]string{
+	"tangerine": "tangerinewhistle",
+	"spurious":  "spuriousdragon",
+	"merge":     "paris",
+}
+
+// GasSchedule is the static gas cost of every opcode under one hardfork,
+// taken from go-ethereum's jump table for that fork.
+type GasSchedule struct {
+	Fork     string
+	index    int
+	constant [256]uint64
+	dynamic  [256]bool
+	defined  [256]bool
+	rules    params.Rules
+	eof      bool // pricing EOF code, see withEOF
+}
+
+// NewGasSchedule returns the schedule for fork, which is matched
+// case-insensitively against Forks.
+func NewGasSchedule(fork string) (*GasSchedule, error) {
+	name := strings.ToLower(fork)
+	if alias, ok := forkAliases[name]; ok {
+		name = alias
+	}
+	index := -1
+	for i, f := range Forks {
+		if f == name {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("unknown fork %q (supported: %s)", fork, strings.Join(Forks, ", "))
+	}
+
+	rules := forkRules(index)
+	jt, err := vm.LookupInstructionSet(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	gs := &GasSchedule{Fork: name, index: index, rules: rules}
+	for i, op := range jt {
+		if gs.constant[i], gs.dynamic[i], gs.defined[i], err = readOperation(op); err != nil {
+			return nil, fmt.Errorf("reading the %s jump table: %w", name, err)
+		}
+	}
+
+	// INVALID is undefined in the jump table but is the designated abort
+	// opcode, not an unknown one.
+	gs.defined[vm.INVALID] = true
+
+	// LOG is entirely dynamic in go-ethereum, but the per-call and per-topic
+	// charges do not depend on any operand.
+	for n := 0; n <= 4; n++ {
+		gs.constant[vm.LOG0+vm.OpCode(n)] = params.LogGas + uint64(n)*params.LogTopicGas
+	}
+	return gs, nil
+}
+
+// readOperation returns the constant gas of a jump table entry, whether it
+// has a dynamic part, and whether the opcode is defined. go-ethereum keeps
+// these fields unexported; reflection reads them without copying the
+// numbers by hand, and fails cleanly if a release renames or retypes them.
+func readOperation(op any) (constant uint64, dynamic, defined bool, err error) {
+	v := reflect.ValueOf(op)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return 0, false, false, fmt.Errorf("unexpected entry %T", op)
+	}
+	fields := v.Elem()
+	field := func(name string, kind reflect.Kind) (reflect.Value, error) {
+		f := fields.FieldByName(name)
+		if !f.IsValid() || f.Kind() != kind {
+			return reflect.Value{}, fmt.Errorf("go-ethereum's operation type has no %s field of kind %s", name, kind)
+		}
+		return f, nil
+	}
+	gas, err := field("constantGas", reflect.Uint64)
+	if err != nil {
+		return 0, false, false, err
+	}
+	dyn, err := field("dynamicGas", reflect.Func)
+	if err != nil {
+		return 0, false, false, err
+	}
+	undefined, err := field("undefined", reflect.Bool)
+	if err != nil {
+		return 0, false, false, err
+	}
+	return gas.Uint(), !dyn.IsNil(), !undefined.Bool(), nil
+}
+
+// forkRules returns the go-ethereum rules with every fork up to and
+// including Forks[index] enabled.
+func forkRules(index int) params.Rules {
+	at := func(name string) bool {
+		for i, f := range Forks {
+			if f == name {
+				return index >= i
+			}
+		}
+		return false
+	}
+	return params.Rules{
+		IsHomestead:      at("homestead"),
+		IsEIP150:         at("tangerinewhistle"),
+		IsEIP155:         at("spuriousdragon"),
+		IsEIP158:         at("spuriousdragon"),
+		IsByzantium:      at("byzantium"),
+		IsConstantinople: at("constantinople"),
+		IsPetersburg:     at("petersburg"),
+		IsIstanbul:       at("istanbul"),
+		IsBerlin:         at("berlin"),
+		IsEIP2929:        at("berlin"),
+		IsLondon:         at("london"),
+		IsMerge:          at("paris"),
+		IsShanghai:       at("shanghai"),
+		IsCancun:         at("cancun"),
+		IsPrague:         at("prague"),
+		IsOsaka:          at("osaka"),
+	}
+}
+
+// ChainConfig returns a go-ethereum chain config with every fork up to and
+// including the schedule's fork active from genesis.
+func (gs *GasSchedule) ChainConfig() *params.ChainConfig {
+	block := func(fork string) *big.Int {
+		if gs.IsAtLeast(fork) {
+			return new(big.Int)
+		}
+		return nil
+	}
+	timestamp := func(fork string) *uint64 {
+		if gs.IsAtLeast(fork) {
+			return new(uint64)
+		}
+		return nil
+	}
+	cfg := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      block("homestead"),
+		EIP150Block:         block("tangerinewhistle"),
+		EIP155Block:         block("spuriousdragon"),
+		EIP158Block:         block("spuriousdragon"),
+		ByzantiumBlock:      block("byzantium"),
+		ConstantinopleBlock: block("constantinople"),
+		PetersburgBlock:     block("petersburg"),
+		IstanbulBlock:       block("istanbul"),
+		BerlinBlock:         block("berlin"),
+		LondonBlock:         block("london"),
+		ShanghaiTime:        timestamp("shanghai"),
+		CancunTime:          timestamp("cancun"),
+		PragueTime:          timestamp("prague"),
+		OsakaTime:           timestamp("osaka"),
+		BlobScheduleConfig: &params.BlobScheduleConfig{
+			Cancun: params.DefaultCancunBlobConfig,
+			Prague: params.DefaultPragueBlobConfig,
+			Osaka:  params.DefaultOsakaBlobConfig,
+		},
+	}
+	if gs.IsAtLeast("paris") {
+		cfg.TerminalTotalDifficulty = new(big.Int)
+	}
+	return cfg
+}
+
+// IsAtLeast reports whether the schedule's fork is fork or a later one.
+func (gs *GasSchedule) IsAtLeast(fork string) bool {
+	for i, f := range Forks {
+		if f == fork {
+			return gs.index >= i
+		}
+	}
+	return false
+}
+
+// GetGasCost returns the static gas for op. ok is false when op is not
+// defined in this fork, in which case executing it would abort the call.
+func (gs *GasSchedule) GetGasCost(op vm.OpCode) (gas uint64, ok bool) {
+	if !gs.defined[op] {
+		return 0, false
+	}
+	return gs.constant[op], true
+}
+
+// IsDynamic reports whether op has a cost component that depends on its
+// operands or on state, on top of the static cost.
+func (gs *GasSchedule) IsDynamic(op vm.OpCode) bool {
+	return gs.dynamic[op]
+}
+
+// IsDefined reports whether op exists in this fork.
+func (gs *GasSchedule) IsDefined(op vm.OpCode) bool {
+	return gs.defined[op]
+}
+
+// IsPrecompile reports whether addr is a precompiled contract in this fork.
+// Precompiles are always warm.
+func (gs *GasSchedule) IsPrecompile(addr uint64) bool {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], addr)
+	target := common.BytesToAddress(buf[:])
+	for _, p := range vm.ActivePrecompiles(gs.rules) {
+		if p == target {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,68 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func TestGasSchedule(t *testing.T) {
+	tests := []struct {
+		fork    string
+		op      vm.OpCode
+		gas     uint64
+		defined bool
+		dynamic bool
+	}{
+		{"frontier", vm.ADD, 3, true, false},
+		{"frontier", vm.SLOAD, 50, true, false},
+		{"tangerinewhistle", vm.SLOAD, 200, true, false},
+		{"istanbul", vm.SLOAD, 800, true, false},
+		{"berlin", vm.SLOAD, 0, true, true}, // warm/cold, EIP-2929
+		{"frontier", vm.SHL, 0, false, false},
+		{"constantinople", vm.SHL, 3, true, false},
+		{"paris", vm.PUSH0, 0, false, false},
+		{"shanghai", vm.PUSH0, 2, true, false},
+		{"shanghai", vm.TLOAD, 0, false, false},
+		{"cancun", vm.TLOAD, 100, true, false},
+		{"cancun", vm.LOG2, 375 + 2*375, true, true},
+		{"cancun", vm.INVALID, 0, true, false},
+		{"cancun", vm.KECCAK256, 30, true, true},
+	}
+	for _, tt := range tests {
+		gs, err := NewGasSchedule(tt.fork)
+		if err != nil {
+			t.Fatalf("NewGasSchedule(%q): %v", tt.fork, err)
+		}
+		gas, ok := gs.GetGasCost(tt.op)
+		if ok != tt.defined || gas != tt.gas {
+			t.Errorf("%s %s: GetGasCost = %d, %v; want %d, %v", tt.fork, tt.op, gas, ok, tt.gas, tt.defined)
+		}
+		if tt.defined && gs.IsDynamic(tt.op) != tt.dynamic {
+			t.Errorf("%s %s: IsDynamic = %v, want %v", tt.fork, tt.op, gs.IsDynamic(tt.op), tt.dynamic)
+		}
+	}
+}
+
+func TestNewGasScheduleNames(t *testing.T) {
+	for _, name := range []string{"Cancun", "merge", "tangerine"} {
+		if _, err := NewGasSchedule(name); err != nil {
+			t.Errorf("NewGasSchedule(%q): %v", name, err)
+		}
+	}
+	if _, err := NewGasSchedule("atlantis"); err == nil {
+		t.Error("NewGasSchedule(\"atlantis\") succeeded, want an error")
+	}
+}
+
+func TestReadOperationRejectsUnknownLayout(t *testing.T) {
+	type operation struct {
+		constGas uint64
+	}
+	if _, _, _, err := readOperation(&operation{}); err == nil {
+		t.Error("readOperation accepted a struct without constantGas")
+	}
+	if _, _, _, err := readOperation(nil); err == nil {
+		t.Error("readOperation accepted nil")
+	}
+}
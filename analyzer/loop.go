@@ -1,9 +1,64 @@
 package analyzer
 
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"gaslens/disasm"
+	"gaslens/layout"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// Loop bound kinds.
+const (
+	BoundConstant      = "constant"       // a number in the code
+	BoundStorageLength = "storage_length" // the length word of a storage array the body indexes
+	BoundMemoryLength  = "memory_length"  // the length word of a memory array the body indexes
+	BoundInput         = "input"          // calldata
+	BoundExpression    = "expression"     // anything else
+)
+
+// Loop is a natural loop: StartPC is its header and EndPC the jump that
+// closes it. Count is how many times it iterated when executed, and is
+// zero in static analysis.
+//
+// When one iteration could be followed from the header back to it, ExitPC
+// and Condition are the jump that leaves the loop and its condition,
+// Induction the counter it compares, and Bound what the counter runs up
+// to. Counters are named by their depth on the stack at the header, e.g.
+// "stack[1] += 1". A loop without a Bound is unbounded as far as the
+// analysis can tell.
 type Loop struct {
-	StartPC int
-	EndPC   int
-	Count   int
+	StartPC         int    `json:"start_pc"`
+	EndPC           int    `json:"end_pc"`
+	Count           int    `json:"count,omitempty"`
+	GasPerIteration uint64 `json:"gas_per_iteration,omitempty"`
+	ExitPC          int    `json:"exit_pc,omitempty"`
+	Condition       string `json:"condition,omitempty"`
+	Induction       string `json:"induction,omitempty"`
+	Bound           string `json:"bound,omitempty"`
+	BoundKind       string `json:"bound_kind,omitempty"`
+	Source          string `json:"source,omitempty"`
+
+	// lengthSlot is the fixed slot an SLOAD bound reads, for a storage
+	// layout to tell whether it is an array's length.
+	lengthSlot string
+}
+
+// Summary describes one iteration, e.g. "≈310 gas per iteration, bounded
+// by slot 2 length" or "≈310 gas per iteration, unbounded". The gas is
+// left out when no iteration could be followed.
+func (l Loop) Summary() string {
+	bound := "unbounded"
+	if l.Bound != "" {
+		bound = "bounded by " + l.Bound
+	}
+	if l.GasPerIteration == 0 {
+		return bound
+	}
+	return fmt.Sprintf("≈%d gas per iteration, %s", l.GasPerIteration, bound)
 }
 
 type LoopTracker struct {
@@ -16,6 +71,18 @@ func NewLoopTracker() *LoopTracker {
 	}
 }
 
+// RecordIteration counts a jump back to header when it is the header of a
+// known loop.
+func (lt *LoopTracker) RecordIteration(header int) bool {
+	for i := range lt.Loops {
+		if lt.Loops[i].StartPC == header {
+			lt.Loops[i].Count++
+			return true
+		}
+	}
+	return false
+}
+
 func (lt *LoopTracker) RecordLoop(start, end int) {
 	for i := range lt.Loops {
 		if lt.Loops[i].StartPC == start && lt.Loops[i].EndPC == end {
@@ -29,3 +96,402 @@ func (lt *LoopTracker) RecordLoop(start, end int) {
 		Count:   1,
 	})
 }
+
+// FromCFG records the natural loops of g, with their bounds and the gas of
+// one iteration priced from gasByPC.
+func (lt *LoopTracker) FromCFG(g *CFG, gasByPC map[int]uint64) {
+	for _, nl := range g.naturalLoops() {
+		loop := Loop{StartPC: nl.header, EndPC: nl.end}
+		analyzeLoop(g, nl, gasByPC, &loop)
+		lt.Loops = append(lt.Loops, loop)
+	}
+}
+
+// applyLayout classifies the loops bounded by a slot that l declares as a
+// dynamic array as running over that array.
+func (lt *LoopTracker) applyLayout(l *layout.Layout) {
+	for i := range lt.Loops {
+		loop := &lt.Loops[i]
+		w, ok := slotWord(loop.lengthSlot)
+		if !ok || loop.BoundKind != BoundExpression {
+			continue
+		}
+		for _, f := range l.At(w) {
+			if f.Encoding == layout.DynamicArray {
+				loop.Bound, loop.BoundKind = storageLength(loop.lengthSlot), BoundStorageLength
+			}
+		}
+	}
+}
+
+// naturalLoop is a loop header, the blocks of its body, and the pc of the
+// last jump back to the header.
+type naturalLoop struct {
+	header int
+	end    int
+	body   map[int]bool
+}
+
+// naturalLoops merges the back edges into each header into one loop whose
+// body is every block that reaches a latch without passing the header.
+func (g *CFG) naturalLoops() []*naturalLoop {
+	preds := map[int][]int{}
+	for from, succs := range g.flowGraph() {
+		for _, to := range succs {
+			preds[to] = append(preds[to], from)
+		}
+	}
+	byHeader := map[int]*naturalLoop{}
+	for _, e := range g.BackEdges() {
+		nl := byHeader[e.To]
+		if nl == nil {
+			nl = &naturalLoop{header: e.To, body: map[int]bool{e.To: true}}
+			byHeader[e.To] = nl
+		}
+		nl.end = max(nl.end, g.Block(e.From).Last().PC)
+		work := []int{e.From}
+		for len(work) > 0 {
+			n := work[len(work)-1]
+			work = work[:len(work)-1]
+			if nl.body[n] {
+				continue
+			}
+			nl.body[n] = true
+			work = append(work, preds[n]...)
+		}
+	}
+	out := make([]*naturalLoop, 0, len(byHeader))
+	for _, nl := range byHeader {
+		out = append(out, nl)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].header < out[j].header })
+	return out
+}
+
+// loopStackDepth is how many entries at the header are named, and
+// maxLoopSteps how many instructions one iteration may take to follow.
+const (
+	loopStackDepth = 32
+	maxLoopSteps   = 4096
+)
+
+// loopExit is a conditional jump that leaves the loop.
+type loopExit struct {
+	pc   int
+	cond Value
+}
+
+// stackSymbols returns a stack whose entries are named by their depth.
+func stackSymbols() []Value {
+	stack := make([]Value, loopStackDepth)
+	for i := range stack {
+		stack[len(stack)-1-i] = stackEntry(i)
+	}
+	return stack
+}
+
+// stackEntry is the symbol naming the header stack entry at depth.
+func stackEntry(depth int) Value {
+	return Symbol(fmt.Sprintf("stack[%d]", depth))
+}
+
+// stackDepth returns the depth of v when it is a header stack entry.
+func stackDepth(v Value) (int, bool) {
+	for depth := 0; depth < loopStackDepth; depth++ {
+		if v.Equal(stackEntry(depth)) {
+			return depth, true
+		}
+	}
+	return 0, false
+}
+
+func isStackEntry(v Value) bool {
+	_, ok := stackDepth(v)
+	return ok
+}
+
+// loopIteration is what following one iteration found: the exits, the
+// header stack on coming back round, the gas, the declared slots of the
+// storage arrays whose elements the body accesses, and the addresses it
+// accesses memory at.
+type loopIteration struct {
+	exits  []loopExit
+	final  []Value
+	gas    uint64
+	arrays map[string]bool
+	memory []Value
+}
+
+// note records the storage array element or memory address ins accesses.
+func (it *loopIteration) note(ins disasm.Instruction, se *StackEngine) {
+	switch ins.Op {
+	case vm.SLOAD, vm.SSTORE:
+		if slot := se.Peek(0); slot.loc.container == VariableArray {
+			it.arrays[slot.loc.base] = true
+		}
+	case vm.MLOAD, vm.MSTORE:
+		it.memory = append(it.memory, se.Peek(0))
+	}
+}
+
+// walkIteration follows one iteration from the header back to it over a
+// stack of named entries, entering helpers the body calls. At a branch
+// both of whose sides stay in the loop it takes the side not yet visited.
+func walkIteration(g *CFG, nl *naturalLoop, gasByPC map[int]uint64) (*loopIteration, bool) {
+	it := &loopIteration{arrays: map[string]bool{}}
+	se := &StackEngine{Stack: stackSymbols()}
+	visited := map[int]bool{}
+	cur := g.Block(nl.header)
+	for steps := 0; cur != nil && steps < maxLoopSteps; {
+		visited[cur.Start] = true
+		next := -1
+		for i, ins := range cur.Instructions {
+			steps++
+			it.gas += gasByPC[ins.PC]
+			it.note(ins, se)
+			if i < len(cur.Instructions)-1 {
+				se.Step(ins)
+				continue
+			}
+			switch ins.Op {
+			case vm.JUMP:
+				target, known := se.Peek(0).Uint64()
+				if !known {
+					return nil, false
+				}
+				next = int(target)
+			case vm.JUMPI:
+				target, known := se.Peek(0).Uint64()
+				if !known {
+					return nil, false
+				}
+				cond := se.Peek(1)
+				jump, fall := int(target), cur.End
+				switch {
+				case cond.IsConcrete():
+					next = fall
+					if !cond.IsZero() {
+						next = jump
+					}
+				case nl.body[jump] && !nl.body[fall]:
+					it.exits = append(it.exits, loopExit{pc: ins.PC, cond: cond})
+					next = jump
+				case nl.body[fall] && !nl.body[jump]:
+					it.exits = append(it.exits, loopExit{pc: ins.PC, cond: cond})
+					next = fall
+				case nl.body[fall] && nl.body[jump]:
+					next = fall
+					if visited[fall] && !visited[jump] {
+						next = jump
+					}
+				default:
+					return nil, false
+				}
+			case vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID, vm.SELFDESTRUCT:
+				return nil, false
+			default:
+				if !fallsThrough(cur) {
+					// EOF flow is not followed.
+					return nil, false
+				}
+				next = cur.End
+			}
+			se.Step(ins)
+		}
+		if next == nl.header {
+			it.final = se.Stack
+			return it, true
+		}
+		cur = g.Block(next)
+	}
+	return nil, false
+}
+
+// loopCounter is a header stack entry one iteration advances by a constant.
+type loopCounter struct {
+	entry Value
+	step  string // e.g. "stack[1] += 1"
+}
+
+// counters returns the stack entries one iteration advances by a constant,
+// shallowest first.
+func counters(final []Value) []loopCounter {
+	var out []loopCounter
+	if len(final) != loopStackDepth {
+		return out
+	}
+	for depth := 0; depth < loopStackDepth; depth++ {
+		entry := stackEntry(depth)
+		op, args, ok := final[loopStackDepth-1-depth].Op()
+		if !ok || len(args) != 2 {
+			continue
+		}
+		var step Value
+		switch {
+		case (op == vm.ADD || op == vm.SUB) && args[0].Equal(entry) && args[1].IsConcrete():
+			step = args[1]
+		case op == vm.ADD && args[1].Equal(entry) && args[0].IsConcrete():
+			step = args[0]
+		default:
+			continue
+		}
+		sign := "+="
+		if op == vm.SUB {
+			sign = "-="
+		}
+		out = append(out, loopCounter{entry: entry, step: fmt.Sprintf("%s %s %s", entry, sign, step)})
+	}
+	return out
+}
+
+// comparisons lists the operands of every LT, GT, SLT, SGT and EQ cond is
+// computed from, outermost first.
+func comparisons(cond Value) [][2]Value {
+	var out [][2]Value
+	cond.mentions(func(v Value) bool {
+		op, args, ok := v.Op()
+		if ok && len(args) == 2 {
+			switch op {
+			case vm.LT, vm.GT, vm.SLT, vm.SGT, vm.EQ:
+				out = append(out, [2]Value{args[0], args[1]})
+			}
+		}
+		return false
+	})
+	return out
+}
+
+// isCounter reports whether operand is the counter, possibly truncated to
+// a smaller type by a mask.
+func isCounter(operand, counter Value) bool {
+	if operand.Equal(counter) {
+		return true
+	}
+	op, args, ok := operand.Op()
+	if !ok || op != vm.AND || len(args) != 2 {
+		return false
+	}
+	return args[0].Equal(counter) && args[1].IsConcrete() || args[1].Equal(counter) && args[0].IsConcrete()
+}
+
+// readsCalldata reports whether v is computed from the call's input.
+func readsCalldata(v Value) bool {
+	op, _, ok := v.Op()
+	return ok && (op == vm.CALLDATALOAD || op == vm.CALLDATASIZE)
+}
+
+// storageLength names the length word of the storage array at slot.
+func storageLength(slot string) string {
+	return fmt.Sprintf("slot %s length", slot)
+}
+
+// indexesMemory reports whether the body accesses memory past the word at
+// ptr, as indexing the array whose length is stored there does.
+func (it *loopIteration) indexesMemory(ptr Value) bool {
+	first := ptr
+	if ptr.IsConcrete() {
+		first = Const(new(uint256.Int).AddUint64(ptr.Word(), 32))
+	}
+	for _, addr := range it.memory {
+		if !addr.Equal(ptr) && addr.mentions(func(v Value) bool { return v.Equal(ptr) || v.Equal(first) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyBound names what a counter is compared against. A word read
+// from storage or memory is an array's length only when the body indexes
+// that array; otherwise it is an expression, like any other variable.
+func (it *loopIteration) classifyBound(bound Value) (string, string) {
+	if bound.IsConcrete() {
+		return bound.String(), BoundConstant
+	}
+	if op, args, ok := bound.Op(); ok && len(args) == 1 {
+		switch {
+		case op == vm.SLOAD && args[0].IsConcrete() && it.arrays[args[0].String()]:
+			return storageLength(args[0].String()), BoundStorageLength
+		case op == vm.MLOAD && it.indexesMemory(args[0]):
+			return fmt.Sprintf("memory array length at %s", args[0]), BoundMemoryLength
+		}
+	}
+	if bound.mentions(readsCalldata) {
+		return bound.String(), BoundInput
+	}
+	return bound.String(), BoundExpression
+}
+
+// analyzeLoop fills in the exit, counter and bound of loop and the gas of
+// one iteration. A bound kept on the stack since before the loop is looked
+// up in the block that enters the loop.
+func analyzeLoop(g *CFG, nl *naturalLoop, gasByPC map[int]uint64, loop *Loop) {
+	it, ok := walkIteration(g, nl, gasByPC)
+	if !ok {
+		return
+	}
+	loop.GasPerIteration = it.gas
+	steps := counters(it.final)
+	for _, exit := range it.exits {
+		for _, cmp := range comparisons(exit.cond) {
+			for _, counter := range steps {
+				var bound Value
+				switch {
+				case isCounter(cmp[0], counter.entry):
+					bound = cmp[1]
+				case isCounter(cmp[1], counter.entry):
+					bound = cmp[0]
+				default:
+					continue
+				}
+				if depth, ok := stackDepth(bound); ok {
+					bound = entryValue(g, nl, depth)
+				}
+				loop.ExitPC, loop.Condition, loop.Induction = exit.pc, exit.cond.String(), counter.step
+				if !bound.IsUnknown() && !bound.mentions(isStackEntry) {
+					loop.Bound, loop.BoundKind = it.classifyBound(bound)
+					if op, args, ok := bound.Op(); ok && op == vm.SLOAD && args[0].IsConcrete() {
+						loop.lengthSlot = args[0].String()
+					}
+				}
+				return
+			}
+		}
+	}
+	if len(it.exits) > 0 {
+		loop.ExitPC, loop.Condition = it.exits[0].pc, it.exits[0].cond.String()
+	}
+}
+
+// maxEntrySteps bounds how many blocks entryValue walks back through.
+const maxEntrySteps = 16
+
+// entryValue returns what the header stack entry at depth holds when the
+// loop is entered: it walks back from the header through blocks with a
+// single predecessor outside the loop, helpers' returns included, until a
+// block computes the entry. It returns unknown when the value is not found.
+func entryValue(g *CFG, nl *naturalLoop, depth int) Value {
+	b := g.Block(nl.header)
+	for step := 0; step < maxEntrySteps; step++ {
+		var from []int
+		for _, e := range b.Preds {
+			if !nl.body[e.From] && !slices.Contains(from, e.From) {
+				from = append(from, e.From)
+			}
+		}
+		if len(from) != 1 {
+			return Unknown()
+		}
+		b = g.Block(from[0])
+		se := &StackEngine{Stack: stackSymbols()}
+		for _, ins := range b.Instructions {
+			se.Step(ins)
+		}
+		v := se.Peek(depth)
+		d, ok := stackDepth(v)
+		if !ok {
+			return v
+		}
+		depth = d
+	}
+	return Unknown()
+}
@@ -0,0 +1,208 @@
+package analyzer
+
+import (
+	"testing"
+
+	"gaslens/layout"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// arrayLengthLoop reads every element of the storage array at slot 2.
+//
+//	0: PUSH0  1: JUMPDEST  2: PUSH1 2  4: SLOAD  5: DUP2  6: LT  7: ISZERO
+//	8: PUSH1 29  10: JUMPI  11: PUSH1 2  13: PUSH0  14: MSTORE  15: PUSH1 32
+//	17: PUSH0  18: KECCAK256  19: DUP2  20: ADD  21: SLOAD  22: POP
+//	23: PUSH1 1  25: ADD  26: PUSH1 1  28: JUMP  29: JUMPDEST  30: STOP
+var arrayLengthLoop = []byte{
+	0x5f, 0x5b, 0x60, 0x02, 0x54, 0x81, 0x10, 0x15, 0x60, 0x1d, 0x57,
+	0x60, 0x02, 0x5f, 0x52, 0x60, 0x20, 0x5f, 0x20, 0x81, 0x01, 0x54, 0x50,
+	0x60, 0x01, 0x01, 0x60, 0x01, 0x56, 0x5b, 0x00,
+}
+
+// storageBoundLoop counts up to the word in slot 2, read every iteration.
+//
+//	0: PUSH0  1: JUMPDEST  2: PUSH1 2  4: SLOAD  5: DUP2  6: LT  7: ISZERO
+//	8: PUSH1 17  10: JUMPI  11: PUSH1 1  13: ADD  14: PUSH1 1  16: JUMP
+//	17: JUMPDEST  18: STOP
+var storageBoundLoop = []byte{
+	0x5f, 0x5b, 0x60, 0x02, 0x54, 0x81, 0x10, 0x15, 0x60, 0x11, 0x57,
+	0x60, 0x01, 0x01, 0x60, 0x01, 0x56, 0x5b, 0x00,
+}
+
+// boundBeforeLoop counts up to the word in slot 2, read before the loop.
+//
+//	0: PUSH1 2  2: SLOAD  3: PUSH0  4: JUMPDEST  5: DUP2  6: DUP2  7: LT
+//	8: ISZERO  9: PUSH1 18  11: JUMPI  12: PUSH1 1  14: ADD  15: PUSH1 4
+//	17: JUMP  18: JUMPDEST  19: STOP
+var boundBeforeLoop = []byte{
+	0x60, 0x02, 0x54, 0x5f, 0x5b, 0x81, 0x81, 0x10, 0x15, 0x60, 0x12, 0x57,
+	0x60, 0x01, 0x01, 0x60, 0x04, 0x56, 0x5b, 0x00,
+}
+
+func TestLoopBounds(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      []byte
+		exitPC    int
+		induction string
+		bound     string
+		kind      string
+	}{
+		{
+			name:      "storage array length",
+			code:      arrayLengthLoop,
+			exitPC:    10,
+			induction: "stack[0] += 1",
+			bound:     "slot 2 length",
+			kind:      BoundStorageLength,
+		},
+		{
+			name:      "storage value",
+			code:      storageBoundLoop,
+			exitPC:    10,
+			induction: "stack[0] += 1",
+			bound:     "sload(2)@4",
+			kind:      BoundExpression,
+		},
+		{
+			name: "memory array length",
+			// 0: PUSH0  1: JUMPDEST  2: PUSH1 0x80  4: MLOAD  5: DUP2  6: LT  7: ISZERO
+			// 8: PUSH1 26  10: JUMPI  11: DUP1  12: PUSH1 32  14: MUL  15: PUSH1 0xa0
+			// 17: ADD  18: MLOAD  19: POP  20: PUSH1 1  22: ADD  23: PUSH1 1  25: JUMP
+			// 26: JUMPDEST  27: STOP
+			code: []byte{
+				0x5f, 0x5b, 0x60, 0x80, 0x51, 0x81, 0x10, 0x15, 0x60, 0x1a, 0x57,
+				0x80, 0x60, 0x20, 0x02, 0x60, 0xa0, 0x01, 0x51, 0x50,
+				0x60, 0x01, 0x01, 0x60, 0x01, 0x56, 0x5b, 0x00,
+			},
+			exitPC:    10,
+			induction: "stack[0] += 1",
+			bound:     "memory array length at 128",
+			kind:      BoundMemoryLength,
+		},
+		{
+			name: "memory word",
+			// as the storage value, with 4: MLOAD
+			code: []byte{
+				0x5f, 0x5b, 0x60, 0x80, 0x51, 0x81, 0x10, 0x15, 0x60, 0x11, 0x57,
+				0x60, 0x01, 0x01, 0x60, 0x01, 0x56, 0x5b, 0x00,
+			},
+			exitPC:    10,
+			induction: "stack[0] += 1",
+			bound:     "mload(128)@4",
+			kind:      BoundExpression,
+		},
+		{
+			name: "calldata argument",
+			// as above with 2: PUSH1 4  4: CALLDATALOAD
+			code: []byte{
+				0x5f, 0x5b, 0x60, 0x04, 0x35, 0x81, 0x10, 0x15, 0x60, 0x11, 0x57,
+				0x60, 0x01, 0x01, 0x60, 0x01, 0x56, 0x5b, 0x00,
+			},
+			exitPC:    10,
+			induction: "stack[0] += 1",
+			bound:     "calldataload(4)",
+			kind:      BoundInput,
+		},
+		{
+			name: "constant",
+			// as above with 2: PUSH2 10
+			code: []byte{
+				0x5f, 0x5b, 0x61, 0x00, 0x0a, 0x81, 0x10, 0x15, 0x60, 0x11, 0x57,
+				0x60, 0x01, 0x01, 0x60, 0x01, 0x56, 0x5b, 0x00,
+			},
+			exitPC:    10,
+			induction: "stack[0] += 1",
+			bound:     "10",
+			kind:      BoundConstant,
+		},
+		{
+			name:      "value loaded before the loop",
+			code:      boundBeforeLoop,
+			exitPC:    11,
+			induction: "stack[0] += 1",
+			bound:     "sload(2)@2",
+			kind:      BoundExpression,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := NewGasSchedule(DefaultFork)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loops := analyzeCode(tt.code, schedule).loopTracker.Loops
+			if len(loops) != 1 {
+				t.Fatalf("loops = %+v, want one", loops)
+			}
+			l := loops[0]
+			if l.ExitPC != tt.exitPC || l.Induction != tt.induction || l.Bound != tt.bound || l.BoundKind != tt.kind {
+				t.Errorf("loop exits at %d, counter %q, bound %q (%s); want %d, %q, %q (%s)",
+					l.ExitPC, l.Induction, l.Bound, l.BoundKind, tt.exitPC, tt.induction, tt.bound, tt.kind)
+			}
+		})
+	}
+}
+
+func TestLoopBoundsFromLayout(t *testing.T) {
+	const types = `"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"},` +
+		`"t_array(t_uint256)dyn_storage":{"encoding":"dynamic_array","label":"uint256[]","numberOfBytes":"32","base":"t_uint256"}`
+	tests := []struct {
+		name  string
+		typ   string
+		bound string
+		kind  string
+	}{
+		{"dynamic array", "t_array(t_uint256)dyn_storage", "slot 2 length", BoundStorageLength},
+		{"uint", "t_uint256", "sload(2)@2", BoundExpression},
+	}
+	schedule, err := NewGasSchedule(DefaultFork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := layout.Parse([]byte(`{"storage":[{"label":"x","slot":"2","offset":0,"type":"` + tt.typ + `"}],"types":{` + types + `}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := analyzeCode(boundBeforeLoop, schedule)
+			a.applyLayout(l)
+			loops := a.report.Loops
+			if len(loops) != 1 || loops[0].Bound != tt.bound || loops[0].BoundKind != tt.kind {
+				t.Errorf("loops = %+v, want one bounded by %q (%s)", loops, tt.bound, tt.kind)
+			}
+		})
+	}
+}
+
+func TestCounters(t *testing.T) {
+	final := stackSymbols()
+	top := len(final) - 1
+	final[top] = evalOp(vm.SUB, []Value{stackEntry(0), ConstUint64(2)}, 0)
+	final[top-1] = evalOp(vm.ADD, []Value{stackEntry(0), ConstUint64(1)}, 0) // not its own entry
+	final[top-2] = evalOp(vm.ADD, []Value{stackEntry(2), Symbol("caller")}, 0)
+	got := counters(final)
+	if len(got) != 1 || got[0].step != "stack[0] -= 2" {
+		t.Errorf("counters = %+v, want only stack[0] -= 2", got)
+	}
+}
+
+func TestIsCounter(t *testing.T) {
+	counter := stackEntry(1)
+	masked := evalOp(vm.AND, []Value{ConstUint64(0xff), counter}, 0)
+	tests := []struct {
+		operand Value
+		want    bool
+	}{
+		{counter, true},
+		{masked, true},
+		{stackEntry(2), false},
+		{evalOp(vm.ADD, []Value{ConstUint64(1), counter}, 0), false},
+	}
+	for _, tt := range tests {
+		if got := isCounter(tt.operand, counter); got != tt.want {
+			t.Errorf("isCounter(%s) = %v, want %v", tt.operand, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// maxModelledMemory caps resolved offsets and sizes. Anything larger would
+// run out of gas long before it expands memory, so it is treated as unknown.
+const maxModelledMemory = 1 << 32
+
+// MemoryTracker keeps an abstract memory high-water mark and prices the
+// dynamic part of memory, copy, hashing and log instructions.
+type MemoryTracker struct {
+	Words uint64 // highest memory size reached, in 32-byte words
+}
+
+func NewMemoryTracker() *MemoryTracker {
+	return &MemoryTracker{}
+}
+
+// DynamicCost is the operand-dependent gas of one instruction. When Bounded
+// is false some operand could not be resolved and Gas is only a lower bound.
+type DynamicCost struct {
+	Gas     uint64
+	Bounded bool
+}
+
+// memRegion is a memory range read or written by an instruction.
+type memRegion struct {
+	offset, size uint64
+	known        bool
+}
+
+// Charge returns the dynamic gas of op given the operands currently on the
+// engine's stack, and raises the high-water mark. It must be called before
+// the instruction is applied to the engine.
+func (mt *MemoryTracker) Charge(op vm.OpCode, engine *StackEngine, schedule *GasSchedule) DynamicCost {
+	arg := func(n int) (uint64, bool) {
+		v, ok := engine.PeekKnown(n)
+		return v, ok && v <= maxModelledMemory
+	}
+	region := func(offArg, sizeArg int) memRegion {
+		size, sizeOK := arg(sizeArg)
+		if sizeOK && size == 0 {
+			return memRegion{known: true}
+		}
+		off, offOK := arg(offArg)
+		return memRegion{offset: off, size: size, known: offOK && sizeOK}
+	}
+	fixed := func(offArg int, size uint64) memRegion {
+		off, ok := arg(offArg)
+		return memRegion{offset: off, size: size, known: ok}
+	}
+	// perWord charges cost for every 32-byte word of the size operand.
+	perWord := func(sizeArg int, cost uint64) (uint64, bool) {
+		size, ok := arg(sizeArg)
+		if !ok {
+			return 0, false
+		}
+		return toWords(size) * cost, true
+	}
+
+	var regions []memRegion
+	var extra uint64
+	extraKnown := true
+
+	switch {
+	case op == vm.MLOAD || op == vm.MSTORE:
+		regions = append(regions, fixed(0, 32))
+	case op == vm.MSTORE8:
+		regions = append(regions, fixed(0, 1))
+	case op == vm.KECCAK256:
+		regions = append(regions, region(0, 1))
+		extra, extraKnown = perWord(1, params.Keccak256WordGas)
+	case op == vm.CALLDATACOPY || op == vm.CODECOPY || op == vm.RETURNDATACOPY:
+		regions = append(regions, region(0, 2))
+		extra, extraKnown = perWord(2, params.CopyGas)
+	case op == vm.EXTCODECOPY:
+		regions = append(regions, region(1, 3))
+		extra, extraKnown = perWord(3, params.CopyGas)
+	case op == vm.MCOPY:
+		regions = append(regions, region(0, 2), region(1, 2))
+		extra, extraKnown = perWord(2, params.CopyGas)
+	case op >= vm.LOG0 && op <= vm.LOG4:
+		regions = append(regions, region(0, 1))
+		if size, ok := arg(1); ok {
+			extra = size * params.LogDataGas
+		} else {
+			extraKnown = false
+		}
+	case op == vm.RETURN || op == vm.REVERT:
+		regions = append(regions, region(0, 1))
+	case op == vm.CALL || op == vm.CALLCODE:
+		regions = append(regions, region(3, 4), region(5, 6))
+	case op == vm.DELEGATECALL || op == vm.STATICCALL:
+		regions = append(regions, region(2, 3), region(4, 5))
+	case op == vm.CREATE || op == vm.CREATE2:
+		regions = append(regions, region(1, 2))
+		var perWordCost uint64
+		if op == vm.CREATE2 {
+			perWordCost += params.Keccak256WordGas
+		}
+		if schedule.IsAtLeast("shanghai") {
+			perWordCost += params.InitCodeWordGas
+		}
+		if perWordCost > 0 {
+			extra, extraKnown = perWord(2, perWordCost)
+		}
+	case schedule.eof && op == vm.DATACOPY:
+		regions = append(regions, region(0, 2))
+		extra, extraKnown = perWord(2, params.CopyGas)
+	case schedule.eof && op == vm.EOFCREATE:
+		regions = append(regions, region(2, 3))
+	case schedule.eof && op == vm.RETURNCONTRACT:
+		regions = append(regions, region(0, 1))
+	case schedule.eof && (op == vm.EXTCALL || op == vm.EXTDELEGATECALL || op == vm.EXTSTATICCALL):
+		regions = append(regions, region(1, 2))
+	default:
+		return DynamicCost{Bounded: true}
+	}
+
+	cost := DynamicCost{Gas: extra, Bounded: extraKnown}
+	for _, r := range regions {
+		if !r.known {
+			cost.Bounded = false
+			continue
+		}
+		if r.size == 0 {
+			continue
+		}
+		words := toWords(r.offset + r.size)
+		if words > mt.Words {
+			cost.Gas += memoryCost(words) - memoryCost(mt.Words)
+			mt.Words = words
+		}
+	}
+	return cost
+}
+
+// memoryCost is the total cost of a memory of the given size in words:
+// 3 gas per word plus the quadratic term words²/512.
+func memoryCost(words uint64) uint64 {
+	return words*params.MemoryGas + words*words/params.QuadCoeffDiv
+}
+
+func toWords(size uint64) uint64 {
+	return (size + 31) / 32
+}
@@ -0,0 +1,342 @@
+package analyzer
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// PackingAdvice proposes merging fixed slots whose variables are always
+// accessed together by the same functions but live in different slots.
+// Gas is estimated under EIP-2929 pricing, assuming each write resets a
+// nonzero value.
+type PackingAdvice struct {
+	Slots   []PackedSlot     `json:"proposed_slots"`
+	Savings []PackingSavings `json:"savings"`
+}
+
+// PackedSlot is one slot of the proposed layout and what moves into it.
+type PackedSlot struct {
+	Slot      string           `json:"slot"`
+	Bytes     int              `json:"bytes"`
+	Variables []PackedVariable `json:"variables"`
+}
+
+// PackedVariable is a slot's current contents, placed at Offset in the
+// proposed slot. Name is only known from a storage layout.
+type PackedVariable struct {
+	Name     string `json:"name,omitempty"`
+	FromSlot string `json:"from_slot"`
+	Offset   int    `json:"offset"`
+	Bytes    int    `json:"bytes"`
+}
+
+// Label names the variable, e.g. "slot 3" or "count, owner (slot 3)".
+func (v PackedVariable) Label() string {
+	if v.Name == "" {
+		return "slot " + v.FromSlot
+	}
+	return fmt.Sprintf("%s (slot %s)", v.Name, v.FromSlot)
+}
+
+// PackingSavings is the gas one function saves with the proposed layout.
+type PackingSavings struct {
+	Function string `json:"function"`
+	Selector string `json:"selector,omitempty"`
+	GasSaved uint64 `json:"gas_saved"`
+}
+
+// slotAccess is one SLOAD or SSTORE of a slot.
+type slotAccess struct {
+	pc    int
+	slot  string
+	write bool
+}
+
+// packedField is a field of a fixed slot seen through a mask.
+type packedField struct {
+	offset, bytes int
+}
+
+// noteMask records the field a mask selects when it is applied to a word
+// read from a fixed slot: and(shr(s, sload(n)), 2^k-1) reads k bits at s,
+// and and(sload(n), not(2^k-1 << s)) clears them before a write.
+func (st *StorageTracker) noteMask(a, b Value) {
+	word, mask := a, b
+	if word.src.slot == "" {
+		word, mask = b, a
+	}
+	if word.src.slot == "" || !mask.IsConcrete() {
+		return
+	}
+	m := mask.Word()
+	shift := word.src.shift
+	if shift == 0 && m[3]>>63 == 1 {
+		// A clearing mask: the field is the run of zeros.
+		m.Not(m)
+		shift = uint64(trailingZeros(m))
+		m.Rsh(m, uint(shift))
+	}
+	width := m.BitLen()
+	ones := new(uint256.Int).Lsh(uint256.NewInt(1), uint(width))
+	ones.SubUint64(ones, 1)
+	if width == 0 || width%8 != 0 || shift%8 != 0 || !m.Eq(ones) || shift+uint64(width) > 256 {
+		return
+	}
+	f := packedField{offset: int(shift / 8), bytes: width / 8}
+	for _, seen := range st.fields[word.src.slot] {
+		if seen == f {
+			return
+		}
+	}
+	st.fields[word.src.slot] = append(st.fields[word.src.slot], f)
+}
+
+func trailingZeros(w *uint256.Int) int {
+	for i, limb := range w {
+		if limb != 0 {
+			return i*64 + bits.TrailingZeros64(limb)
+		}
+	}
+	return 256
+}
+
+// packingUnit is a fixed slot the advisor may merge with others.
+type packingUnit struct {
+	slot  string
+	name  string
+	bytes int
+	// reads and writes are indexed by function.
+	reads, writes map[int]bool
+}
+
+// functionScope is a function and the pcs reachable from its entry.
+type functionScope struct {
+	label, selector string
+	pcs             map[int]bool
+}
+
+// advisePacking groups the under-filled fixed slots accessed by exactly the
+// same functions, packs each group into as few slots as fit, and prices
+// what every function saves. It returns nil when there is nothing to merge.
+func (a *analysis) advisePacking() *PackingAdvice {
+	st := a.storage
+	functions := a.functionScopes()
+	if len(functions) == 0 {
+		return nil
+	}
+
+	units := map[string]*packingUnit{}
+	for _, acc := range st.accesses {
+		bytes, name, ok := st.slotWidth(acc.slot)
+		if !ok {
+			continue
+		}
+		u := units[acc.slot]
+		if u == nil {
+			u = &packingUnit{slot: acc.slot, name: name, bytes: bytes, reads: map[int]bool{}, writes: map[int]bool{}}
+			units[acc.slot] = u
+		}
+		for i, fn := range functions {
+			if !fn.pcs[acc.pc] {
+				continue
+			}
+			if acc.write {
+				u.writes[i] = true
+			} else {
+				u.reads[i] = true
+			}
+		}
+	}
+
+	// Slots belong together when the same functions touch them.
+	groups := map[string][]*packingUnit{}
+	for _, u := range units {
+		if key := u.functionKey(); key != "" {
+			groups[key] = append(groups[key], u)
+		}
+	}
+	var bins [][]*packingUnit
+	for _, g := range groups {
+		bins = append(bins, packUnits(g)...)
+	}
+	sort.Slice(bins, func(i, j int) bool { return slotLess(bins[i][0].slot, bins[j][0].slot) })
+
+	advice := &PackingAdvice{}
+	saved := make([]uint64, len(functions))
+	for _, bin := range bins {
+		if len(bin) < 2 {
+			continue
+		}
+		slot := PackedSlot{Slot: bin[0].slot}
+		for _, u := range bin {
+			slot.Variables = append(slot.Variables, PackedVariable{Name: u.name, FromSlot: u.slot, Offset: slot.Bytes, Bytes: u.bytes})
+			slot.Bytes += u.bytes
+		}
+		advice.Slots = append(advice.Slots, slot)
+		for i := range functions {
+			saved[i] += binSavings(bin, i)
+		}
+	}
+	if len(advice.Slots) == 0 {
+		return nil
+	}
+	for i, fn := range functions {
+		if saved[i] > 0 {
+			advice.Savings = append(advice.Savings, PackingSavings{Function: fn.label, Selector: fn.selector, GasSaved: saved[i]})
+		}
+	}
+	sort.SliceStable(advice.Savings, func(i, j int) bool { return advice.Savings[i].GasSaved > advice.Savings[j].GasSaved })
+	return advice
+}
+
+// functionScopes returns the discovered functions, or the whole code as
+// one function when there is no dispatcher.
+func (a *analysis) functionScopes() []functionScope {
+	if a.cfg == nil || len(a.cfg.Blocks) == 0 {
+		return nil
+	}
+	fns := a.functionTracker.Functions
+	if len(fns) == 0 {
+		fns = []FunctionInfo{{Selector: "", EntryPC: a.cfg.Blocks[0].Start}}
+	}
+	var out []functionScope
+	for _, fn := range fns {
+		pf := functionScope{label: fn.Label(), selector: fn.Selector, pcs: map[int]bool{}}
+		if fn.Selector == "" {
+			pf.label = "all code"
+		}
+		for _, b := range a.cfg.ReachableFrom(fn.EntryPC) {
+			for _, ins := range b.Instructions {
+				pf.pcs[ins.PC] = true
+			}
+		}
+		out = append(out, pf)
+	}
+	return out
+}
+
+// slotWidth returns how many bytes of a fixed slot are used, from the
+// layout when one is loaded and otherwise from the masks seen, the names of
+// its variables if the layout gives them, and whether it may move.
+func (st *StorageTracker) slotWidth(key string) (int, string, bool) {
+	if st.Layout != nil {
+		w, ok := slotWord(key)
+		if !ok {
+			return 0, "", false
+		}
+		for _, s := range st.Layout.Slots() {
+			if s.Slot.Eq(w) {
+				return s.Used, fieldNames(s.Fields), s.Movable && s.Used < 32
+			}
+		}
+		return 0, "", false
+	}
+	fields := st.fields[key]
+	if len(fields) == 0 {
+		return 0, "", false
+	}
+	used := 0
+	for _, f := range fields {
+		used = max(used, f.offset+f.bytes)
+	}
+	return used, "", used < 32
+}
+
+// functionKey identifies the set of functions that touch u.
+func (u *packingUnit) functionKey() string {
+	var ids []int
+	for i := range u.reads {
+		ids = append(ids, i)
+	}
+	for i := range u.writes {
+		if !u.reads[i] {
+			ids = append(ids, i)
+		}
+	}
+	sort.Ints(ids)
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// packUnits bin-packs units into 32-byte slots, largest first, and orders
+// each bin by current slot.
+func packUnits(units []*packingUnit) [][]*packingUnit {
+	sort.Slice(units, func(i, j int) bool {
+		if units[i].bytes != units[j].bytes {
+			return units[i].bytes > units[j].bytes
+		}
+		return slotLess(units[i].slot, units[j].slot)
+	})
+	var bins [][]*packingUnit
+	var used []int
+	for _, u := range units {
+		placed := false
+		for i := range bins {
+			if used[i]+u.bytes <= 32 {
+				bins[i] = append(bins[i], u)
+				used[i] += u.bytes
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			bins = append(bins, []*packingUnit{u})
+			used = append(used, u.bytes)
+		}
+	}
+	for _, bin := range bins {
+		sort.Slice(bin, func(i, j int) bool { return slotLess(bin[i].slot, bin[j].slot) })
+	}
+	return bins
+}
+
+// binSavings is the gas function fn saves when the slots of bin are merged:
+// every slot it touches costs a cold access and every slot it writes a
+// reset, where the merged slot costs one cold access and at most one
+// reset, plus a warm access for each further variable.
+func binSavings(bin []*packingUnit, fn int) uint64 {
+	const (
+		cold  = params.ColdSloadCostEIP2929
+		warm  = params.WarmStorageReadCostEIP2929
+		reset = params.SstoreResetGasEIP2200 - params.ColdSloadCostEIP2929
+	)
+	var before, after uint64
+	touched, written := 0, false
+	for _, u := range bin {
+		if !u.reads[fn] && !u.writes[fn] {
+			continue
+		}
+		touched++
+		before += cold
+		if u.writes[fn] {
+			before += reset
+			written = true
+		}
+	}
+	if touched < 2 {
+		return 0
+	}
+	after = cold + uint64(touched-1)*warm
+	if written {
+		after += reset
+	}
+	return before - after
+}
+
+// slotLess orders slot keys numerically where they are numbers.
+func slotLess(a, b string) bool {
+	x, xOK := slotWord(a)
+	y, yOK := slotWord(b)
+	if xOK && yOK {
+		return x.Lt(y)
+	}
+	return a < b
+}
@@ -0,0 +1,79 @@
+package analyzer
+
+import (
+	"testing"
+
+	"gaslens/disasm"
+)
+
+func TestAdvisePacking(t *testing.T) {
+	// 0: CALLVALUE  1: PUSH1 12  3: JUMPI
+	// 4..10: seven PUSH0s  11: STOP (0xaaaaaaaa)
+	// 12: JUMPDEST  13..20: eight PUSH0s (0xbbbbbbbb)
+	code := []byte{0x34, 0x60, 0x0c, 0x57}
+	for range 7 {
+		code = append(code, 0x5f)
+	}
+	code = append(code, 0x00, 0x5b)
+	for range 8 {
+		code = append(code, 0x5f)
+	}
+
+	a := newAnalysis()
+	a.cfg = BuildCFG(disasm.Disassemble(code))
+	a.functionTracker.Functions = []FunctionInfo{{Selector: "0xaaaaaaaa", EntryPC: 4}, {Selector: "0xbbbbbbbb", EntryPC: 12}}
+	st := a.storage
+	st.fields = map[string][]packedField{
+		"0": {{0, 8}},         // uint64
+		"1": {{0, 20}},        // address
+		"2": {{0, 8}},         // uint64
+		"3": {{0, 4}, {4, 4}}, // two uint32
+		"4": {{0, 32}},        // full word, never moved
+		"5": {{0, 8}},         // does not fit with 0 and 1
+		"6": {{0, 8}},         // touched by both functions
+		"7": {{0, 16}},        // uint128
+	}
+	st.accesses = []slotAccess{
+		{pc: 4, slot: "0"}, {pc: 5, slot: "1"}, {pc: 6, slot: "1", write: true},
+		{pc: 7, slot: "4"}, {pc: 8, slot: "5"}, {pc: 9, slot: "6"},
+		{pc: 13, slot: "2"}, {pc: 14, slot: "3", write: true}, {pc: 15, slot: "7"},
+		{pc: 16, slot: "4"}, {pc: 17, slot: "6"},
+	}
+
+	advice := a.advisePacking()
+	if advice == nil {
+		t.Fatal("no packing advice")
+	}
+	want := []PackedSlot{
+		{Slot: "0", Bytes: 28, Variables: []PackedVariable{{FromSlot: "0", Offset: 0, Bytes: 8}, {FromSlot: "1", Offset: 8, Bytes: 20}}},
+		{Slot: "2", Bytes: 32, Variables: []PackedVariable{{FromSlot: "2", Offset: 0, Bytes: 8}, {FromSlot: "3", Offset: 8, Bytes: 8}, {FromSlot: "7", Offset: 16, Bytes: 16}}},
+	}
+	if len(advice.Slots) != len(want) {
+		t.Fatalf("proposed slots = %+v, want %+v", advice.Slots, want)
+	}
+	for i, s := range advice.Slots {
+		if s.Slot != want[i].Slot || s.Bytes != want[i].Bytes || len(s.Variables) != len(want[i].Variables) {
+			t.Errorf("slot %d = %+v, want %+v", i, s, want[i])
+			continue
+		}
+		for j, v := range s.Variables {
+			if v != want[i].Variables[j] {
+				t.Errorf("slot %s variable %d = %+v, want %+v", s.Slot, j, v, want[i].Variables[j])
+			}
+		}
+	}
+
+	// Each further slot in a merged slot is a warm instead of a cold access.
+	wantSavings := []PackingSavings{
+		{Function: "0xbbbbbbbb", Selector: "0xbbbbbbbb", GasSaved: 2 * (2100 - 100)},
+		{Function: "0xaaaaaaaa", Selector: "0xaaaaaaaa", GasSaved: 2100 - 100},
+	}
+	if len(advice.Savings) != len(wantSavings) {
+		t.Fatalf("savings = %+v, want %+v", advice.Savings, wantSavings)
+	}
+	for i, s := range advice.Savings {
+		if s != wantSavings[i] {
+			t.Errorf("savings %d = %+v, want %+v", i, s, wantSavings[i])
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+const (
+	// maxCallDepth bounds how deeply nested internal calls a path follows.
+	maxCallDepth = 16
+	// maxPathStates bounds how many block and call stack pairs are explored
+	// per function.
+	maxPathStates = 1 << 16
+	// maxCountedIterations is the largest constant loop bound whose
+	// iterations are added to a path; larger loops are left per-iteration.
+	maxCountedIterations = 1 << 16
+)
+
+// pathNode is a block entered with the call sites of the internal
+// functions the path is inside, innermost last.
+type pathNode struct {
+	block int
+	calls []int
+}
+
+func (n pathNode) key() string {
+	return fmt.Sprint(n.block, n.calls)
+}
+
+// pathCost is the cheapest and most expensive way from a node to a halt.
+type pathCost struct {
+	min, max uint64
+	found    bool
+	worst    *pathNode // the next node on the most expensive path
+}
+
+// pathFinder prices acyclic paths through the CFG. Returns only go back to
+// the call site that entered the function, and loop back edges are not
+// taken: a loop with a constant bound is charged its iterations at its
+// header, any other loop is left out and listed per iteration.
+type pathFinder struct {
+	g         *CFG
+	gasByPC   map[int]uint64
+	loops     map[int]Loop
+	backEdges map[Edge]bool
+	callSites map[int]bool
+	memo      map[string]*pathCost
+	onPath    map[string]bool
+}
+
+func newPathFinder(g *CFG, gasByPC map[int]uint64, loops []Loop) *pathFinder {
+	pf := &pathFinder{g: g, gasByPC: gasByPC, loops: map[int]Loop{}, backEdges: map[Edge]bool{}, callSites: map[int]bool{}}
+	for _, l := range loops {
+		pf.loops[l.StartPC] = l
+	}
+	for _, nl := range g.naturalLoops() {
+		for start := range nl.body {
+			for _, e := range g.Block(start).Succs {
+				if e.To == nl.header {
+					pf.backEdges[e] = true
+				}
+			}
+		}
+	}
+	for _, b := range g.Blocks {
+		for _, e := range b.Succs {
+			if e.Kind == EdgeReturn {
+				pf.callSites[e.CallSite] = true
+			}
+		}
+	}
+	return pf
+}
+
+// iterations returns how often l runs when its bound is a small constant.
+func (l Loop) iterations() (uint64, bool) {
+	if l.BoundKind != BoundConstant {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(l.Bound, 10, 64)
+	return n, err == nil && n <= maxCountedIterations
+}
+
+// blockGas is the gas of b, plus every iteration of the loop it heads when
+// the loop's bound is known.
+func (pf *pathFinder) blockGas(b *Block) uint64 {
+	var gas uint64
+	for _, ins := range b.Instructions {
+		gas += pf.gasByPC[ins.PC]
+	}
+	if l, ok := pf.loops[b.Start]; ok {
+		if n, ok := l.iterations(); ok {
+			gas += n * l.GasPerIteration
+		}
+	}
+	return gas
+}
+
+// follow returns the node an edge leads to from n. Leaving a block that
+// pushed a return address enters a call; a return must go back to the
+// innermost call site, or anywhere when the path started inside the
+// function.
+func (pf *pathFinder) follow(n pathNode, e Edge) (pathNode, bool) {
+	calls := n.calls
+	switch {
+	case e.Kind == EdgeReturn && len(calls) > 0:
+		if calls[len(calls)-1] != e.CallSite {
+			return pathNode{}, false
+		}
+		calls = calls[:len(calls)-1]
+	case e.Kind != EdgeReturn && pf.callSites[n.block]:
+		if len(calls) >= maxCallDepth {
+			return pathNode{}, false
+		}
+		calls = append(calls[:len(calls):len(calls)], n.block)
+	}
+	return pathNode{block: e.To, calls: calls}, true
+}
+
+func halts(b *Block) bool {
+	switch b.Last().Op {
+	case vm.STOP, vm.RETURN, vm.REVERT, vm.SELFDESTRUCT:
+		return true
+	}
+	return false
+}
+
+// cost returns the cheapest and most expensive paths from n to a halt.
+// Paths that end in an unresolved jump or an invalid instruction are not
+// counted.
+func (pf *pathFinder) cost(n pathNode) *pathCost {
+	k := n.key()
+	if c, ok := pf.memo[k]; ok {
+		return c
+	}
+	c := &pathCost{}
+	if pf.onPath[k] || len(pf.memo) >= maxPathStates {
+		return c
+	}
+	b := pf.g.Block(n.block)
+	if b == nil {
+		return c
+	}
+	gas := pf.blockGas(b)
+	if halts(b) {
+		c.min, c.max, c.found = gas, gas, true
+		pf.memo[k] = c
+		return c
+	}
+	pf.onPath[k] = true
+	for _, e := range b.Succs {
+		if pf.backEdges[e] {
+			continue
+		}
+		next, ok := pf.follow(n, e)
+		if !ok {
+			continue
+		}
+		sub := pf.cost(next)
+		if !sub.found {
+			continue
+		}
+		if !c.found || gas+sub.min < c.min {
+			c.min = gas + sub.min
+		}
+		if !c.found || gas+sub.max > c.max {
+			c.max = gas + sub.max
+			c.worst = &next
+		}
+		c.found = true
+	}
+	delete(pf.onPath, k)
+	pf.memo[k] = c
+	return c
+}
+
+// functionPaths sets fn's cheapest and most expensive path gas, the blocks
+// of the most expensive path, and the loops on it whose iterations are not
+// counted.
+func (pf *pathFinder) functionPaths(fn *FunctionInfo) {
+	pf.memo = map[string]*pathCost{}
+	pf.onPath = map[string]bool{}
+	n := pathNode{block: fn.EntryPC}
+	c := pf.cost(n)
+	if !c.found {
+		return
+	}
+	fn.MinGas, fn.MaxGas = c.min, c.max
+	for {
+		fn.WorstPath = append(fn.WorstPath, n.block)
+		if l, ok := pf.loops[n.block]; ok {
+			if _, counted := l.iterations(); !counted && !slices.ContainsFunc(fn.OpenLoops, func(o Loop) bool { return o.StartPC == l.StartPC }) {
+				fn.OpenLoops = append(fn.OpenLoops, l)
+			}
+		}
+		if c.worst == nil {
+			return
+		}
+		n = *c.worst
+		c = pf.memo[n.key()]
+	}
+}
+
+// AttributePaths prices the cheapest and most expensive acyclic path from
+// each function's entry to a STOP, RETURN, REVERT or SELFDESTRUCT.
+func (ft *FunctionTracker) AttributePaths(g *CFG, gasByPC map[int]uint64, loops []Loop) {
+	if g == nil || len(ft.Functions) == 0 {
+		return
+	}
+	pf := newPathFinder(g, gasByPC, loops)
+	for i := range ft.Functions {
+		pf.functionPaths(&ft.Functions[i])
+	}
+}
+
+// PathSummary describes a function's path gas, e.g. "120-4500 gas" or
+// "120-4500 gas, + ≈261 per iteration of the loop at PC 291".
+func (fn FunctionInfo) PathSummary() string {
+	if fn.MaxGas == 0 {
+		return ""
+	}
+	s := fmt.Sprintf("%d-%d gas", fn.MinGas, fn.MaxGas)
+	for _, l := range fn.OpenLoops {
+		s += fmt.Sprintf(", + ≈%d per iteration of the loop at PC %d", l.GasPerIteration, l.StartPC)
+	}
+	return s
+}
+
+// joinPCs formats pcs as "0 -> 12 -> 45".
+func joinPCs(pcs []int) string {
+	return joinIntsSep(pcs, " -> ")
+}
+
+// joinInts formats ns as "3, 12, 45".
+func joinInts(ns []int) string {
+	return joinIntsSep(ns, ", ")
+}
+
+func joinIntsSep(ns []int, sep string) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, sep)
+}
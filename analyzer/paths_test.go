@@ -0,0 +1,98 @@
+package analyzer
+
+import (
+	"slices"
+	"testing"
+
+	"gaslens/disasm"
+)
+
+// countedLoop is the loop at pc 1 of the loop fixture below.
+//
+//	0: PUSH0  1: JUMPDEST  2: CALLVALUE  3: PUSH1 9  5: JUMPI
+//	6: PUSH1 1  8: JUMP  9: JUMPDEST  10: STOP
+var countedLoop = []byte{0x5f, 0x5b, 0x34, 0x60, 0x09, 0x57, 0x60, 0x01, 0x56, 0x5b, 0x00}
+
+func TestFunctionPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  []byte
+		entry int
+		gas   map[int]uint64 // by the pc of each block's first instruction
+		loops []Loop
+		min   uint64
+		max   uint64
+		worst []int
+		open  []int
+	}{
+		{
+			name: "diamond",
+			// 0: CALLVALUE  1: PUSH1 10  3: JUMPI  4: PUSH1 13  6: JUMP
+			// 7: INVALID  8: INVALID  9: INVALID
+			// 10: JUMPDEST  11: PUSH0  12: POP  13: JUMPDEST  14: STOP
+			code:  []byte{0x34, 0x60, 0x0a, 0x57, 0x60, 0x0d, 0x56, 0xfe, 0xfe, 0xfe, 0x5b, 0x5f, 0x50, 0x5b, 0x00},
+			gas:   map[int]uint64{0: 1, 4: 10, 10: 100, 13: 1000},
+			min:   1011,
+			max:   1101,
+			worst: []int{0, 10, 13},
+		},
+		{
+			name:  "constant loop charged at its header",
+			code:  countedLoop,
+			gas:   map[int]uint64{0: 1, 1: 10, 6: 20, 9: 100},
+			loops: []Loop{{StartPC: 1, GasPerIteration: 50, Bound: "3", BoundKind: BoundConstant}},
+			min:   1 + 10 + 3*50 + 100,
+			max:   1 + 10 + 3*50 + 100,
+			worst: []int{0, 1, 9},
+		},
+		{
+			name:  "loop bounded by an input left open",
+			code:  countedLoop,
+			gas:   map[int]uint64{0: 1, 1: 10, 6: 20, 9: 100},
+			loops: []Loop{{StartPC: 1, GasPerIteration: 50, Bound: "calldataload(4)", BoundKind: BoundInput}},
+			min:   111,
+			max:   111,
+			worst: []int{0, 1, 9},
+			open:  []int{1},
+		},
+		{
+			name: "helper returns to its own caller",
+			// 0: CALLVALUE  1: PUSH1 11  3: JUMPI
+			// 4: PUSH1 9  6: PUSH1 19  8: JUMP  9: JUMPDEST  10: STOP
+			// 11: JUMPDEST  12: PUSH1 17  14: PUSH1 19  16: JUMP  17: JUMPDEST  18: STOP
+			// 19: JUMPDEST  20: JUMP
+			code: []byte{
+				0x34, 0x60, 0x0b, 0x57,
+				0x60, 0x09, 0x60, 0x13, 0x56, 0x5b, 0x00,
+				0x5b, 0x60, 0x11, 0x60, 0x13, 0x56, 0x5b, 0x00,
+				0x5b, 0x56,
+			},
+			entry: 4,
+			gas:   map[int]uint64{0: 1, 4: 10, 9: 100, 11: 1000, 17: 10000, 19: 5},
+			// returning to 17 would cost 10015
+			min:   115,
+			max:   115,
+			worst: []int{4, 19, 9},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := BuildCFG(disasm.Disassemble(tt.code))
+			fn := FunctionInfo{EntryPC: tt.entry}
+			newPathFinder(g, tt.gas, tt.loops).functionPaths(&fn)
+			if fn.MinGas != tt.min || fn.MaxGas != tt.max {
+				t.Errorf("path gas = %d-%d, want %d-%d", fn.MinGas, fn.MaxGas, tt.min, tt.max)
+			}
+			if !slices.Equal(fn.WorstPath, tt.worst) {
+				t.Errorf("worst path = %v, want %v", fn.WorstPath, tt.worst)
+			}
+			var open []int
+			for _, l := range fn.OpenLoops {
+				open = append(open, l.StartPC)
+			}
+			if !slices.Equal(open, tt.open) {
+				t.Errorf("open loops at %v, want %v", open, tt.open)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gaslens/layout"
+	"gaslens/signatures"
+	"gaslens/srcmap"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ProfileArgs maps a function name or signature to the argument sets it is
+// called with. Each argument set holds one JSON value per input. A name
+// shared by overloads gives each set to the overload taking as many inputs.
+type ProfileArgs map[string][][]json.RawMessage
+
+// ProfileOptions describes the calls made by ProfileBytecode.
+type ProfileOptions struct {
+	Detailed   bool
+	Schedule   *GasSchedule
+	Signatures *signatures.DB
+	Layout     *layout.Layout
+	SourceMap  *srcmap.Map
+	ABI        abi.ABI
+	Args       ProfileArgs
+	Caller     common.Address
+	GasLimit   uint64
+}
+
+// ProfileCall is one call made while profiling a function. Gas is the
+// transaction gas: intrinsic plus execution gas, less the refund.
+type ProfileCall struct {
+	Label    string        `json:"label"`
+	Calldata hexutil.Bytes `json:"calldata"`
+	Gas      uint64        `json:"gas"`
+	Reverted bool          `json:"reverted"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// FunctionProfile summarises the calls made to one ABI function. Reverted
+// calls, and argument sets that could not be encoded, are listed but left
+// out of the min, average and max.
+type FunctionProfile struct {
+	Name      string        `json:"name"`
+	Signature string        `json:"signature"`
+	Selector  string        `json:"selector"`
+	MinGas    uint64        `json:"min_gas"`
+	AvgGas    uint64        `json:"avg_gas"`
+	MaxGas    uint64        `json:"max_gas"`
+	Reverts   int           `json:"reverts"`
+	Invalid   int           `json:"invalid,omitempty"`
+	Calls     []ProfileCall `json:"calls"`
+}
+
+// ProfileBytecode calls every function in the ABI, each call against a
+// fresh empty state, and reports the gas per function.
+func ProfileBytecode(code []byte, opts ProfileOptions) error {
+	static, err := analyze(code, opts.Schedule)
+	if err != nil {
+		return err
+	}
+	profiles, err := profile(code, static, opts)
+	if err != nil {
+		return err
+	}
+	static.name(opts.Signatures)
+	static.applyLayout(opts.Layout)
+	static.applySourceMap(opts.SourceMap)
+	static.report.Profiles = profiles
+	PrintProfileReport(static.report, opts.Detailed)
+	static.export("")
+	return nil
+}
+
+func profile(code []byte, static *analysis, opts ProfileOptions) ([]FunctionProfile, error) {
+	sets, err := assignArgs(opts.ABI, opts.Args)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range opts.ABI.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var profiles []FunctionProfile
+	for _, name := range names {
+		method := opts.ABI.Methods[name]
+		calls, err := profileCalls(method, sets[method.Sig])
+		if err != nil {
+			return nil, err
+		}
+		p := FunctionProfile{
+			Name:      method.Name,
+			Signature: method.Sig,
+			Selector:  hexutil.Encode(method.ID),
+		}
+		var total uint64
+		for _, call := range calls {
+			if call.Calldata == nil {
+				p.Calls = append(p.Calls, call)
+				p.Invalid++
+				continue
+			}
+			a, err := execute(code, static, ExecOptions{
+				Schedule: opts.Schedule,
+				Calldata: call.Calldata,
+				Caller:   opts.Caller,
+				GasLimit: opts.GasLimit,
+			})
+			if err != nil {
+				return nil, err
+			}
+			result := a.report.Execution
+			call.Gas, call.Reverted, call.Error = result.TransactionGas, result.Reverted, result.Error
+			p.Calls = append(p.Calls, call)
+			if call.Reverted {
+				p.Reverts++
+				continue
+			}
+			if p.MinGas == 0 || call.Gas < p.MinGas {
+				p.MinGas = call.Gas
+			}
+			p.MaxGas = max(p.MaxGas, call.Gas)
+			total += call.Gas
+		}
+		if succeeded := len(p.Calls) - p.Reverts - p.Invalid; succeeded > 0 {
+			p.AvgGas = total / uint64(succeeded)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// assignArgs files every argument set under the signature of the method it
+// calls. A key is a signature, a name in the source, or a method name as
+// go-ethereum gives it (transfer0 for the second transfer). A set under an
+// overloaded name goes to the one overload taking as many inputs, and is
+// rejected when none or several do.
+func assignArgs(contract abi.ABI, args ProfileArgs) (map[string][][]json.RawMessage, error) {
+	var keys []string
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bySig := map[string][][]json.RawMessage{}
+	for _, key := range keys {
+		candidates := methodsNamed(contract, key)
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("arguments given for %q, which is not a function in the ABI", key)
+		}
+		for i, set := range args[key] {
+			method := candidates[0]
+			if len(candidates) > 1 {
+				var fits []abi.Method
+				for _, m := range candidates {
+					if len(m.Inputs) == len(set) {
+						fits = append(fits, m)
+					}
+				}
+				if len(fits) != 1 {
+					var sigs []string
+					for _, m := range candidates {
+						sigs = append(sigs, m.Sig)
+					}
+					return nil, fmt.Errorf("argument set %d for %q: %d of its overloads take %d arguments; give one of %s instead",
+						i+1, key, len(fits), len(set), strings.Join(sigs, ", "))
+				}
+				method = fits[0]
+			}
+			bySig[method.Sig] = append(bySig[method.Sig], set)
+		}
+	}
+	return bySig, nil
+}
+
+// methodsNamed returns the method whose signature is key, or every overload
+// whose source name is key, or the method go-ethereum calls key.
+func methodsNamed(contract abi.ABI, key string) []abi.Method {
+	var named []abi.Method
+	for _, m := range contract.Methods {
+		if m.Sig == key {
+			return []abi.Method{m}
+		}
+		if m.RawName == key {
+			named = append(named, m)
+		}
+	}
+	if len(named) == 0 {
+		if m, ok := contract.Methods[key]; ok {
+			named = append(named, m)
+		}
+	}
+	sort.Slice(named, func(i, j int) bool { return named[i].Sig < named[j].Sig })
+	return named
+}
+
+// profileCalls returns the calls for method: one per argument set, or
+// generated samples when there are none. A set that cannot be encoded
+// becomes a call without calldata that records why.
+func profileCalls(method abi.Method, sets [][]json.RawMessage) ([]ProfileCall, error) {
+	if len(sets) == 0 {
+		return SampleCalls(method)
+	}
+	calls := make([]ProfileCall, len(sets))
+	for i, set := range sets {
+		calls[i] = ProfileCall{Label: fmt.Sprintf("argument set %d", i+1)}
+		data, err := EncodeCall(method, set)
+		if err != nil {
+			calls[i].Error = err.Error()
+			continue
+		}
+		calls[i].Calldata = data
+	}
+	return calls, nil
+}
+
+// PrintProfileReport shows min, average and max gas for every profiled
+// function, and each call when detailed is set.
+func PrintProfileReport(report *AnalysisReport, detailed bool) {
+	fmt.Println("\n📊 FUNCTION GAS PROFILE")
+	fmt.Println("================================")
+	fmt.Printf("⛓️  Priced Under: %s rules (transaction gas per call)\n\n", report.Fork)
+	if len(report.Profiles) == 0 {
+		fmt.Println("No functions in the ABI")
+		return
+	}
+
+	fmt.Printf("%-40s %10s %10s %10s  %s\n", "Function", "Min", "Avg", "Max", "Calls")
+	for _, p := range report.Profiles {
+		calls := fmt.Sprintf("%d", len(p.Calls))
+		if p.Reverts > 0 {
+			calls += fmt.Sprintf(" (%d reverted)", p.Reverts)
+		}
+		if p.Invalid > 0 {
+			calls += fmt.Sprintf(" (%d not encodable)", p.Invalid)
+		}
+		if p.Reverts+p.Invalid == len(p.Calls) {
+			fmt.Printf("%-40s %10s %10s %10s  %s\n", p.Signature, "-", "-", "-", calls)
+		} else {
+			fmt.Printf("%-40s %10d %10d %10d  %s\n", p.Signature, p.MinGas, p.AvgGas, p.MaxGas, calls)
+		}
+		if !detailed {
+			continue
+		}
+		for _, call := range p.Calls {
+			status := fmt.Sprintf("%d gas", call.Gas)
+			switch {
+			case call.Calldata == nil:
+				status = "not called ❌ " + call.Error
+			case call.Reverted:
+				status += " ❌ " + call.Error
+			}
+			fmt.Printf("    %-20s %s\n", call.Label+":", status)
+			if call.Calldata != nil {
+				fmt.Printf("    %-20s %s\n", "", call.Calldata)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+const overloadedABI = `[
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[],"stateMutability":"nonpayable"},
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"}],"outputs":[],"stateMutability":"nonpayable"},
+	{"type":"function","name":"pause","inputs":[],"outputs":[],"stateMutability":"nonpayable"}
+]`
+
+// argSet builds an argument set from JSON values.
+func argSet(values ...string) []json.RawMessage {
+	set := make([]json.RawMessage, len(values))
+	for i, v := range values {
+		set[i] = json.RawMessage(v)
+	}
+	return set
+}
+
+func TestAssignArgs(t *testing.T) {
+	contract, err := abi.JSON(strings.NewReader(overloadedABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := `"0x0000000000000000000000000000000000000001"`
+	tests := []struct {
+		name string
+		args ProfileArgs
+		want map[string]int // sets per signature
+		err  string
+	}{
+		{
+			name: "overloaded name split by arity",
+			args: ProfileArgs{"transfer": {argSet(to, "1"), argSet(to), argSet(to, "2")}},
+			want: map[string]int{"transfer(address,uint256)": 2, "transfer(address)": 1},
+		},
+		{
+			name: "signature and go-ethereum name",
+			args: ProfileArgs{"transfer(address)": {argSet(to)}, "transfer0": {argSet(to)}, "pause": {argSet()}},
+			want: map[string]int{"transfer(address)": 2, "pause()": 1},
+		},
+		{
+			name: "no overload fits",
+			args: ProfileArgs{"transfer": {argSet()}},
+			err:  "give one of transfer(address), transfer(address,uint256)",
+		},
+		{
+			name: "unknown function",
+			args: ProfileArgs{"mint": {argSet("1")}},
+			err:  `"mint", which is not a function`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := assignArgs(contract, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("assigned %d signatures, want %v", len(got), tt.want)
+			}
+			for sig, n := range tt.want {
+				if len(got[sig]) != n {
+					t.Errorf("%s has %d argument sets, want %d", sig, len(got[sig]), n)
+				}
+			}
+		})
+	}
+}
+
+func TestProfileCallsKeepsBadSets(t *testing.T) {
+	contract, err := abi.JSON(strings.NewReader(overloadedABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	method := contract.Methods["transfer0"]
+	if method.Sig != "transfer(address)" {
+		method = contract.Methods["transfer"]
+	}
+	calls, err := profileCalls(method, [][]json.RawMessage{
+		argSet(`"0x0000000000000000000000000000000000000001"`),
+		argSet(`"not an address"`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0].Calldata == nil || calls[0].Error != "" {
+		t.Fatalf("calls = %+v, want the first set encoded", calls)
+	}
+	if calls[1].Calldata != nil || calls[1].Error == "" {
+		t.Errorf("second call = %+v, want no calldata and the encoding error", calls[1])
+	}
+}
@@ -0,0 +1,222 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// RedundantLoad is an SLOAD of a slot that every path to it has already
+// read, with no SSTORE to the slot or external call in between. Keeping the
+// first read on the stack or in memory saves GasSaved each time it runs.
+type RedundantLoad struct {
+	PC       int    `json:"pc"`
+	Slot     string `json:"slot"`
+	FirstPC  int    `json:"first_pc"`
+	Function string `json:"function,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	GasSaved uint64 `json:"gas_saved"`
+	Source   string `json:"source,omitempty"`
+}
+
+// loadedSlots maps each slot known to hold its last read value to the pc
+// of that read. A nil set stands for every slot, the starting point of a
+// block not yet reached by the analysis.
+type loadedSlots map[string]int
+
+func (s loadedSlots) clone() loadedSlots {
+	out := make(loadedSlots, len(s))
+	for k, pc := range s {
+		out[k] = pc
+	}
+	return out
+}
+
+// meet keeps the slots loaded on both sides, with the earlier read.
+func meet(a, b loadedSlots) loadedSlots {
+	if a == nil {
+		return b.clone()
+	}
+	if b == nil {
+		return a.clone()
+	}
+	out := loadedSlots{}
+	for k, pc := range a {
+		if other, ok := b[k]; ok {
+			out[k] = min(pc, other)
+		}
+	}
+	return out
+}
+
+func sameSlots(a, b loadedSlots) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for k, pc := range a {
+		if other, ok := b[k]; !ok || other != pc {
+			return false
+		}
+	}
+	return true
+}
+
+// slotsByPC returns the slot each SLOAD and SSTORE accesses, leaving out
+// pcs whose slot is unknown or was seen to change.
+func (st *StorageTracker) slotsByPC() map[int]string {
+	slots := map[int]string{}
+	ambiguous := map[int]bool{}
+	for _, acc := range st.accesses {
+		if prev, ok := slots[acc.pc]; ok && prev != acc.slot {
+			ambiguous[acc.pc] = true
+		}
+		slots[acc.pc] = acc.slot
+	}
+	for pc := range ambiguous {
+		delete(slots, pc)
+	}
+	return slots
+}
+
+// transfer applies the instructions of b to the slots loaded on entry. A
+// write kills the slot it writes, or every slot when it cannot be told
+// apart from them; an external call or contract creation may write
+// anything. found is called for every read of a slot already loaded.
+func transfer(b *Block, in loadedSlots, slotAt map[int]string, found func(pc, first int, slot string)) loadedSlots {
+	out := in.clone()
+	for _, ins := range b.Instructions {
+		switch {
+		case ins.Op == vm.SLOAD:
+			slot, ok := slotAt[ins.PC]
+			if !ok {
+				continue
+			}
+			if first, loaded := out[slot]; loaded {
+				if found != nil {
+					found(ins.PC, first, slot)
+				}
+				continue
+			}
+			out[slot] = ins.PC
+		case ins.Op == vm.SSTORE:
+			slot, ok := slotAt[ins.PC]
+			if _, fixed := slotWord(slot); ok && fixed {
+				delete(out, slot)
+				continue
+			}
+			for k := range out {
+				// A derived slot may alias any other derived slot.
+				if _, fixed := slotWord(k); !ok || !fixed {
+					delete(out, k)
+				}
+			}
+		case isExternalCall(ins.Op), ins.Op == vm.CREATE, ins.Op == vm.CREATE2,
+			ins.Op == vm.EOFCREATE, ins.Op == vm.SELFDESTRUCT:
+			out = loadedSlots{}
+		}
+	}
+	return out
+}
+
+// findRedundantLoads runs a forward must-dataflow over the CFG: a slot is
+// loaded on entry to a block when it is loaded at the end of every
+// predecessor. Blocks that unresolved jumps may enter start with nothing
+// loaded.
+func (a *analysis) findRedundantLoads() []RedundantLoad {
+	g := a.cfg
+	if g == nil || len(g.Blocks) == 0 {
+		return nil
+	}
+	slotAt := a.storage.slotsByPC()
+	if len(slotAt) == 0 {
+		return nil
+	}
+
+	entry := g.Blocks[0].Start
+	in := map[int]loadedSlots{}
+	out := map[int]loadedSlots{}
+	entryState := func(b *Block) loadedSlots {
+		if b.Start == entry || len(b.Preds) == 0 || (len(g.Unresolved) > 0 && g.JumpDests[b.Start]) {
+			return loadedSlots{}
+		}
+		var state loadedSlots
+		for _, e := range b.Preds {
+			state = meet(state, out[e.From])
+		}
+		return state
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range g.Blocks {
+			if !b.Reachable {
+				continue
+			}
+			state := entryState(b)
+			if state == nil {
+				continue
+			}
+			in[b.Start] = state
+			next := transfer(b, state, slotAt, nil)
+			if !sameSlots(next, out[b.Start]) {
+				out[b.Start] = next
+				changed = true
+			}
+		}
+	}
+
+	gas := params.WarmStorageReadCostEIP2929
+	if s, err := NewGasSchedule(a.report.Fork); err == nil && !s.IsAtLeast("berlin") {
+		gas, _ = s.GetGasCost(vm.SLOAD)
+	}
+	functions := a.functionScopes()
+	var loads []RedundantLoad
+	for _, b := range g.Blocks {
+		state, ok := in[b.Start]
+		if !ok {
+			continue
+		}
+		transfer(b, state, slotAt, func(pc, first int, slot string) {
+			for _, fn := range functions {
+				if !fn.pcs[pc] {
+					continue
+				}
+				loads = append(loads, RedundantLoad{PC: pc, Slot: slot, FirstPC: first,
+					Function: fn.label, Selector: fn.selector, GasSaved: gas})
+			}
+		})
+	}
+	sort.SliceStable(loads, func(i, j int) bool { return loads[i].PC < loads[j].PC })
+	return loads
+}
+
+// cacheSuggestions summarises the redundant reads per function and slot.
+func cacheSuggestions(st *StorageTracker, loads []RedundantLoad) []Suggestion {
+	type key struct{ function, slot string }
+	var order []key
+	groups := map[key][]RedundantLoad{}
+	for _, l := range loads {
+		k := key{l.Function, l.Slot}
+		if groups[k] == nil {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], l)
+	}
+	var out []Suggestion
+	for _, k := range order {
+		var gas uint64
+		pcs := ""
+		for i, l := range groups[k] {
+			gas += l.GasSaved
+			if i > 0 {
+				pcs += ", "
+			}
+			pcs += fmt.Sprint(l.PC)
+		}
+		text := fmt.Sprintf("Cache storage slot %s in %s: re-read at PC %s with nothing written in between (~%d gas)",
+			st.describe(k.slot), k.function, pcs, gas)
+		out = append(out, Suggestion{Text: text, PC: groups[k][0].PC})
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package analyzer
+
+import "testing"
+
+func TestFindRedundantLoads(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		want [][2]int // pc and first pc of each redundant read
+	}{
+		{
+			name: "reload with nothing in between",
+			// 0: PUSH1 1  2: SLOAD  3: PUSH1 1  5: SLOAD  6: STOP
+			code: []byte{0x60, 0x01, 0x54, 0x60, 0x01, 0x54, 0x00},
+			want: [][2]int{{5, 2}},
+		},
+		{
+			name: "reload after a write",
+			// 0: PUSH1 1  2: SLOAD  3: PUSH1 5  5: PUSH1 1  7: SSTORE
+			// 8: PUSH1 1  10: SLOAD  11: STOP
+			code: []byte{0x60, 0x01, 0x54, 0x60, 0x05, 0x60, 0x01, 0x55, 0x60, 0x01, 0x54, 0x00},
+		},
+		{
+			name: "reload after an external call",
+			// 0: PUSH1 1  2: SLOAD  3: PUSH0 x7  10: CALL  11: PUSH1 1  13: SLOAD  14: STOP
+			code: []byte{0x60, 0x01, 0x54, 0x5f, 0x5f, 0x5f, 0x5f, 0x5f, 0x5f, 0x5f, 0xf1, 0x60, 0x01, 0x54, 0x00},
+		},
+		{
+			name: "join where one predecessor loaded the slot",
+			// 0: CALLVALUE  1: PUSH1 8  3: JUMPI  4: PUSH1 1  6: SLOAD  7: POP
+			// 8: JUMPDEST  9: PUSH1 1  11: SLOAD  12: STOP
+			code: []byte{0x34, 0x60, 0x08, 0x57, 0x60, 0x01, 0x54, 0x50, 0x5b, 0x60, 0x01, 0x54, 0x00},
+		},
+		{
+			name: "join where both predecessors loaded the slot",
+			// 0: PUSH1 1  2: SLOAD  3: CALLVALUE  4: PUSH1 11  6: JUMPI
+			// 7: PUSH0  8: POP  9: PUSH0  10: POP  11: JUMPDEST  12: PUSH1 1  14: SLOAD  15: STOP
+			code: []byte{0x60, 0x01, 0x54, 0x34, 0x60, 0x0b, 0x57, 0x5f, 0x50, 0x5f, 0x50, 0x5b, 0x60, 0x01, 0x54, 0x00},
+			want: [][2]int{{14, 2}},
+		},
+	}
+	schedule, err := NewGasSchedule(DefaultFork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loads := analyzeCode(tt.code, schedule).report.RedundantLoads
+			if len(loads) != len(tt.want) {
+				t.Fatalf("redundant loads = %+v, want %v", loads, tt.want)
+			}
+			for i, l := range loads {
+				if l.PC != tt.want[i][0] || l.FirstPC != tt.want[i][1] || l.Slot != "1" || l.GasSaved != 100 {
+					t.Errorf("load %d = %+v, want slot 1 re-read at %d after %d, saving 100", i, l, tt.want[i][0], tt.want[i][1])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// ReentrancyGuard is a fixed slot that is set to LockValue before an
+// external call and restored to UnlockValue after it, the way
+// SSTORE-based nonReentrant modifiers work.
+//
+// The gas figures are per guarded call under EIP-2929/3529 pricing with
+// the slot resting at UnlockValue: StorageGas is what the check and the two
+// writes cost, of which Refund comes back at the end of the transaction,
+// and TransientGas is what TLOAD and TSTORE would cost instead. GasSaved
+// counts the refund as paid in full; refunds are capped at a fifth of the
+// transaction's gas, so the real saving can be larger.
+type ReentrancyGuard struct {
+	Slot         string   `json:"slot"`
+	Name         string   `json:"name,omitempty"`
+	LockValue    string   `json:"lock_value"`
+	UnlockValue  string   `json:"unlock_value"`
+	LockPC       int      `json:"lock_pc"`
+	CallPC       int      `json:"call_pc"`
+	UnlockPC     int      `json:"unlock_pc"`
+	Functions    []string `json:"functions,omitempty"`
+	StorageGas   uint64   `json:"storage_gas"`
+	Refund       uint64   `json:"refund"`
+	TransientGas uint64   `json:"transient_gas"`
+	GasSaved     uint64   `json:"gas_saved"`
+}
+
+// Label names the guard's slot, e.g. "slot 0" or "_status (slot 0)".
+func (g ReentrancyGuard) Label() string {
+	if g.Name == "" {
+		return "slot " + g.Slot
+	}
+	return fmt.Sprintf("%s (slot %s)", g.Name, g.Slot)
+}
+
+// slotWrite is an SSTORE of a constant to a fixed slot.
+type slotWrite struct {
+	pc    int
+	slot  string
+	value Value
+}
+
+// maxGuardValue bounds the values a guard flag takes: booleans and small
+// enums like OpenZeppelin's NOT_ENTERED = 1, ENTERED = 2.
+const maxGuardValue = 255
+
+// noteWrite remembers an SSTORE of a small constant to a fixed slot, which
+// may be one half of a reentrancy guard.
+func (st *StorageTracker) noteWrite(pc int, slot, value Value) {
+	if n, ok := value.Uint64(); !ok || n > maxGuardValue || !slot.IsConcrete() {
+		return
+	}
+	for _, w := range st.writes {
+		if w.pc == pc && w.value.Equal(value) {
+			return
+		}
+	}
+	st.writes = append(st.writes, slotWrite{pc: pc, slot: slot.String(), value: value})
+}
+
+// isExternalCall reports whether op hands control to other code that could
+// call back in.
+func isExternalCall(op vm.OpCode) bool {
+	switch op {
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL,
+		vm.EXTCALL, vm.EXTDELEGATECALL, vm.EXTSTATICCALL:
+		return true
+	}
+	return false
+}
+
+// findReentrancyGuards pairs the constant writes to each fixed slot into a
+// lock, an external call reachable from it, and a write of a different
+// value reachable from the call.
+func (a *analysis) findReentrancyGuards() []ReentrancyGuard {
+	g := a.cfg
+	if g == nil || len(a.storage.writes) == 0 {
+		return nil
+	}
+	var calls []int
+	for _, b := range g.Blocks {
+		for _, ins := range b.Instructions {
+			if isExternalCall(ins.Op) {
+				calls = append(calls, ins.PC)
+			}
+		}
+	}
+	reach := map[int]map[int]bool{}
+	reaches := func(from, to int) bool {
+		fb, tb := g.BlockAt(from), g.BlockAt(to)
+		if fb == nil || tb == nil {
+			return false
+		}
+		if fb == tb && from < to {
+			return true
+		}
+		if reach[fb.Start] == nil {
+			reach[fb.Start] = map[int]bool{}
+			for _, b := range g.ReachableFrom(fb.Start) {
+				if b != fb {
+					reach[fb.Start][b.Start] = true
+				}
+			}
+		}
+		return reach[fb.Start][tb.Start]
+	}
+
+	var guards []ReentrancyGuard
+	found := map[string]bool{}
+	for _, lock := range a.storage.writes {
+		if found[lock.slot] {
+			continue
+		}
+		for _, call := range calls {
+			if !reaches(lock.pc, call) {
+				continue
+			}
+			for _, unlock := range a.storage.writes {
+				if unlock.slot != lock.slot || unlock.value.Equal(lock.value) || !reaches(call, unlock.pc) {
+					continue
+				}
+				guards = append(guards, a.newGuard(lock, unlock, call))
+				found[lock.slot] = true
+				break
+			}
+			if found[lock.slot] {
+				break
+			}
+		}
+	}
+	sort.Slice(guards, func(i, j int) bool { return slotLess(guards[i].Slot, guards[j].Slot) })
+	return guards
+}
+
+// newGuard prices a guard per call. The check reads the slot cold, the lock
+// then pays a set or a reset, and the unlock restores the original value,
+// which costs a warm access and refunds most of the lock.
+func (a *analysis) newGuard(lock, unlock slotWrite, call int) ReentrancyGuard {
+	guard := ReentrancyGuard{
+		Slot:        lock.slot,
+		LockValue:   lock.value.String(),
+		UnlockValue: unlock.value.String(),
+		LockPC:      lock.pc,
+		CallPC:      call,
+		UnlockPC:    unlock.pc,
+		Name:        fieldNames(a.storage.fieldsAt(lock.slot)),
+	}
+	for _, fn := range a.functionScopes() {
+		if fn.pcs[lock.pc] && fn.pcs[unlock.pc] {
+			guard.Functions = append(guard.Functions, fn.label)
+		}
+	}
+
+	write := params.SstoreResetGasEIP2200 - params.ColdSloadCostEIP2929
+	if isZero(unlock.value) {
+		write = params.SstoreSetGasEIP2200
+	}
+	warm := params.WarmStorageReadCostEIP2929
+	guard.StorageGas = params.ColdSloadCostEIP2929 + write + warm
+	guard.Refund = write - warm
+	// TLOAD for the check and a TSTORE for each write.
+	guard.TransientGas = 3 * params.WarmStorageReadCostEIP2929
+	if net := guard.StorageGas - guard.Refund; net > guard.TransientGas {
+		guard.GasSaved = net - guard.TransientGas
+	}
+	return guard
+}
+
+// guardSuggestions recommends moving each guard to transient storage.
+// needsFork names the fork to upgrade to when the current one has none.
+func guardSuggestions(guards []ReentrancyGuard, needsFork string) []Suggestion {
+	var out []Suggestion
+	for _, g := range guards {
+		s := fmt.Sprintf("Reentrancy guard in %s is kept in storage - use TSTORE/TLOAD to save ~%d gas per guarded call (%d before refunds)",
+			g.Label(), g.GasSaved, g.StorageGas-g.TransientGas)
+		if needsFork != "" {
+			s += "; transient storage needs " + needsFork
+		}
+		out = append(out, Suggestion{Text: s, PC: g.LockPC})
+	}
+	return out
+}
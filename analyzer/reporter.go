@@ -7,20 +7,54 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 
+	"gaslens/metadata"
 	"github.com/ethereum/go-ethereum/core/vm"
 )
 
 type AnalysisReport struct {
+	Contract           string                    `json:"contract,omitempty"`
+	Fork               string                    `json:"fork"`
 	TotalGas           uint64                    `json:"total_gas"`
+	DynamicGas         uint64                    `json:"dynamic_gas"`
+	MemoryBytes        uint64                    `json:"peak_memory_bytes"`
+	UnboundedOps       []UnboundedOp             `json:"unbounded_instructions,omitempty"`
+	StackFaults        []StackFault              `json:"stack_faults,omitempty"`
 	OpcodeFrequency    map[string]int            `json:"opcode_frequency"`
 	OpcodeGas          map[string]uint64         `json:"opcode_gas"`
-	StorageReads       map[uint64]int            `json:"storage_reads"`
-	StorageWrites      map[uint64]int            `json:"storage_writes"`
+	StorageGas         StorageGas                `json:"storage_gas"`
+	AccountAccess      AccountAccessGas          `json:"account_access"`
+	StorageReads       map[string]int            `json:"storage_reads"`
+	StorageWrites      map[string]int            `json:"storage_writes"`
+	StorageVariables   []StorageVariable         `json:"storage_variables,omitempty"`
+	Packing            *PackingAdvice            `json:"packing,omitempty"`
+	TransientReads     map[string]int            `json:"transient_reads,omitempty"`
+	TransientWrites    map[string]int            `json:"transient_writes,omitempty"`
+	ReentrancyGuards   []ReentrancyGuard         `json:"reentrancy_guards,omitempty"`
+	RedundantLoads     []RedundantLoad           `json:"redundant_loads,omitempty"`
 	Loops              []Loop                    `json:"loops"`
 	Functions          []FunctionInfo            `json:"functions"`
+	SourceLines        []SourceLine              `json:"source_lines,omitempty"`
+	Subroutines        []Subroutine              `json:"subroutines,omitempty"`
 	TopExpensiveOps    []OpGasPair               `json:"top_expensive_opcodes"`
 	Optimizations      []string                  `json:"optimization_suggestions"`
+	UndefinedOps       map[string]int            `json:"undefined_opcodes,omitempty"`
+	Execution          *ExecutionResult          `json:"execution,omitempty"`
+	Profiles           []FunctionProfile         `json:"function_profiles,omitempty"`
+	Events             []EventInfo               `json:"events,omitempty"`
+	Metadata           *metadata.Metadata        `json:"metadata,omitempty"`
+	Deployment         *DeploymentCost           `json:"deployment,omitempty"`
+	DeadCode           *DeadCode                 `json:"dead_code,omitempty"`
+	EOF                *EOFReport                `json:"eof,omitempty"`
+}
+
+// UnboundedOp is an instruction whose dynamic cost depends on operands the
+// analyzer could not resolve. LowerBound is the gas it costs at minimum.
+type UnboundedOp struct {
+	PC         int    `json:"pc"`
+	Opcode     string `json:"opcode"`
+	LowerBound uint64 `json:"lower_bound"`
 }
 
 type OpGasPair struct {
@@ -49,56 +83,182 @@ func ExportToCSV(report *AnalysisReport, filename string) error {
 	// Write headers
 	writer.Write([]string{"Category", "Item", "Value", "Details"})
 
+	if dc := report.DeadCode; dc != nil {
+		for _, r := range dc.Regions {
+			writer.Write([]string{"Dead Code", fmt.Sprintf("PC %d-%d", r.Start, r.End), strconv.Itoa(r.Bytes), r.Kind})
+		}
+		writer.Write([]string{"Dead Code", "Excluded Gas", strconv.FormatUint(dc.ExcludedGas, 10), ""})
+		writer.Write([]string{"Dead Code", "Deployment Saving", strconv.FormatUint(dc.DeploymentSaving, 10), "gas"})
+	}
+
+	if d := report.Deployment; d != nil {
+		writer.Write([]string{"Deployment", "Init Code Size", strconv.Itoa(d.InitCodeSize), "bytes"})
+		writer.Write([]string{"Deployment", "Runtime Size", strconv.Itoa(d.RuntimeSize), "bytes"})
+		writer.Write([]string{"Deployment", "Constructor Args Size", strconv.Itoa(d.ConstructorArgsSize), d.ConstructorArgs})
+		writer.Write([]string{"Deployment", "Intrinsic Gas", strconv.FormatUint(d.IntrinsicGas, 10), ""})
+		writer.Write([]string{"Deployment", "Init Execution Gas", strconv.FormatUint(d.InitExecutionGas, 10), ""})
+		writer.Write([]string{"Deployment", "Code Deposit Gas", strconv.FormatUint(d.CodeDepositGas, 10), ""})
+		writer.Write([]string{"Deployment", "Total Gas", strconv.FormatUint(d.TotalGas, 10), ""})
+	}
+
+	if e := report.EOF; e != nil {
+		for _, sec := range e.CodeSections {
+			writer.Write([]string{"EOF Section", sec.Label(), strconv.FormatUint(sec.Gas, 10),
+				fmt.Sprintf("Offset: %d, Size: %d, Max Stack: %d", sec.Offset, sec.Size, sec.MaxStackHeight)})
+		}
+	}
+
+	if md := report.Metadata; md != nil {
+		writer.Write([]string{"Metadata", "Compiler", md.Compiler, md.Version})
+		writer.Write([]string{"Metadata", "Source Hash", md.SourceHash, ""})
+		writer.Write([]string{"Metadata", "Trailer Size", strconv.Itoa(md.Size), "Excluded from analysis"})
+	}
+
+	if e := report.Execution; e != nil {
+		writer.Write([]string{"Execution", "Gas Used", strconv.FormatUint(e.GasUsed, 10), ""})
+		writer.Write([]string{"Execution", "Intrinsic Gas", strconv.FormatUint(e.IntrinsicGas, 10), ""})
+		writer.Write([]string{"Execution", "Refund", strconv.FormatUint(e.Refund, 10), ""})
+		writer.Write([]string{"Execution", "Transaction Gas", strconv.FormatUint(e.TransactionGas, 10), ""})
+		writer.Write([]string{"Execution", "Static Estimate", strconv.FormatUint(e.StaticEstimate, 10), ""})
+		writer.Write([]string{"Execution", "Reverted", strconv.FormatBool(e.Reverted), e.Error})
+	}
+
+	for _, p := range report.Profiles {
+		writer.Write([]string{"Function Profile", p.Signature, strconv.FormatUint(p.AvgGas, 10),
+			fmt.Sprintf("Selector: %s, Min: %d, Max: %d, Calls: %d, Reverted: %d", p.Selector, p.MinGas, p.MaxGas, len(p.Calls), p.Reverts)})
+	}
+
 	// Write opcode data
 	for opcode, count := range report.OpcodeFrequency {
 		gas := report.OpcodeGas[opcode]
 		writer.Write([]string{"Opcode", opcode, strconv.Itoa(count), fmt.Sprintf("Gas: %d", gas)})
 	}
 
+	for opcode, count := range report.UndefinedOps {
+		writer.Write([]string{"Undefined Opcode", opcode, strconv.Itoa(count), "Not priced under " + report.Fork})
+	}
+
+	for _, u := range report.UnboundedOps {
+		writer.Write([]string{"Unbounded Gas", u.Opcode, strconv.FormatUint(u.LowerBound, 10), fmt.Sprintf("PC: %d, dynamic, unbounded", u.PC)})
+	}
+
+	for _, f := range report.StackFaults {
+		kind := "Stack Underflow"
+		if f.Overflow {
+			kind = "Stack Overflow"
+		}
+		writer.Write([]string{kind, f.Opcode, strconv.Itoa(f.Height), fmt.Sprintf("PC: %d, Needs: %d", f.PC, f.Needs)})
+	}
+
 	// Write storage data
+	writer.Write([]string{"Storage Gas", "Cold Access", strconv.FormatUint(report.StorageGas.ColdAccess, 10), ""})
+	writer.Write([]string{"Storage Gas", "Warm Access", strconv.FormatUint(report.StorageGas.WarmAccess, 10), ""})
+	writer.Write([]string{"Storage Gas", "Set", strconv.FormatUint(report.StorageGas.Set, 10), ""})
+	writer.Write([]string{"Storage Gas", "Reset", strconv.FormatUint(report.StorageGas.Reset, 10), ""})
+	writer.Write([]string{"Storage Gas", "Refund", strconv.FormatInt(report.StorageGas.Refund, 10), ""})
+
 	for slot, count := range report.StorageReads {
-		writer.Write([]string{"Storage Read", fmt.Sprintf("Slot %d", slot), strconv.Itoa(count), ""})
+		writer.Write([]string{"Storage Read", "Slot " + slot, strconv.Itoa(count), ""})
 	}
 
 	for slot, count := range report.StorageWrites {
-		writer.Write([]string{"Storage Write", fmt.Sprintf("Slot %d", slot), strconv.Itoa(count), ""})
+		writer.Write([]string{"Storage Write", "Slot " + slot, strconv.Itoa(count), ""})
+	}
+
+	for _, v := range report.StorageVariables {
+		writer.Write([]string{"Storage Variable", v.Label(), strconv.Itoa(v.Reads + v.Writes),
+			fmt.Sprintf("Reads: %d, Writes: %d, Slots: %d", v.Reads, v.Writes, max(len(v.Locations), 1))})
+	}
+
+	writer.Write([]string{"Storage Gas", "Transient", strconv.FormatUint(report.StorageGas.Transient, 10), ""})
+	for _, slot := range sortedSlotKeys(report.TransientReads, report.TransientWrites) {
+		writer.Write([]string{"Transient Slot", "Slot " + slot, strconv.Itoa(report.TransientReads[slot] + report.TransientWrites[slot]),
+			fmt.Sprintf("Reads: %d, Writes: %d", report.TransientReads[slot], report.TransientWrites[slot])})
+	}
+	for _, l := range report.RedundantLoads {
+		writer.Write([]string{"Redundant SLOAD", "Slot " + l.Slot, strconv.FormatUint(l.GasSaved, 10),
+			fmt.Sprintf("PC: %d, First read: %d, Function: %s", l.PC, l.FirstPC, l.Function)})
+	}
+	for _, g := range report.ReentrancyGuards {
+		writer.Write([]string{"Reentrancy Guard", g.Label(), strconv.FormatUint(g.GasSaved, 10),
+			fmt.Sprintf("Lock PC: %d, Call PC: %d, Unlock PC: %d", g.LockPC, g.CallPC, g.UnlockPC)})
+	}
+
+	for _, l := range report.Loops {
+		writer.Write([]string{"Loop", fmt.Sprintf("PC %d-%d", l.StartPC, l.EndPC), strconv.FormatUint(l.GasPerIteration, 10),
+			fmt.Sprintf("Bound: %s, Kind: %s", l.Bound, l.BoundKind)})
+	}
+
+	if report.Packing != nil {
+		for _, slot := range report.Packing.Slots {
+			for _, v := range slot.Variables {
+				writer.Write([]string{"Packed Slot", "Slot " + slot.Slot, strconv.Itoa(v.Bytes),
+					fmt.Sprintf("%s at byte %d", v.Label(), v.Offset)})
+			}
+		}
+		for _, s := range report.Packing.Savings {
+			writer.Write([]string{"Packing Savings", s.Function, strconv.FormatUint(s.GasSaved, 10), ""})
+		}
 	}
 
 	// Write function data
 	for _, fn := range report.Functions {
-		writer.Write([]string{"Function", fn.Selector, strconv.FormatUint(fn.Gas, 10), fmt.Sprintf("Entry PC: %d", fn.EntryPC)})
+		writer.Write([]string{"Function", fn.Label(), strconv.FormatUint(fn.Gas, 10), fmt.Sprintf("Entry PC: %d, Discovery: %s", fn.EntryPC, fn.Discovery)})
+		if fn.MaxGas > 0 {
+			writer.Write([]string{"Function Path", fn.Label(), strconv.FormatUint(fn.MaxGas, 10),
+				fmt.Sprintf("Min: %d, Worst path: %s", fn.MinGas, joinPCs(fn.WorstPath))})
+		}
+	}
+
+	for _, sub := range report.Subroutines {
+		writer.Write([]string{"Internal Function", sub.Label(), strconv.FormatUint(sub.InclusiveGas, 10),
+			fmt.Sprintf("Exclusive: %d, Call sites: %s, Callers: %s", sub.ExclusiveGas, joinInts(sub.CallSites), strings.Join(sub.Callers, "; "))})
+	}
+
+	for _, l := range report.SourceLines {
+		writer.Write([]string{"Source Line", l.Label(), strconv.FormatUint(l.Gas, 10),
+			fmt.Sprintf("Instructions: %d, Code: %s", l.Instructions, l.Text)})
+	}
+
+	for _, e := range report.Events {
+		writer.Write([]string{"Event", e.Label(), e.Topic, fmt.Sprintf("PC: %d", e.PC)})
 	}
 
 	return nil
 }
 
-func GenerateOptimizationSuggestions(storage *StorageTracker, loops []Loop, opcodeGas map[vm.OpCode]uint64) []string {
-	var suggestions []string
+func GenerateOptimizationSuggestions(storage *StorageTracker, loops []Loop, opcodeGas map[vm.OpCode]uint64) []Suggestion {
+	var suggestions []Suggestion
 
-	// Storage optimization suggestions
-	for slot, count := range storage.SLoadCount {
-		if count > 3 {
-			suggestions = append(suggestions, fmt.Sprintf("Cache storage slot %d in memory (read %d times)", slot, count))
-		}
+	if storage.Layout != nil {
+		suggestions = append(suggestions, general(packingSuggestions(storage)...)...)
 	}
 
 	// Loop optimization suggestions
 	if len(loops) > 0 {
-		suggestions = append(suggestions, "Consider gas limits for loops to prevent out-of-gas errors")
+		suggestions = append(suggestions, general("Consider gas limits for loops to prevent out-of-gas errors")...)
 		for _, loop := range loops {
+			switch {
+			case loop.BoundKind == BoundStorageLength:
+				suggestions = append(suggestions, Suggestion{PC: loop.StartPC, Text: fmt.Sprintf("Loop at PC %d-%d runs over %s (%s) - the array can grow until the loop runs out of gas; paginate or cap it",
+					loop.StartPC, loop.EndPC, loop.Bound, loop.Summary())})
+			case loop.Bound == "":
+				suggestions = append(suggestions, Suggestion{PC: loop.StartPC, Text: fmt.Sprintf("Loop at PC %d-%d has no bound the analysis could find (%s) - cap its iterations to avoid out-of-gas failures",
+					loop.StartPC, loop.EndPC, loop.Summary())})
+			}
 			if loop.Count > 5 {
-				suggestions = append(suggestions, fmt.Sprintf("Loop at PC %d-%d executed %d times - consider optimization", loop.StartPC, loop.EndPC, loop.Count))
+				suggestions = append(suggestions, Suggestion{PC: loop.StartPC, Text: fmt.Sprintf("Loop at PC %d-%d executed %d times - consider optimization", loop.StartPC, loop.EndPC, loop.Count)})
 			}
 		}
 	}
 
 	// Expensive opcode suggestions
 	if gas, exists := opcodeGas[vm.SSTORE]; exists && gas > 100000 {
-		suggestions = append(suggestions, "High SSTORE usage detected - consider struct packing")
+		suggestions = append(suggestions, general("High SSTORE usage detected - consider struct packing")...)
 	}
 
 	if gas, exists := opcodeGas[vm.SLOAD]; exists && gas > 50000 {
-		suggestions = append(suggestions, "High SLOAD usage detected - cache frequently accessed storage")
+		suggestions = append(suggestions, general("High SLOAD usage detected - cache frequently accessed storage")...)
 	}
 
 	return suggestions
@@ -3,6 +3,7 @@ package analyzer
 import (
 	"fmt"
 	"sort"
+	"strings"
 )
 
 // SimpleReport provides user-friendly analysis
@@ -11,30 +12,136 @@ func PrintSimpleReport(report *AnalysisReport) {
 	fmt.Println("================================")
 	
 	// Overall gas estimate
-	fmt.Printf("💰 Estimated Total Gas Cost: %d gas\n", report.TotalGas)
+	if len(report.UnboundedOps) > 0 {
+		fmt.Printf("💰 Estimated Total Gas Cost: at least %d gas\n", report.TotalGas)
+		fmt.Printf("📈 %d instructions have dynamic, unbounded cost (size not known statically)\n", len(report.UnboundedOps))
+	} else {
+		fmt.Printf("💰 Estimated Total Gas Cost: %d gas\n", report.TotalGas)
+	}
+	fmt.Printf("⛓️  Priced Under: %s rules\n", report.Fork)
+	if md := report.Metadata; md != nil {
+		fmt.Printf("🛠️  Compiler: %s %s (%d-byte metadata trailer excluded)\n", md.Compiler, md.Version, md.Size)
+	}
 	fmt.Printf("💵 Approximate Cost (20 gwei): $%.4f USD\n", estimateUSDCost(report.TotalGas))
 	
 	// Simple gas rating
 	rating := getGasRating(report.TotalGas)
-	fmt.Printf("⭐ Gas Efficiency Rating: %s\n\n", rating)
+	fmt.Printf("⭐ Gas Efficiency Rating: %s\n", rating)
+	if len(report.UndefinedOps) > 0 {
+		undefined := 0
+		for _, count := range report.UndefinedOps {
+			undefined += count
+		}
+		fmt.Printf("⚠️  %d opcodes are not defined in %s and were not priced\n", undefined, report.Fork)
+	}
+	for _, f := range report.StackFaults {
+		fmt.Printf("🧨 %s\n", f)
+	}
+	fmt.Println()
 	
+	if d := report.Deployment; d != nil {
+		printDeploymentCost(d)
+	}
+	if dc := report.DeadCode; dc != nil {
+		fmt.Printf("🗑️  Unreachable Code: %d bytes, excluded from the total - removing it saves ~%d gas at deployment\n\n",
+			dc.Bytes, dc.DeploymentSaving)
+	}
+
+	if report.EOF != nil {
+		printEOFSections(report.EOF)
+	}
+
 	// Top 3 most expensive operations (simplified)
 	fmt.Println("🔥 TOP GAS CONSUMERS:")
 	printTopOperations(report.TopExpensiveOps, 3)
 	
+	if len(report.SourceLines) > 0 {
+		fmt.Println("\n📍 HOTTEST SOURCE LINES:")
+		for _, l := range report.SourceLines[:min(3, len(report.SourceLines))] {
+			fmt.Printf("   • %s: %d gas  %s\n", l.Label(), l.Gas, l.Text)
+		}
+	}
+
 	// Storage efficiency
 	fmt.Println("\n💾 STORAGE USAGE:")
-	printStorageEfficiency(report.StorageReads, report.StorageWrites)
+	printStorageEfficiency(report)
 	
 	// Simple recommendations
 	fmt.Println("\n💡 OPTIMIZATION TIPS:")
 	printSimpleOptimizations(report.Optimizations)
 	
+	if len(report.Loops) > 0 {
+		fmt.Println("\n🔁 LOOPS:")
+		for _, l := range report.Loops {
+			fmt.Printf("   • PC %d: %s\n", l.StartPC, l.Summary())
+		}
+	}
+
 	// Function costs (if any)
 	if len(report.Functions) > 0 {
 		fmt.Println("\n🎯 FUNCTION COSTS:")
 		printFunctionCosts(report.Functions, 3)
+		printSharedHelpers(report.Subroutines, 3)
+	}
+
+	if len(report.Events) > 0 {
+		fmt.Println("\n📣 EVENTS EMITTED:")
+		for _, e := range report.Events {
+			fmt.Printf("   • %s\n", e.Label())
+		}
+	}
+}
+
+// PrintExecutionSummary shows the gas a concrete call paid next to the
+// static estimate for the whole contract.
+func PrintExecutionSummary(report *AnalysisReport) {
+	e := report.Execution
+	fmt.Println("\n⚡ EXECUTION RESULT")
+	fmt.Println("================================")
+	if e.Reverted {
+		fmt.Printf("❌ Call failed: %s\n", e.Error)
+	} else {
+		fmt.Println("✅ Call succeeded")
+	}
+	fmt.Printf("⛽ Execution Gas Used: %d gas\n", e.GasUsed)
+	fmt.Printf("🧾 Intrinsic Gas: %d gas\n", e.IntrinsicGas)
+	fmt.Printf("💸 Refund: %d gas\n", e.Refund)
+	fmt.Printf("💰 Transaction Gas: %d gas\n", e.TransactionGas)
+	fmt.Printf("📐 Static Estimate (whole contract): %d gas\n", e.StaticEstimate)
+	fmt.Printf("↩️  Return Data: %s\n", e.ReturnData)
+}
+
+// printEOFSections lists the gas of each code section of an EOF container.
+func printEOFSections(e *EOFReport) {
+	fmt.Printf("🧱 EOF CODE SECTIONS (version %d):\n", e.Version)
+	for _, sec := range e.CodeSections {
+		bound := ""
+		if sec.Unbounded {
+			bound = " (at least)"
+		}
+		fmt.Printf("   • %s - %d gas%s\n", sec.Label(), sec.Gas, bound)
+	}
+	if e.Containers > 0 {
+		fmt.Printf("   📦 %d nested container(s) validated\n", e.Containers)
 	}
+	fmt.Println()
+}
+
+// printDeploymentCost summarises what deploying creation code costs.
+func printDeploymentCost(d *DeploymentCost) {
+	fmt.Println("🚀 DEPLOYMENT COST:")
+	fmt.Printf("   📦 Runtime Code: %d bytes (deposit %d gas)\n", d.RuntimeSize, d.CodeDepositGas)
+	fmt.Printf("   🧾 Transaction Data: %d gas intrinsic\n", d.IntrinsicGas)
+	fmt.Printf("   🏗️  Constructor: %d gas\n", d.InitExecutionGas)
+	if d.ConstructorArgsSize > 0 {
+		fmt.Printf("   🧩 Constructor Arguments: %d bytes (excluded from analysis)\n", d.ConstructorArgsSize)
+	}
+	fmt.Printf("   💰 Total to Deploy: %d gas ($%.4f USD)\n", d.TotalGas, estimateUSDCost(d.TotalGas))
+	for _, w := range d.Warnings {
+		fmt.Printf("   ⚠️  %s\n", w)
+	}
+	fmt.Println("   (Everything below is about the runtime code.)")
+	fmt.Println()
 }
 
 func estimateUSDCost(gas uint64) float64 {
@@ -91,14 +198,14 @@ func getOperationDescription(opcode string) string {
 	return fmt.Sprintf("⚙️  %s Operation", opcode)
 }
 
-func printStorageEfficiency(reads map[uint64]int, writes map[uint64]int) {
+func printStorageEfficiency(report *AnalysisReport) {
 	totalReads := 0
 	totalWrites := 0
 	
-	for _, count := range reads {
+	for _, count := range report.StorageReads {
 		totalReads += count
 	}
-	for _, count := range writes {
+	for _, count := range report.StorageWrites {
 		totalWrites += count
 	}
 	
@@ -109,6 +216,39 @@ func printStorageEfficiency(reads map[uint64]int, writes map[uint64]int) {
 	
 	fmt.Printf("   📖 Storage Reads: %d\n", totalReads)
 	fmt.Printf("   💾 Storage Writes: %d\n", totalWrites)
+	gas := report.StorageGas
+	fmt.Printf("   🧊 Cold Access: %d gas   🔥 Warm Access: %d gas\n", gas.ColdAccess, gas.WarmAccess)
+	fmt.Printf("   🆕 Set: %d gas   ♻️  Reset: %d gas   💸 Refund: %d gas\n", gas.Set, gas.Reset, gas.Refund)
+	for _, v := range report.StorageVariables {
+		if v.Kind != VariableUnknown {
+			fmt.Printf("   • %s: %d reads, %d writes\n", v.Label(), v.Reads, v.Writes)
+		}
+	}
+	if gas.Transient > 0 {
+		fmt.Printf("   ⚡ Transient Storage: %d gas\n", gas.Transient)
+	}
+	if n := len(report.RedundantLoads); n > 0 {
+		var saved uint64
+		for _, l := range report.RedundantLoads {
+			saved += l.GasSaved
+		}
+		fmt.Printf("   🔁 %d storage reads repeat an earlier read - reuse it to save ~%d gas\n", n, saved)
+	}
+	for _, g := range report.ReentrancyGuards {
+		fmt.Printf("   🔒 Reentrancy guard in %s - transient storage saves ~%d gas per call\n", g.Label(), g.GasSaved)
+	}
+	if p := report.Packing; p != nil {
+		for _, slot := range p.Slots {
+			names := make([]string, len(slot.Variables))
+			for i, v := range slot.Variables {
+				names[i] = v.Label()
+			}
+			fmt.Printf("   📦 Pack %s into slot %s\n", strings.Join(names, " + "), slot.Slot)
+		}
+		for _, s := range p.Savings {
+			fmt.Printf("      saves ~%d gas in %s\n", s.GasSaved, s.Function)
+		}
+	}
 	
 	if totalWrites > 5 {
 		fmt.Println("   ⚠️  High storage writes - consider batching")
@@ -128,6 +268,7 @@ func printSimpleOptimizations(optimizations []string) {
 	simplified["Cache storage"] = "💡 Store frequently used data in memory instead of storage"
 	simplified["High SSTORE"] = "💡 Group related variables together to save storage costs"
 	simplified["Loop"] = "💡 Add gas limits to loops to prevent failures"
+	simplified["Reentrancy guard"] = "💡 Keep reentrancy locks in transient storage (TSTORE/TLOAD)"
 	
 	count := 1
 	for _, opt := range optimizations {
@@ -165,7 +306,30 @@ func printFunctionCosts(functions []FunctionInfo, limit int) {
 			costLevel = "❤️ Expensive"
 		}
 		
-		fmt.Printf("   %d. Function %s - %d gas (%s)\n", i+1, fn.Selector, fn.Gas, costLevel)
+		fmt.Printf("   %d. Function %s - %d gas (%s)\n", i+1, fn.Label(), fn.Gas, costLevel)
+		if fn.MaxGas > 0 {
+			fmt.Printf("      per call: %s\n", fn.PathSummary())
+		}
+	}
+}
+
+// printSharedHelpers lists the most expensive internal functions that
+// several external functions use.
+func printSharedHelpers(subs []Subroutine, limit int) {
+	var shared []Subroutine
+	for _, s := range subs {
+		if s.Shared() {
+			shared = append(shared, s)
+		}
+	}
+	sort.SliceStable(shared, func(i, j int) bool {
+		return shared[i].InclusiveGas > shared[j].InclusiveGas
+	})
+	for i, s := range shared {
+		if i >= limit {
+			break
+		}
+		fmt.Printf("   🧩 Shared helper %s - %d gas, used by %s\n", s.Label(), s.InclusiveGas, strings.Join(s.Functions, ", "))
 	}
 }
 
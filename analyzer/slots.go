@@ -0,0 +1,216 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+
+	"gaslens/layout"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// Storage variable kinds.
+const (
+	VariableValue    = "value"    // a fixed slot
+	VariableMapping  = "mapping"  // keccak256(key . slot)
+	VariableArray    = "array"    // keccak256(slot) + i
+	VariableComputed = "computed" // a slot computed from inputs some other way
+	VariableUnknown  = "unknown"  // a slot that could not be resolved
+)
+
+// storageLocation ties a slot to the variable it was derived from: the
+// declared slot of a mapping or dynamic array. elements marks where an
+// array's elements start, before an index is added.
+type storageLocation struct {
+	base      string
+	container string
+	elements  bool
+}
+
+// located returns the symbol expr derived from a storage variable, computed
+// by op from args.
+func located(expr string, loc storageLocation, op vm.OpCode, args ...Value) (Value, bool) {
+	v := Symbol(expr).withOp(op, args...)
+	if v.IsUnknown() {
+		return v, false
+	}
+	v.loc = loc
+	return v, true
+}
+
+// hashSlot names the KECCAK256 of one or two memory words when it is how
+// Solidity and Vyper derive storage slots: keccak256(key . slot) is the
+// slot of mapping[key] (Vyper hashes slot . key), and keccak256(slot) is
+// where the elements of a dynamic array start. A slot derived from another
+// variable, as in nested mappings, keeps that variable. An unknown key is
+// named after the pc, so it never equals another access's key.
+func hashSlot(words []Value, pc int) (Value, bool) {
+	switch len(words) {
+	case 1:
+		slot := words[0]
+		switch {
+		case slot.loc.base != "":
+			return located(fmt.Sprintf("array(%s)", slot), storageLocation{base: slot.loc.base, container: slot.loc.container, elements: true}, vm.KECCAK256, words...)
+		case slot.IsConcrete():
+			return located(fmt.Sprintf("array(slot %s)", slot), storageLocation{base: slot.String(), container: VariableArray, elements: true}, vm.KECCAK256, words...)
+		}
+	case 2:
+		key, slot := words[0], words[1]
+		if !slot.IsConcrete() && slot.loc.base == "" && words[0].IsConcrete() {
+			key, slot = words[1], words[0]
+		}
+		key = nameUnknown(key, pc)
+		switch {
+		case slot.loc.base != "":
+			return located(fmt.Sprintf("%s[%s]", slot, key), storageLocation{base: slot.loc.base, container: slot.loc.container}, vm.KECCAK256, words...)
+		case slot.IsConcrete():
+			return located(fmt.Sprintf("mapping(slot %s)[%s]", slot, key), storageLocation{base: slot.String(), container: VariableMapping}, vm.KECCAK256, words...)
+		}
+	}
+	return Value{}, false
+}
+
+// offsetSlot adds an offset to a derived slot: an index into an array's
+// elements, or a member of a struct stored in a mapping or array.
+func offsetSlot(a, b Value, pc int) (Value, bool) {
+	slot, off := a, b
+	if slot.loc.base == "" {
+		slot, off = b, a
+	}
+	if slot.loc.base == "" {
+		return Value{}, false
+	}
+	off = nameUnknown(off, pc)
+	loc := slot.loc
+	loc.elements = false
+	if slot.loc.elements {
+		return located(fmt.Sprintf("%s[%s]", slot, off), loc, vm.ADD, slot, off)
+	}
+	if off.IsZero() {
+		return slot, true
+	}
+	if off.IsConcrete() {
+		return located(fmt.Sprintf("%s+%s", slot, off), loc, vm.ADD, slot, off)
+	}
+	return located(fmt.Sprintf("add(%s,%s)", slot, off), loc, vm.ADD, slot, off)
+}
+
+// nameUnknown stands in for an unknown key or index with a symbol local to
+// the instruction at pc.
+func nameUnknown(v Value, pc int) Value {
+	if v.IsUnknown() {
+		return Symbol(fmt.Sprintf("%s@%d", UnresolvedSlot, pc))
+	}
+	return v
+}
+
+// variable returns the storage variable a slot belongs to.
+func (v Value) variable() (slot, kind string) {
+	switch {
+	case v.loc.base != "":
+		return v.loc.base, v.loc.container
+	case v.IsConcrete():
+		return v.String(), VariableValue
+	case v.IsSymbolic():
+		return v.String(), VariableComputed
+	}
+	return UnresolvedSlot, VariableUnknown
+}
+
+// StorageVariable groups the accesses to one storage variable: a fixed
+// slot, or every slot a mapping or dynamic array derives from the slot it
+// is declared at. Locations lists the derived slots that were accessed.
+// Name, Type and Fields come from a storage layout, when one is loaded;
+// Fields lists every variable packed into a fixed slot.
+type StorageVariable struct {
+	Slot      string         `json:"slot"`
+	Kind      string         `json:"kind"`
+	Name      string         `json:"name,omitempty"`
+	Type      string         `json:"type,omitempty"`
+	Fields    []layout.Field `json:"fields,omitempty"`
+	Reads     int            `json:"reads"`
+	Writes    int            `json:"writes"`
+	Locations []string       `json:"locations,omitempty"`
+	Sources   []string       `json:"sources,omitempty"` // source positions of the accesses
+
+	pcs []int
+}
+
+// Label names the variable, e.g. "slot 0", "mapping(slot 1)", or with a
+// layout "owner, paused (slot 0)" and "balances (mapping, slot 1)".
+func (v StorageVariable) Label() string {
+	switch {
+	case v.Name == "":
+	case v.Kind == VariableValue:
+		return fmt.Sprintf("%s (slot %s)", v.Name, v.Slot)
+	default:
+		return fmt.Sprintf("%s (%s, slot %s)", v.Name, v.Kind, v.Slot)
+	}
+	switch v.Kind {
+	case VariableValue:
+		return "slot " + v.Slot
+	case VariableMapping, VariableArray:
+		return fmt.Sprintf("%s(slot %s)", v.Kind, v.Slot)
+	case VariableUnknown:
+		return "unresolved slots"
+	}
+	return v.Slot
+}
+
+// count records a read or write of slot against its variable. A fixed slot
+// that is also the base of a mapping or array, like an array's length,
+// belongs to that variable.
+func (st *StorageTracker) count(slot Value, write bool, pc int) {
+	key := slot.String()
+	if !slot.IsUnknown() {
+		st.accesses = append(st.accesses, slotAccess{pc: pc, slot: key, write: write})
+	}
+	if write {
+		st.SStoreCount[key]++
+	} else {
+		st.SLoadCount[key]++
+	}
+
+	base, kind := slot.variable()
+	v := st.Variables[base]
+	if v == nil {
+		v = &StorageVariable{Slot: base, Kind: kind}
+		st.Variables[base] = v
+	}
+	if kind == VariableMapping || kind == VariableArray {
+		v.Kind = kind
+		if !slices.Contains(v.Locations, key) {
+			v.Locations = append(v.Locations, key)
+		}
+	}
+	v.pcs = appendUnique(v.pcs, pc)
+	if write {
+		v.Writes++
+	} else {
+		v.Reads++
+	}
+}
+
+// SortedVariables returns the variables ordered by slot, numerically where
+// slots are numbers, named from the layout if there is one.
+func (st *StorageTracker) SortedVariables() []StorageVariable {
+	out := make([]StorageVariable, 0, len(st.Variables))
+	for _, v := range st.Variables {
+		named := *v
+		st.annotate(&named)
+		out = append(out, named)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, aErr := strconv.ParseUint(out[i].Slot, 10, 64)
+		b, bErr := strconv.ParseUint(out[j].Slot, 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			return a < b
+		case (aErr == nil) != (bErr == nil):
+			return aErr == nil
+		}
+		return out[i].Slot < out[j].Slot
+	})
+	return out
+}
@@ -0,0 +1,142 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"gaslens/srcmap"
+)
+
+// SourceLine is the gas of the instructions compiled from one source line.
+type SourceLine struct {
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	Text         string `json:"text,omitempty"`
+	Gas          uint64 `json:"gas"`
+	Instructions int    `json:"instructions"`
+}
+
+// Label formats the line as "file:line".
+func (l SourceLine) Label() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// applySourceMap ties every instruction to its place in the source, sums
+// the gas of each source line, and annotates the loops, storage variables,
+// redundant reads and suggestions with where they come from. A nil map
+// leaves the report as it is.
+func (a *analysis) applySourceMap(m *srcmap.Map) {
+	if m == nil {
+		return
+	}
+	a.applyPositions(a.sourcePositions(m), m)
+}
+
+// sourcePositions returns the source position of each instruction by pc.
+// The map counts instructions in code order, as a static trace lists them.
+func (a *analysis) sourcePositions(m *srcmap.Map) map[int]srcmap.Position {
+	positions := map[int]srcmap.Position{}
+	for i, t := range a.trace {
+		if pos, ok := m.Position(i); ok {
+			positions[t.ins.PC] = pos
+		}
+	}
+	return positions
+}
+
+// applyPositions does the work of applySourceMap given the position of
+// every instruction, so that an execution trace, in which instructions
+// repeat, can use the positions of the static one.
+func (a *analysis) applyPositions(positions map[int]srcmap.Position, m *srcmap.Map) {
+	a.positions = positions
+	lines := map[srcmap.Position]*SourceLine{}
+	for _, t := range a.trace {
+		pos, ok := positions[t.ins.PC]
+		if !ok {
+			continue
+		}
+		if t.dead || pos.Line == 0 {
+			continue
+		}
+		key := srcmap.Position{File: pos.File, Line: pos.Line}
+		l := lines[key]
+		if l == nil {
+			l = &SourceLine{File: pos.File, Line: pos.Line, Text: strings.TrimSpace(m.Line(pos.File, pos.Line))}
+			lines[key] = l
+		}
+		l.Gas += t.static + t.dynamic.Gas
+		l.Instructions++
+	}
+
+	report := a.report
+	report.SourceLines = report.SourceLines[:0]
+	for _, l := range lines {
+		report.SourceLines = append(report.SourceLines, *l)
+	}
+	sort.Slice(report.SourceLines, func(i, j int) bool {
+		x, y := report.SourceLines[i], report.SourceLines[j]
+		if x.Gas != y.Gas {
+			return x.Gas > y.Gas
+		}
+		if x.File != y.File {
+			return x.File < y.File
+		}
+		return x.Line < y.Line
+	})
+
+	for i := range a.loopTracker.Loops {
+		a.loopTracker.Loops[i].Source = a.source(a.loopTracker.Loops[i].StartPC)
+	}
+	report.Loops = a.loopTracker.Loops
+	for i := range report.RedundantLoads {
+		report.RedundantLoads[i].Source = a.source(report.RedundantLoads[i].PC)
+	}
+	for i := range report.StorageVariables {
+		v := &report.StorageVariables[i]
+		v.Sources = nil
+		for _, pc := range v.pcs {
+			if s := a.source(pc); s != "" && !slices.Contains(v.Sources, s) {
+				v.Sources = append(v.Sources, s)
+			}
+		}
+	}
+	for i, s := range a.optimizations {
+		if s.PC == NoPC {
+			continue
+		}
+		if src := a.source(s.PC); src != "" {
+			report.Optimizations[i] = s.Text + " [" + src + "]"
+		}
+	}
+}
+
+// source returns where the instruction at pc comes from, or "".
+func (a *analysis) source(pc int) string {
+	if pos, ok := a.positions[pc]; ok {
+		return pos.String()
+	}
+	return ""
+}
+
+// printSourceHeatmap charts the source lines that cost the most gas.
+func printSourceHeatmap(lines []SourceLine, limit, maxWidth int) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Println("\n=== Source Line Heatmap ===")
+	top := lines[:min(limit, len(lines))]
+	width := 0
+	for _, l := range top {
+		width = max(width, len(l.Label()))
+	}
+	for _, l := range top {
+		n := int(l.Gas * uint64(maxWidth) / max(top[0].Gas, 1))
+		bar := strings.Repeat("█", n) + strings.Repeat(" ", maxWidth-n)
+		fmt.Printf("%-*s |%s %6d gas  %s\n", width, l.Label(), bar, l.Gas, l.Text)
+	}
+	if len(lines) > limit {
+		fmt.Printf("... %d more lines\n", len(lines)-limit)
+	}
+}
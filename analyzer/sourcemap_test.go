@@ -0,0 +1,43 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"gaslens/srcmap"
+)
+
+func TestApplySourceMapTiesSuggestionsToTheirPC(t *testing.T) {
+	schedule, err := NewGasSchedule(DefaultFork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The storage array loop of TestLoopBounds, whose header is at PC 1.
+	a := analyzeCode(arrayLengthLoop, schedule)
+	// Instruction 1 is the header; everything else is generated code.
+	m := &srcmap.Map{Sources: map[int]*srcmap.Source{0: srcmap.NewSource("L.sol", []byte("for (;;) {}\n"))}}
+	for i := range a.trace {
+		e := srcmap.Entry{File: -1}
+		if i == 1 {
+			e.File = 0
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	a.applySourceMap(m)
+
+	var loop, general string
+	for _, s := range a.report.Optimizations {
+		switch {
+		case strings.HasPrefix(s, "Loop at PC 1-28"):
+			loop = s
+		case strings.HasPrefix(s, "Consider gas limits"):
+			general = s
+		}
+	}
+	if !strings.HasSuffix(loop, " [L.sol:1:1]") {
+		t.Errorf("loop suggestion = %q, want it tied to L.sol:1:1", loop)
+	}
+	if strings.Contains(general, "[") {
+		t.Errorf("general suggestion = %q, want no source", general)
+	}
+}
@@ -1,40 +1,338 @@
 package analyzer
 
+import (
+	"gaslens/disasm"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// StackEngine simulates the EVM stack over abstract 256-bit values.
+// Constants are folded exactly through arithmetic, bitwise and shift
+// instructions, and inputs such as calldata become symbols, so results are
+// either concrete, symbolic or unknown.
+//
+// Memory holds the words stored at constant offsets, so that KECCAK256 can
+// see what it hashes and MLOAD can read back what was stored.
 type StackEngine struct {
-	Stack []uint64
+	Stack  []Value
+	Memory map[uint64]Value
 }
 
-func (se *StackEngine) Push(v uint64) {
+func (se *StackEngine) Push(v Value) {
 	se.Stack = append(se.Stack, v)
 }
 
-func (se *StackEngine) Pop() uint64 {
+// PushUnknown pushes a value the engine cannot compute.
+func (se *StackEngine) PushUnknown() {
+	se.Push(Unknown())
+}
+
+// Pop removes and returns the top value; an empty stack yields unknown.
+func (se *StackEngine) Pop() Value {
 	if len(se.Stack) == 0 {
-		return 0
+		return Unknown()
 	}
-	v := se.Stack[len(se.Stack)-1]
-	se.Stack = se.Stack[:len(se.Stack)-1]
+	top := len(se.Stack) - 1
+	v := se.Stack[top]
+	se.Stack = se.Stack[:top]
 	return v
 }
 
-func (se *StackEngine) Peek(n int) uint64 {
+// Peek returns the nth value from the top.
+func (se *StackEngine) Peek(n int) Value {
 	idx := len(se.Stack) - 1 - n
 	if idx < 0 {
-		return 0
+		return Unknown()
 	}
 	return se.Stack[idx]
 }
 
+// PeekKnown returns the nth value from the top when it is a constant that
+// fits in 64 bits, as offsets, sizes and addresses of interest do.
+func (se *StackEngine) PeekKnown(n int) (uint64, bool) {
+	return se.Peek(n).Uint64()
+}
+
 func (se *StackEngine) Dup(n int) {
-	v := se.Peek(n - 1)
-	se.Push(v)
+	se.Push(se.Peek(n - 1))
 }
 
 func (se *StackEngine) Swap(n int) {
+	se.Exchange(0, n)
+}
+
+// Exchange swaps the values at depths i and j from the top.
+func (se *StackEngine) Exchange(i, j int) {
 	top := len(se.Stack) - 1
-	idx := top - n
-	if idx < 0 {
+	if top-i < 0 || top-j < 0 {
+		return
+	}
+	se.Stack[top-i], se.Stack[top-j] = se.Stack[top-j], se.Stack[top-i]
+}
+
+// Forget marks every value on the stack and in memory as unknown.
+func (se *StackEngine) Forget() {
+	for i := range se.Stack {
+		se.Stack[i] = Unknown()
+	}
+	se.Memory = nil
+}
+
+// clone returns an independent copy of se.
+func (se *StackEngine) clone() *StackEngine {
+	out := &StackEngine{Stack: append([]Value(nil), se.Stack...)}
+	if se.Memory != nil {
+		out.Memory = make(map[uint64]Value, len(se.Memory))
+		for k, v := range se.Memory {
+			out.Memory[k] = v
+		}
+	}
+	return out
+}
+
+// meet keeps what se and o agree on: the values at the same depth from the
+// top of both stacks, down to the shorter one, and the memory words both
+// hold. Anything else becomes unknown.
+func (se *StackEngine) meet(o *StackEngine) *StackEngine {
+	n := min(len(se.Stack), len(o.Stack))
+	out := &StackEngine{Stack: make([]Value, n)}
+	for i := 0; i < n; i++ {
+		if v := se.Peek(i); v.Equal(o.Peek(i)) {
+			out.Stack[n-1-i] = v
+		}
+	}
+	for k, v := range se.Memory {
+		if w, ok := o.Memory[k]; ok && v.Equal(w) {
+			if out.Memory == nil {
+				out.Memory = map[uint64]Value{}
+			}
+			out.Memory[k] = v
+		}
+	}
+	return out
+}
+
+// same reports whether se and o hold the same state.
+func (se *StackEngine) same(o *StackEngine) bool {
+	if len(se.Stack) != len(o.Stack) || len(se.Memory) != len(o.Memory) {
+		return false
+	}
+	for i, v := range se.Stack {
+		if !sameState(v, o.Stack[i]) {
+			return false
+		}
+	}
+	for k, v := range se.Memory {
+		if w, ok := o.Memory[k]; !ok || !sameState(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameState is Equal, except that two unknowns count as the same.
+func sameState(a, b Value) bool {
+	return a.IsUnknown() && b.IsUnknown() || a.Equal(b)
+}
+
+// EntryStacks returns the state each reachable block of g is entered with,
+// keyed by its start pc: the meet of what every edge into it leaves behind,
+// propagated to a fixed point from an empty stack at pc 0. When some jumps
+// could not be resolved any JUMPDEST may be entered from them, so nothing
+// is known on entry to one.
+func (g *CFG) EntryStacks() map[int]*StackEngine {
+	entries := map[int]*StackEngine{}
+	if len(g.Blocks) == 0 {
+		return entries
+	}
+	open := len(g.Unresolved) > 0
+	first := g.Blocks[0].Start
+	entries[first] = &StackEngine{}
+	work := []int{first}
+	queued := map[int]bool{first: true}
+	for len(work) > 0 {
+		b := g.Block(work[0])
+		work = work[1:]
+		queued[b.Start] = false
+
+		se := entries[b.Start].clone()
+		for _, ins := range b.Instructions {
+			se.Step(ins)
+		}
+		for _, e := range b.Succs {
+			next := se.clone()
+			if prev, ok := entries[e.To]; ok {
+				next = prev.meet(se)
+			}
+			if open && g.JumpDests[e.To] {
+				next.Forget()
+			}
+			if prev, ok := entries[e.To]; ok && prev.same(next) {
+				continue
+			}
+			entries[e.To] = next
+			if !queued[e.To] {
+				queued[e.To] = true
+				work = append(work, e.To)
+			}
+		}
+	}
+	return entries
+}
+
+// memoryWrites gives the offset and size operands of the memory each
+// instruction other than MSTORE and MSTORE8 writes.
+var memoryWrites = map[vm.OpCode][2]int{
+	vm.CALLDATACOPY:   {0, 2},
+	vm.CODECOPY:       {0, 2},
+	vm.RETURNDATACOPY: {0, 2},
+	vm.EXTCODECOPY:    {1, 3},
+	vm.MCOPY:          {0, 2},
+	vm.CALL:           {5, 6},
+	vm.CALLCODE:       {5, 6},
+	vm.DELEGATECALL:   {4, 5},
+	vm.STATICCALL:     {4, 5},
+	vm.DATACOPY:       {0, 2},
+}
+
+// store records v as the word at off.
+func (se *StackEngine) store(off, v Value) {
+	se.clobber(off, ConstUint64(32))
+	if at, ok := off.Uint64(); ok {
+		if se.Memory == nil {
+			se.Memory = map[uint64]Value{}
+		}
+		se.Memory[at] = v
+	}
+}
+
+// clobber forgets the words overlapping size bytes at off, or all of memory
+// when the range is not known.
+func (se *StackEngine) clobber(off, size Value) {
+	n, nOK := size.Uint64()
+	if nOK && n == 0 {
 		return
 	}
-	se.Stack[top], se.Stack[idx] = se.Stack[idx], se.Stack[top]
+	at, atOK := off.Uint64()
+	if !atOK || !nOK || n > maxModelledMemory {
+		se.Memory = nil
+		return
+	}
+	for k := range se.Memory {
+		if k < at+n && k+32 > at {
+			delete(se.Memory, k)
+		}
+	}
+}
+
+// clobberWrites forgets the memory op is about to write. It must be called
+// before op's operands are popped.
+func (se *StackEngine) clobberWrites(op vm.OpCode) {
+	if w, ok := memoryWrites[op]; ok {
+		se.clobber(se.Peek(w[0]), se.Peek(w[1]))
+	}
+}
+
+// words returns the n words stored from off, if all are known.
+func (se *StackEngine) words(off Value, size Value) ([]Value, bool) {
+	at, atOK := off.Uint64()
+	n, nOK := size.Uint64()
+	if !atOK || !nOK || n == 0 || n%32 != 0 || n > 64 {
+		return nil, false
+	}
+	out := make([]Value, n/32)
+	for i := range out {
+		v, ok := se.Memory[at+uint64(32*i)]
+		if !ok {
+			return nil, false
+		}
+		out[i] = v
+	}
+	return out, true
+}
+
+// Step applies ins to the stack. It follows a single path: callers entering
+// a block from elsewhere seed the engine with the block's entry state.
+func (se *StackEngine) Step(ins disasm.Instruction) {
+	op := ins.Op
+	switch {
+	case op == vm.PUSH0:
+		se.Push(ConstUint64(0))
+
+	case op >= vm.PUSH1 && op <= vm.PUSH32:
+		se.Push(pushValue(ins))
+
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		se.Dup(int(op-vm.DUP1) + 1)
+
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		se.Swap(int(op-vm.SWAP1) + 1)
+
+	case op == vm.JUMPDEST:
+
+	case op == vm.MSTORE:
+		off, v := se.Pop(), se.Pop()
+		se.store(off, v)
+
+	case op == vm.MSTORE8:
+		off := se.Pop()
+		se.Pop()
+		se.clobber(off, ConstUint64(1))
+
+	case op == vm.MLOAD:
+		off := se.Pop()
+		if words, ok := se.words(off, ConstUint64(32)); ok {
+			se.Push(words[0])
+			return
+		}
+		se.Push(evalOp(op, []Value{off}, ins.PC))
+
+	case op == vm.KECCAK256:
+		off, size := se.Pop(), se.Pop()
+		if words, ok := se.words(off, size); ok {
+			if v, ok := hashSlot(words, ins.PC); ok {
+				se.Push(v)
+				return
+			}
+		}
+		se.Push(evalOp(op, []Value{off, size}, ins.PC))
+
+	default:
+		se.clobberWrites(op)
+		pops, pushes := StackArity(op)
+		args := make([]Value, pops)
+		for i := range args {
+			args[i] = se.Pop()
+		}
+		if pushes == 1 {
+			se.Push(evalOp(op, args, ins.PC))
+		}
+	}
+}
+
+// pushValue is the full 256-bit immediate of a PUSH. A PUSH cut short by
+// the end of the code reads zeros for the missing bytes, as the EVM does.
+func pushValue(ins disasm.Instruction) Value {
+	imm := make([]byte, disasm.ImmediateSize(ins.Op))
+	copy(imm, ins.Immediate)
+	return Const(new(uint256.Int).SetBytes(imm))
+}
+
+// opPops and opPushes hold the stack arity of every opcode, taken from
+// go-ethereum's latest instruction set.
+var opPops, opPushes [256]int
+
+func init() {
+	jt, _ := vm.LookupInstructionSet(forkRules(len(Forks) - 1))
+	for i, op := range jt {
+		minStack, maxStack := op.Stack()
+		opPops[i] = minStack
+		opPushes[i] = minStack + int(params.StackLimit) - maxStack
+	}
+}
+
+// StackArity returns how many items op pops from and pushes onto the stack.
+func StackArity(op vm.OpCode) (pops, pushes int) {
+	return opPops[op], opPushes[op]
 }
@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"testing"
+
+	"gaslens/disasm"
+)
+
+// mappingAcrossJump hashes the key 0x42 with slot 1 in one block and reads
+// the resulting slot after jumping to another.
+//
+//	0: PUSH1 0x42  2: PUSH0  3: MSTORE  4: PUSH1 1  6: PUSH1 0x20  8: MSTORE
+//	9: PUSH1 0x40  11: PUSH0  12: KECCAK256  13: PUSH1 16  15: JUMP
+//	16: JUMPDEST  17: SLOAD  18: STOP
+var mappingAcrossJump = []byte{
+	0x60, 0x42, 0x5f, 0x52, 0x60, 0x01, 0x60, 0x20, 0x52,
+	0x60, 0x40, 0x5f, 0x20, 0x60, 0x10, 0x56,
+	0x5b, 0x54, 0x00,
+}
+
+func TestEntryStacks(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  []byte
+		block int
+		want  []string // bottom first
+	}{
+		{
+			name:  "slot hashed before a jump",
+			code:  mappingAcrossJump,
+			block: 16,
+			want:  []string{"mapping(slot 1)[66]"},
+		},
+		{
+			name: "predecessors that disagree leave the value unknown",
+			// 0: CALLVALUE  1: PUSH1 10  3: JUMPI  4: PUSH1 1  6: PUSH1 13  8: JUMP
+			// 9: INVALID  10: JUMPDEST  11: PUSH1 2  13: JUMPDEST  14: STOP
+			code:  []byte{0x34, 0x60, 0x0a, 0x57, 0x60, 0x01, 0x60, 0x0d, 0x56, 0xfe, 0x5b, 0x60, 0x02, 0x5b, 0x00},
+			block: 13,
+			want:  []string{UnresolvedSlot},
+		},
+		{
+			name: "predecessors that agree keep the value",
+			// 0: PUSH1 7  2: CALLVALUE  3: PUSH1 9  5: JUMPI  6: PUSH1 9  8: JUMP
+			// 9: JUMPDEST  10: STOP
+			code:  []byte{0x60, 0x07, 0x34, 0x60, 0x09, 0x57, 0x60, 0x09, 0x56, 0x5b, 0x00},
+			block: 9,
+			want:  []string{"7"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, ok := BuildCFG(disasm.Disassemble(tt.code)).EntryStacks()[tt.block]
+			if !ok {
+				t.Fatalf("no entry state for block %d", tt.block)
+			}
+			var got []string
+			for _, v := range entry.Stack {
+				got = append(got, v.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("entry stack = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry stack = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestEntryStacksForgetWithUnresolvedJumps(t *testing.T) {
+	// 0: PUSH1 7  2: CALLVALUE  3: PUSH1 9  5: JUMPI  6: CALLVALUE  7: JUMP
+	// 8: INVALID  9: JUMPDEST  10: STOP
+	g := BuildCFG(disasm.Disassemble([]byte{0x60, 0x07, 0x34, 0x60, 0x09, 0x57, 0x34, 0x56, 0xfe, 0x5b, 0x00}))
+	entry := g.EntryStacks()[9]
+	if entry == nil || len(entry.Stack) != 1 || !entry.Stack[0].IsUnknown() {
+		t.Errorf("entry state = %+v, want one unknown value, since the jump at 7 may land here", entry)
+	}
+}
+
+func TestAnalyzeCodeLabelsSlotsAcrossBlocks(t *testing.T) {
+	schedule, err := NewGasSchedule(DefaultFork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := analyzeCode(mappingAcrossJump, schedule)
+	if n := a.storage.SLoadCount["mapping(slot 1)[66]"]; n != 1 {
+		t.Errorf("SLoadCount = %v, want one read of mapping(slot 1)[66]", a.storage.SLoadCount)
+	}
+}
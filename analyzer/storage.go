@@ -1,13 +1,309 @@
 package analyzer
 
+import (
+	"slices"
+	"sort"
+
+	"gaslens/disasm"
+	"gaslens/layout"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// StorageGas breaks storage gas down by the EIP-2929/2200/3529 component
+// that charged it. Refund can go negative while a transaction runs, because
+// later writes may take back a refund granted earlier. Transient is what
+// TLOAD and TSTORE (EIP-1153) cost, which is always the warm price.
+type StorageGas struct {
+	ColdAccess uint64 `json:"cold_access"`
+	WarmAccess uint64 `json:"warm_access"`
+	Set        uint64 `json:"set"`
+	Reset      uint64 `json:"reset"`
+	Refund     int64  `json:"refund"`
+	Transient  uint64 `json:"transient"`
+}
+
+// AccountAccessGas counts the account-touching opcodes (BALANCE, EXTCODE*,
+// the CALL family and SELFDESTRUCT) by whether the address was cold.
+type AccountAccessGas struct {
+	ColdAccesses int    `json:"cold_accesses"`
+	WarmAccesses int    `json:"warm_accesses"`
+	ColdGas      uint64 `json:"cold_gas"`
+}
+
+// UnresolvedSlot keys the accesses whose slot could not be resolved at all.
+// They are not necessarily to the same slot.
+const UnresolvedSlot = "unknown"
+
+// StorageTracker counts and prices storage and account accesses. Slots are
+// keyed by their Value's string: a decimal or hex constant, a symbolic
+// expression, or UnresolvedSlot. Transient storage is a separate space with
+// its own counts.
 type StorageTracker struct {
-	SLoadCount  map[uint64]int
-	SStoreCount map[uint64]int
+	SLoadCount  map[string]int
+	SStoreCount map[string]int
+	TLoadCount  map[string]int
+	TStoreCount map[string]int
+	Variables   map[string]*StorageVariable // keyed by declared slot
+	Layout      *layout.Layout              // names slots when set
+	Gas         StorageGas
+	Accounts    AccountAccessGas
+
+	// Per-transaction access sets. The whole contract is treated as one
+	// transaction, so the first touch of a slot or address is cold.
+	slots        map[string]*slotState
+	warmAccounts map[string]bool
+
+	// What the packing advisor needs: every access by pc, and the fields
+	// masks revealed in fixed slots.
+	accesses []slotAccess
+	fields   map[string][]packedField
+
+	// Constant writes, for reentrancy guard detection.
+	writes []slotWrite
+}
+
+// slotState tracks a slot's original and current value for the SSTORE
+// pricing matrix. The original value is never read from chain, so it is
+// assumed at the first write: zero when a nonzero (or unknown) value is
+// stored, which prices the write as the more expensive set.
+type slotState struct {
+	original Value
+	current  Value
+	written  bool
 }
 
 func NewStorageTracker() *StorageTracker {
 	return &StorageTracker{
-		SLoadCount:  make(map[uint64]int),
-		SStoreCount: make(map[uint64]int),
+		SLoadCount:   make(map[string]int),
+		SStoreCount:  make(map[string]int),
+		TLoadCount:   make(map[string]int),
+		TStoreCount:  make(map[string]int),
+		Variables:    make(map[string]*StorageVariable),
+		slots:        make(map[string]*slotState),
+		warmAccounts: make(map[string]bool),
+		fields:       make(map[string][]packedField),
+	}
+}
+
+// Track counts the slot touched by an SLOAD, SSTORE, TLOAD or TSTORE, and
+// notes the field widths masks reveal. It must be called before the
+// instruction is applied to the engine.
+func (st *StorageTracker) Track(ins disasm.Instruction, engine *StackEngine) {
+	switch ins.Op {
+	case vm.SLOAD:
+		st.count(engine.Peek(0), false, ins.PC)
+
+	case vm.SSTORE:
+		st.count(engine.Peek(0), true, ins.PC)
+		st.noteWrite(ins.PC, engine.Peek(0), engine.Peek(1))
+
+	case vm.TLOAD:
+		st.TLoadCount[engine.Peek(0).String()]++
+
+	case vm.TSTORE:
+		st.TStoreCount[engine.Peek(0).String()]++
+
+	case vm.AND:
+		st.noteMask(engine.Peek(0), engine.Peek(1))
+	}
+}
+
+// Charge returns the storage and account access gas of op on top of its
+// static cost, given the operands on the engine's stack, and updates the
+// access sets. It must be called before the instruction is applied to the
+// engine. Slots and addresses that cannot be resolved are priced cold.
+func (st *StorageTracker) Charge(op vm.OpCode, engine *StackEngine, schedule *GasSchedule) uint64 {
+	switch op {
+	case vm.SLOAD:
+		return st.chargeSLoad(engine.Peek(0), schedule)
+
+	case vm.SSTORE:
+		return st.chargeSStore(engine.Peek(0), engine.Peek(1), schedule)
+
+	case vm.TLOAD, vm.TSTORE:
+		// Priced entirely by the static cost; only the ledger is updated.
+		if gas, ok := schedule.GetGasCost(op); ok {
+			st.Gas.Transient += gas
+		}
+
+	case vm.BALANCE, vm.EXTCODESIZE, vm.EXTCODECOPY, vm.EXTCODEHASH, vm.SELFDESTRUCT:
+		return st.chargeAccount(op, engine, 0, schedule)
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		return st.chargeAccount(op, engine, 1, schedule)
+
+	case vm.EXTCALL, vm.EXTDELEGATECALL, vm.EXTSTATICCALL:
+		if schedule.eof {
+			return st.chargeAccount(op, engine, 0, schedule)
+		}
+	}
+	return 0
+}
+
+// touchSlot marks slot warm and returns the cold surcharge for this access.
+// Concrete and symbolic slots are remembered; unknown ones are always cold.
+func (st *StorageTracker) touchSlot(slot Value, schedule *GasSchedule) (*slotState, uint64) {
+	known := !slot.IsUnknown()
+	state, warm := st.slots[slot.String()]
+	if !known || !warm {
+		state = &slotState{}
+		if known {
+			st.slots[slot.String()] = state
+		}
+		if schedule.IsAtLeast("berlin") {
+			st.Gas.ColdAccess += params.ColdSloadCostEIP2929
+			return state, params.ColdSloadCostEIP2929
+		}
+	}
+	return state, 0
+}
+
+func (st *StorageTracker) chargeSLoad(slot Value, schedule *GasSchedule) uint64 {
+	_, cold := st.touchSlot(slot, schedule)
+	if cold > 0 || !schedule.IsAtLeast("berlin") {
+		// Before Berlin the read is fully priced by the static cost.
+		return cold
+	}
+	st.Gas.WarmAccess += params.WarmStorageReadCostEIP2929
+	return params.WarmStorageReadCostEIP2929
+}
+
+func (st *StorageTracker) chargeSStore(slot, value Value, schedule *GasSchedule) uint64 {
+	state, gas := st.touchSlot(slot, schedule)
+	if !state.written {
+		// Assume the original value that makes this write the costlier one.
+		state.original = ConstUint64(0)
+		if value.IsZero() {
+			state.original = ConstUint64(1)
+		}
+		state.current = state.original
+		state.written = true
+	}
+	original, current := state.original, state.current
+	state.current = value
+
+	// Constantinople metered writes by EIP-1283, which Petersburg reverted
+	// and EIP-2200 brought back in Istanbul with a dearer no-op.
+	eip1283 := schedule.rules.IsConstantinople && !schedule.rules.IsPetersburg
+	if !schedule.IsAtLeast("istanbul") && !eip1283 {
+		return gas + st.chargeLegacySStore(current, value)
+	}
+
+	sloadGas := params.SloadGasEIP2200
+	resetGas := params.SstoreResetGasEIP2200
+	clearRefund := int64(params.SstoreClearsScheduleRefundEIP2200)
+	if eip1283 {
+		sloadGas, resetGas, clearRefund = params.NetSstoreDirtyGas, params.NetSstoreCleanGas, int64(params.NetSstoreClearRefund)
+	}
+	if schedule.IsAtLeast("berlin") {
+		sloadGas = params.WarmStorageReadCostEIP2929
+		resetGas -= params.ColdSloadCostEIP2929
+	}
+	if schedule.IsAtLeast("london") {
+		clearRefund = int64(params.SstoreClearsScheduleRefundEIP3529)
+	}
+
+	switch {
+	case sameValue(current, value):
+		st.Gas.WarmAccess += sloadGas
+		return gas + sloadGas
+
+	case sameValue(original, current):
+		if isZero(original) {
+			st.Gas.Set += params.SstoreSetGasEIP2200
+			return gas + params.SstoreSetGasEIP2200
+		}
+		if isZero(value) {
+			st.Gas.Refund += clearRefund
+		}
+		st.Gas.Reset += resetGas
+		return gas + resetGas
+	}
+
+	if !isZero(original) {
+		if isZero(current) {
+			st.Gas.Refund -= clearRefund
+		}
+		if isZero(value) {
+			st.Gas.Refund += clearRefund
+		}
+	}
+	if sameValue(original, value) {
+		if isZero(original) {
+			st.Gas.Refund += int64(params.SstoreSetGasEIP2200 - sloadGas)
+		} else {
+			st.Gas.Refund += int64(resetGas - sloadGas)
+		}
+	}
+	st.Gas.WarmAccess += sloadGas
+	return gas + sloadGas
+}
+
+// chargeLegacySStore prices an SSTORE before EIP-2200: a set when a zero
+// slot becomes nonzero, otherwise a reset, with a refund for clearing.
+func (st *StorageTracker) chargeLegacySStore(current, value Value) uint64 {
+	if isZero(current) && !isZero(value) {
+		st.Gas.Set += params.SstoreSetGas
+		return params.SstoreSetGas
+	}
+	if !isZero(current) && isZero(value) {
+		st.Gas.Refund += int64(params.SstoreRefundGas)
+	}
+	st.Gas.Reset += params.SstoreResetGas
+	return params.SstoreResetGas
+}
+
+// chargeAccount prices the EIP-2929 cold account surcharge for the address
+// at stack position arg. The static cost already includes the warm read,
+// except for SELFDESTRUCT which pays the full cold cost.
+func (st *StorageTracker) chargeAccount(op vm.OpCode, engine *StackEngine, arg int, schedule *GasSchedule) uint64 {
+	if !schedule.IsAtLeast("berlin") {
+		return 0
+	}
+	addr := engine.Peek(arg)
+	known := !addr.IsUnknown()
+	precompile := false
+	if a, ok := addr.Uint64(); ok {
+		precompile = schedule.IsPrecompile(a)
+	}
+	if known && (st.warmAccounts[addr.String()] || precompile) {
+		st.Accounts.WarmAccesses++
+		return 0
+	}
+	if known {
+		st.warmAccounts[addr.String()] = true
+	}
+	cold := params.ColdAccountAccessCostEIP2929 - params.WarmStorageReadCostEIP2929
+	if op == vm.SELFDESTRUCT {
+		cold = params.ColdAccountAccessCostEIP2929
+	}
+	st.Accounts.ColdAccesses++
+	st.Accounts.ColdGas += cold
+	return cold
+}
+
+// sameValue reports whether a and b are provably equal.
+func sameValue(a, b Value) bool {
+	return a.Equal(b)
+}
+
+// isZero reports whether v is provably zero.
+func isZero(v Value) bool {
+	return v.IsZero()
+}
+
+// sortedSlotKeys returns the slots counted in any of counts, ordered
+// numerically where they are numbers.
+func sortedSlotKeys(counts ...map[string]int) []string {
+	var keys []string
+	for _, m := range counts {
+		for k := range m {
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
 	}
+	sort.Slice(keys, func(i, j int) bool { return slotLess(keys[i], keys[j]) })
+	return keys
 }
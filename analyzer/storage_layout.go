@@ -0,0 +1,140 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gaslens/layout"
+	"github.com/holiman/uint256"
+)
+
+// derivedBase matches the declared slot a mapping or array label is
+// derived from, e.g. "mapping(slot 1)" in "mapping(slot 1)[caller]".
+var derivedBase = regexp.MustCompile(`(mapping|array)\(slot (\w+)\)`)
+
+// slotWord parses a slot key rendered by Value.String.
+func slotWord(key string) (*uint256.Int, bool) {
+	if strings.HasPrefix(key, "0x") {
+		w, err := uint256.FromHex(key)
+		return w, err == nil
+	}
+	w, err := uint256.FromDecimal(key)
+	return w, err == nil
+}
+
+// fieldsAt returns the declared fields at a constant slot key.
+func (st *StorageTracker) fieldsAt(key string) []layout.Field {
+	if st.Layout == nil {
+		return nil
+	}
+	w, ok := slotWord(key)
+	if !ok {
+		return nil
+	}
+	return st.Layout.At(w)
+}
+
+// describe renders a slot key with the names of the variables it holds:
+// "0 (owner, paused)" for a fixed slot, "balances[caller]" for a mapping
+// entry. Without a layout the key is returned as is.
+func (st *StorageTracker) describe(key string) string {
+	if st.Layout == nil {
+		return key
+	}
+	if fields := st.fieldsAt(key); len(fields) > 0 {
+		return fmt.Sprintf("%s (%s)", key, fieldNames(fields))
+	}
+	return derivedBase.ReplaceAllStringFunc(key, func(m string) string {
+		base := derivedBase.FindStringSubmatch(m)[2]
+		if name := containerName(st.fieldsAt(base)); name != "" {
+			return name
+		}
+		return m
+	})
+}
+
+// containerName returns the name of the mapping or array among fields.
+func containerName(fields []layout.Field) string {
+	for _, f := range fields {
+		if f.Encoding != layout.Inplace {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+func fieldNames(fields []layout.Field) string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// annotate names v from the layout and renames its locations.
+func (st *StorageTracker) annotate(v *StorageVariable) {
+	fields := st.fieldsAt(v.Slot)
+	if len(fields) == 0 {
+		return
+	}
+	switch v.Kind {
+	case VariableMapping, VariableArray:
+		for _, f := range fields {
+			if f.Encoding != layout.Inplace {
+				v.Name, v.Type = f.Name, f.Type
+			}
+		}
+		locations := make([]string, len(v.Locations))
+		for i, loc := range v.Locations {
+			locations[i] = st.describe(loc)
+		}
+		v.Locations = locations
+	case VariableValue:
+		v.Fields = fields
+		v.Name = fieldNames(fields)
+		if len(fields) == 1 {
+			v.Type = fields[0].Type
+		}
+	}
+}
+
+// packingSuggestions names the variables that share a slot written more
+// than once, and the under-filled slots that could be merged by reordering
+// declarations.
+func packingSuggestions(st *StorageTracker) []string {
+	var out []string
+	var movable []layout.Slot
+	for _, s := range st.Layout.Slots() {
+		key := Const(s.Slot).String()
+		if writes := st.SStoreCount[key]; len(s.Fields) > 1 && writes > 1 {
+			out = append(out, fmt.Sprintf("%s share slot %s, written %d times - update them together so the slot is written once",
+				fieldNames(s.Fields), key, writes))
+		}
+		if s.Movable && s.Used < 32 {
+			movable = append(movable, s)
+		}
+	}
+
+	paired := make([]bool, len(movable))
+	for i := range movable {
+		for j := i + 1; j < len(movable) && !paired[i]; j++ {
+			if paired[j] || movable[i].Used+movable[j].Used > 32 {
+				continue
+			}
+			paired[i], paired[j] = true, true
+			out = append(out, fmt.Sprintf("Declare %s (slot %s, %d bytes) next to %s (slot %s, %d bytes) so they share one slot",
+				fieldTypes(movable[j].Fields), Const(movable[j].Slot), movable[j].Used,
+				fieldTypes(movable[i].Fields), Const(movable[i].Slot), movable[i].Used))
+		}
+	}
+	return out
+}
+
+func fieldTypes(fields []layout.Field) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = fmt.Sprintf("%s %s", f.Type, f.Name)
+	}
+	return strings.Join(parts, ", ")
+}
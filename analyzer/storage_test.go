@@ -0,0 +1,133 @@
+package analyzer
+
+import "testing"
+
+func TestChargeSStore(t *testing.T) {
+	type write struct {
+		slot, value uint64
+		gas         uint64
+	}
+	tests := []struct {
+		name   string
+		fork   string
+		writes []write
+		refund int64
+	}{
+		{
+			name: "london set, no-op, dirty write, restore to original zero",
+			fork: "london",
+			writes: []write{
+				{0, 5, 2100 + 20000}, // cold, assumed zero before
+				{0, 5, 100},          // no-op
+				{0, 7, 100},          // dirty
+				{0, 0, 100},          // back to the original zero
+			},
+			refund: 20000 - 100,
+		},
+		{
+			name:   "london clear",
+			fork:   "london",
+			writes: []write{{1, 0, 2100 + 2900}}, // assumed nonzero before
+			refund: 4800,
+		},
+		{
+			name: "london clear then rewrite takes the refund back",
+			fork: "london",
+			writes: []write{
+				{1, 0, 2100 + 2900},
+				{1, 3, 100},
+			},
+			refund: 0,
+		},
+		{
+			name:   "berlin clear refunds the EIP-2200 amount",
+			fork:   "berlin",
+			writes: []write{{1, 0, 2100 + 2900}},
+			refund: 15000,
+		},
+		{
+			name: "istanbul has no cold surcharge",
+			fork: "istanbul",
+			writes: []write{
+				{0, 5, 20000},
+				{0, 5, 800},
+				{2, 0, 5000},
+			},
+			refund: 15000,
+		},
+		{
+			name: "constantinople net metering",
+			fork: "constantinople",
+			writes: []write{
+				{0, 5, 20000},
+				{0, 5, 200}, // no-op
+				{0, 0, 200}, // back to the original zero
+				{1, 0, 5000},
+				{1, 4, 200}, // dirty, takes the clear refund back
+			},
+			refund: 19800,
+		},
+		{
+			name: "petersburg reverts to the legacy rule",
+			fork: "petersburg",
+			writes: []write{
+				{0, 5, 20000},
+				{0, 5, 5000},
+				{0, 0, 5000},
+			},
+			refund: 15000,
+		},
+		{
+			name: "frontier prices by the current value only",
+			fork: "frontier",
+			writes: []write{
+				{0, 5, 20000},
+				{0, 6, 5000},
+				{0, 0, 5000},
+			},
+			refund: 15000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := NewGasSchedule(tt.fork)
+			if err != nil {
+				t.Fatal(err)
+			}
+			st := NewStorageTracker()
+			for i, w := range tt.writes {
+				if got := st.chargeSStore(ConstUint64(w.slot), ConstUint64(w.value), schedule); got != w.gas {
+					t.Errorf("write %d (slot %d = %d): gas %d, want %d", i, w.slot, w.value, got, w.gas)
+				}
+			}
+			if st.Gas.Refund != tt.refund {
+				t.Errorf("refund %d, want %d", st.Gas.Refund, tt.refund)
+			}
+		})
+	}
+}
+
+func TestChargeSLoad(t *testing.T) {
+	tests := []struct {
+		fork string
+		slot Value
+		want []uint64
+	}{
+		{"berlin", ConstUint64(3), []uint64{2100, 100, 100}},
+		{"istanbul", ConstUint64(3), []uint64{0, 0}},
+		// An unresolved slot may be a different one each time.
+		{"cancun", Unknown(), []uint64{2100, 2100}},
+	}
+	for _, tt := range tests {
+		schedule, err := NewGasSchedule(tt.fork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := NewStorageTracker()
+		for i, want := range tt.want {
+			if got := st.chargeSLoad(tt.slot, schedule); got != want {
+				t.Errorf("%s read %d of %s: gas %d, want %d", tt.fork, i, tt.slot, got, want)
+			}
+		}
+	}
+}
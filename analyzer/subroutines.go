@@ -0,0 +1,307 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Subroutine is an internal function: code entered by a JUMP from a block
+// that pushed the address it returns to. ExclusiveGas is the gas of its own
+// blocks, and InclusiveGas adds every internal function it calls, the way
+// FunctionInfo.Gas does for external functions.
+type Subroutine struct {
+	EntryPC      int      `json:"entry_pc"`
+	CallSites    []int    `json:"call_sites"` // pcs of the jumps that call it
+	Callers      []string `json:"callers"`
+	Callees      []int    `json:"callees,omitempty"`
+	Functions    []string `json:"functions,omitempty"` // external functions that reach it
+	ExclusiveGas uint64   `json:"exclusive_gas"`
+	InclusiveGas uint64   `json:"inclusive_gas"`
+
+	// callers are indices into the external functions, callerSubs entry
+	// pcs of calling subroutines, and functions indices of every external
+	// function that reaches it; the labels are rebuilt when they are named.
+	callers    []int
+	callerSubs []int
+	functions  []int
+}
+
+// Label names the subroutine by its entry, e.g. "internal@170".
+func (s Subroutine) Label() string {
+	return fmt.Sprintf("internal@%d", s.EntryPC)
+}
+
+// Shared reports whether more than one external function reaches s.
+func (s Subroutine) Shared() bool {
+	return len(s.functions) > 1
+}
+
+// callGraph finds the internal functions of g. A call is a JUMP out of a
+// block that pushed a return address, to a block from which a jump back to
+// that address is reachable.
+type callGraph struct {
+	g        *CFG
+	returnTo map[int][]int // call site block to the addresses it returns to
+	callees  map[int][]int // call site block to the subroutines it enters
+}
+
+func newCallGraph(g *CFG) *callGraph {
+	cg := &callGraph{g: g, returnTo: map[int][]int{}, callees: map[int][]int{}}
+	returnsFrom := map[int][]int{}
+	for _, b := range g.Blocks {
+		for _, e := range b.Succs {
+			if e.Kind == EdgeReturn && !slices.Contains(cg.returnTo[e.CallSite], e.To) {
+				cg.returnTo[e.CallSite] = append(cg.returnTo[e.CallSite], e.To)
+				returnsFrom[e.CallSite] = append(returnsFrom[e.CallSite], e.From)
+			}
+		}
+	}
+	reaches := map[int]map[int]bool{}
+	for site := range cg.returnTo {
+		for _, e := range g.Block(site).Succs {
+			if e.Kind != EdgeJump {
+				continue
+			}
+			if reaches[e.To] == nil {
+				reaches[e.To] = map[int]bool{}
+				for _, b := range g.ReachableFrom(e.To) {
+					reaches[e.To][b.Start] = true
+				}
+			}
+			for _, from := range returnsFrom[site] {
+				if reaches[e.To][from] {
+					cg.callees[site] = append(cg.callees[site], e.To)
+					break
+				}
+			}
+		}
+	}
+	return cg
+}
+
+// body returns the blocks of the function entered at entry, stepping over
+// the internal functions it calls, and the calls it makes as call site
+// block and subroutine entry pairs.
+func (cg *callGraph) body(entry int) ([]*Block, [][2]int) {
+	visited := map[int]bool{entry: true}
+	queue := []int{entry}
+	var calls [][2]int
+	visit := func(to int) {
+		if !visited[to] {
+			visited[to] = true
+			queue = append(queue, to)
+		}
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		b := cg.g.Block(cur)
+		if callees := cg.callees[cur]; len(callees) > 0 {
+			for _, to := range callees {
+				calls = append(calls, [2]int{cur, to})
+			}
+			for _, to := range cg.returnTo[cur] {
+				visit(to)
+			}
+			for _, e := range b.Succs {
+				if e.Kind != EdgeReturn && !slices.Contains(callees, e.To) {
+					visit(e.To)
+				}
+			}
+			continue
+		}
+		for _, e := range b.Succs {
+			if e.Kind != EdgeReturn {
+				visit(e.To)
+			}
+		}
+	}
+	var out []*Block
+	for _, b := range cg.g.Blocks {
+		if visited[b.Start] {
+			out = append(out, b)
+		}
+	}
+	return out, calls
+}
+
+// FindSubroutines detects the internal functions, prices them, and records
+// which external functions and subroutines call them.
+func (ft *FunctionTracker) FindSubroutines(g *CFG, gasByPC map[int]uint64) {
+	if g == nil || len(g.Blocks) == 0 {
+		return
+	}
+	cg := newCallGraph(g)
+	subs := map[int]*Subroutine{}
+	for _, callees := range cg.callees {
+		for _, entry := range callees {
+			if subs[entry] == nil {
+				subs[entry] = &Subroutine{EntryPC: entry}
+			}
+		}
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	owned := map[int]bool{}
+	// addCalls records calls made by sub, or by the external function fn
+	// when sub is nil.
+	addCalls := func(sub *Subroutine, fn int, calls [][2]int) {
+		for _, call := range calls {
+			owned[call[0]] = true
+			callee := subs[call[1]]
+			callee.CallSites = appendUnique(callee.CallSites, g.Block(call[0]).Last().PC)
+			if sub != nil {
+				callee.callerSubs = appendUnique(callee.callerSubs, sub.EntryPC)
+				sub.Callees = appendUnique(sub.Callees, call[1])
+				continue
+			}
+			callee.callers = appendUnique(callee.callers, fn)
+			if fn != entryCaller {
+				ft.Functions[fn].Calls = appendUnique(ft.Functions[fn].Calls, call[1])
+			}
+		}
+	}
+	entries := make([]int, 0, len(subs))
+	for entry := range subs {
+		entries = append(entries, entry)
+	}
+	sort.Ints(entries)
+	for _, entry := range entries {
+		s := subs[entry]
+		blocks, calls := cg.body(entry)
+		for _, b := range blocks {
+			for _, ins := range b.Instructions {
+				s.ExclusiveGas += gasByPC[ins.PC]
+			}
+		}
+		for _, b := range g.ReachableFrom(entry) {
+			for _, ins := range b.Instructions {
+				s.InclusiveGas += gasByPC[ins.PC]
+			}
+		}
+		addCalls(s, 0, calls)
+	}
+	reach := func(fn, entry int) {
+		for _, b := range g.ReachableFrom(entry) {
+			if s := subs[b.Start]; s != nil {
+				s.functions = appendUnique(s.functions, fn)
+			}
+		}
+	}
+	for i := range ft.Functions {
+		ft.Functions[i].Calls = nil
+		_, calls := cg.body(ft.Functions[i].EntryPC)
+		addCalls(nil, i, calls)
+		reach(i, ft.Functions[i].EntryPC)
+	}
+	// Calls from code no function owns, like the fallback, are made by the
+	// contract's entry.
+	_, calls := cg.body(g.Blocks[0].Start)
+	var unowned [][2]int
+	for _, call := range calls {
+		if !owned[call[0]] {
+			unowned = append(unowned, call)
+			reach(entryCaller, call[1])
+		}
+	}
+	addCalls(nil, entryCaller, unowned)
+
+	ft.Subroutines = ft.Subroutines[:0]
+	for _, entry := range entries {
+		s := subs[entry]
+		sort.Ints(s.CallSites)
+		sort.Ints(s.Callees)
+		sort.Ints(s.callerSubs)
+		ft.Subroutines = append(ft.Subroutines, *s)
+	}
+	for i := range ft.Functions {
+		sort.Ints(ft.Functions[i].Calls)
+	}
+	ft.labelCallers()
+}
+
+// entryCaller stands for the contract's entry among a subroutine's callers.
+const entryCaller = -1
+
+// callerLabel names the external function at index i.
+func (ft *FunctionTracker) callerLabel(i int) string {
+	switch {
+	case i != entryCaller:
+		return ft.Functions[i].Label()
+	case len(ft.Functions) > 0:
+		return "fallback"
+	}
+	return "entry"
+}
+
+// entryCalls returns the subroutines the contract's entry calls outside
+// any external function.
+func (ft *FunctionTracker) entryCalls() []int {
+	var out []int
+	for _, s := range ft.Subroutines {
+		if slices.Contains(s.callers, entryCaller) {
+			out = append(out, s.EntryPC)
+		}
+	}
+	return out
+}
+
+// labelCallers names each subroutine's callers and the external functions
+// that reach it.
+func (ft *FunctionTracker) labelCallers() {
+	for i := range ft.Subroutines {
+		s := &ft.Subroutines[i]
+		s.Callers, s.Functions = nil, nil
+		for _, fn := range s.callers {
+			s.Callers = append(s.Callers, ft.callerLabel(fn))
+		}
+		for _, entry := range s.callerSubs {
+			s.Callers = append(s.Callers, Subroutine{EntryPC: entry}.Label())
+		}
+		for _, fn := range s.functions {
+			s.Functions = append(s.Functions, ft.callerLabel(fn))
+		}
+	}
+}
+
+// Subroutine returns the internal function entered at pc, or nil.
+func (ft *FunctionTracker) Subroutine(pc int) *Subroutine {
+	for i := range ft.Subroutines {
+		if ft.Subroutines[i].EntryPC == pc {
+			return &ft.Subroutines[i]
+		}
+	}
+	return nil
+}
+
+// printCallTree prints the subroutines at entries and what they call,
+// indented by depth. A subroutine's callees are listed the first time it
+// appears only.
+func printCallTree(ft *FunctionTracker, entries []int, depth int, printed map[int]bool) {
+	for _, entry := range entries {
+		sub := ft.Subroutine(entry)
+		indent := strings.Repeat("  ", depth)
+		if printed[entry] {
+			if len(sub.Callees) > 0 {
+				fmt.Printf("%s-> %s (see above)\n", indent, sub.Label())
+			} else {
+				fmt.Printf("%s-> %s\n", indent, sub.Label())
+			}
+			continue
+		}
+		printed[entry] = true
+		fmt.Printf("%s-> %s (%d gas exclusive, %d inclusive)\n", indent, sub.Label(), sub.ExclusiveGas, sub.InclusiveGas)
+		printCallTree(ft, sub.Callees, depth+1, printed)
+	}
+}
+
+func appendUnique(s []int, v int) []int {
+	if slices.Contains(s, v) {
+		return s
+	}
+	return append(s, v)
+}
@@ -0,0 +1,82 @@
+package analyzer
+
+import (
+	"slices"
+	"testing"
+
+	"gaslens/disasm"
+)
+
+// sharedHelper has two external functions calling the helper at 19, which
+// calls the one at 27.
+//
+//	0: CALLVALUE  1: PUSH1 11  3: JUMPI
+//	4: PUSH1 9  6: PUSH1 19  8: JUMP  9: JUMPDEST  10: STOP
+//	11: JUMPDEST  12: PUSH1 17  14: PUSH1 19  16: JUMP  17: JUMPDEST  18: STOP
+//	19: JUMPDEST  20: PUSH1 25  22: PUSH1 27  24: JUMP  25: JUMPDEST  26: JUMP
+//	27: JUMPDEST  28: JUMP
+var sharedHelper = []byte{
+	0x34, 0x60, 0x0b, 0x57,
+	0x60, 0x09, 0x60, 0x13, 0x56, 0x5b, 0x00,
+	0x5b, 0x60, 0x11, 0x60, 0x13, 0x56, 0x5b, 0x00,
+	0x5b, 0x60, 0x19, 0x60, 0x1b, 0x56, 0x5b, 0x56,
+	0x5b, 0x56,
+}
+
+func TestFindSubroutines(t *testing.T) {
+	tests := []struct {
+		entry     int
+		callSites []int
+		callers   []string
+		callees   []int
+		exclusive uint64
+		inclusive uint64
+	}{
+		{
+			entry:     19,
+			callSites: []int{8, 16},
+			callers:   []string{"0xaaaaaaaa", "0xbbbbbbbb"},
+			callees:   []int{27},
+			exclusive: 5 + 7,
+			inclusive: 5 + 7 + 100,
+		},
+		{
+			entry:     27,
+			callSites: []int{24},
+			callers:   []string{"internal@19"},
+			exclusive: 100,
+			inclusive: 100,
+		},
+	}
+
+	ft := NewFunctionTracker()
+	ft.Functions = []FunctionInfo{{Selector: "0xaaaaaaaa", EntryPC: 4}, {Selector: "0xbbbbbbbb", EntryPC: 11}}
+	// Each caller's blocks cost 1000, so that charging them to a helper shows.
+	gasByPC := map[int]uint64{4: 1000, 9: 1000, 11: 1000, 17: 1000, 19: 5, 25: 7, 27: 100}
+	ft.FindSubroutines(BuildCFG(disasm.Disassemble(sharedHelper)), gasByPC)
+
+	if len(ft.Subroutines) != len(tests) {
+		t.Fatalf("subroutines = %+v, want entries 19 and 27", ft.Subroutines)
+	}
+	for i, tt := range tests {
+		s := ft.Subroutines[i]
+		if s.EntryPC != tt.entry {
+			t.Fatalf("subroutine %d enters at %d, want %d", i, s.EntryPC, tt.entry)
+		}
+		if !slices.Equal(s.CallSites, tt.callSites) || !slices.Equal(s.Callers, tt.callers) || !slices.Equal(s.Callees, tt.callees) {
+			t.Errorf("%s: call sites %v, callers %v, callees %v; want %v, %v, %v",
+				s.Label(), s.CallSites, s.Callers, s.Callees, tt.callSites, tt.callers, tt.callees)
+		}
+		if want := []string{"0xaaaaaaaa", "0xbbbbbbbb"}; !slices.Equal(s.Functions, want) || !s.Shared() {
+			t.Errorf("%s: reached from %v, shared %v; want %v, shared", s.Label(), s.Functions, s.Shared(), want)
+		}
+		if s.ExclusiveGas != tt.exclusive || s.InclusiveGas != tt.inclusive {
+			t.Errorf("%s: %d gas exclusive, %d inclusive; want %d, %d", s.Label(), s.ExclusiveGas, s.InclusiveGas, tt.exclusive, tt.inclusive)
+		}
+	}
+	for i, fn := range ft.Functions {
+		if !slices.Equal(fn.Calls, []int{19}) {
+			t.Errorf("function %d calls %v, want [19]", i, fn.Calls)
+		}
+	}
+}
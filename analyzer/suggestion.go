@@ -0,0 +1,29 @@
+package analyzer
+
+// NoPC marks a suggestion about no instruction in particular.
+const NoPC = -1
+
+// Suggestion is an optimization suggestion. PC is the instruction it is
+// about, which ties it to the source when a source map is loaded, or NoPC.
+type Suggestion struct {
+	Text string
+	PC   int
+}
+
+// general wraps texts about no instruction in particular.
+func general(texts ...string) []Suggestion {
+	out := make([]Suggestion, len(texts))
+	for i, t := range texts {
+		out[i] = Suggestion{Text: t, PC: NoPC}
+	}
+	return out
+}
+
+// setSuggestions regenerates the suggestions and the report's text of them.
+func (a *analysis) setSuggestions() {
+	a.optimizations = a.suggestions()
+	a.report.Optimizations = nil
+	for _, s := range a.optimizations {
+		a.report.Optimizations = append(a.report.Optimizations, s.Text)
+	}
+}
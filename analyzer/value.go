@@ -0,0 +1,381 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// maxSymbolLength bounds symbolic expressions; anything longer is unknown.
+const maxSymbolLength = 160
+
+type valueKind uint8
+
+const (
+	unknownValue valueKind = iota
+	concreteValue
+	symbolicValue
+)
+
+// Value is an abstract 256-bit stack word: a concrete constant, a symbol
+// standing for something derived from inputs the analyzer cannot see
+// (calldata, the caller, storage), or unknown. Two symbols are equal only
+// when they are the same expression, and an expression only names the same
+// value twice if it reads nothing that can change during a call; reads of
+// storage, memory or call results carry the pc that made them.
+type Value struct {
+	kind valueKind
+	word uint256.Int
+	expr string
+	loc  storageLocation // set on slots derived from a storage variable
+	src  slotSource      // set on words read from a fixed slot
+	node *valueNode      // how a symbolic value was computed, when known
+}
+
+// valueNode records the instruction a symbolic value is the result of and
+// its operands, the top of the stack first, so that analyses can match on
+// the structure of a value rather than parse its expression.
+type valueNode struct {
+	op   vm.OpCode
+	args []Value
+}
+
+// slotSource records that a value is the word read from a fixed storage
+// slot, shifted right by shift bits, so that masking it reveals the width
+// of a packed field.
+type slotSource struct {
+	slot  string
+	shift uint64
+}
+
+// Unknown returns the value nothing is known about.
+func Unknown() Value {
+	return Value{}
+}
+
+// Const returns the concrete value w.
+func Const(w *uint256.Int) Value {
+	return Value{kind: concreteValue, word: *w}
+}
+
+// ConstUint64 returns the concrete value v.
+func ConstUint64(v uint64) Value {
+	return Value{kind: concreteValue, word: *uint256.NewInt(v)}
+}
+
+// Symbol returns a symbolic value named by expr.
+func Symbol(expr string) Value {
+	if len(expr) > maxSymbolLength {
+		return Value{}
+	}
+	return Value{kind: symbolicValue, expr: expr}
+}
+
+func (v Value) IsConcrete() bool { return v.kind == concreteValue }
+func (v Value) IsSymbolic() bool { return v.kind == symbolicValue }
+func (v Value) IsUnknown() bool  { return v.kind == unknownValue }
+
+// Op returns the instruction a symbolic value was computed by and its
+// operands, the top of the stack first.
+func (v Value) Op() (vm.OpCode, []Value, bool) {
+	if v.node == nil {
+		return 0, nil, false
+	}
+	return v.node.op, v.node.args, true
+}
+
+// withOp records that v is op applied to args.
+func (v Value) withOp(op vm.OpCode, args ...Value) Value {
+	if v.kind == symbolicValue {
+		v.node = &valueNode{op: op, args: args}
+	}
+	return v
+}
+
+// mentions reports whether match holds for v or anything it was computed
+// from.
+func (v Value) mentions(match func(Value) bool) bool {
+	if match(v) {
+		return true
+	}
+	if v.node != nil {
+		for _, a := range v.node.args {
+			if a.mentions(match) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Word returns a copy of a concrete value's word, or nil.
+func (v Value) Word() *uint256.Int {
+	if v.kind != concreteValue {
+		return nil
+	}
+	w := v.word
+	return &w
+}
+
+// Uint64 returns a concrete value that fits in 64 bits.
+func (v Value) Uint64() (uint64, bool) {
+	if v.kind != concreteValue || !v.word.IsUint64() {
+		return 0, false
+	}
+	return v.word.Uint64(), true
+}
+
+// Equal reports whether v and o are provably the same word.
+func (v Value) Equal(o Value) bool {
+	switch {
+	case v.kind != o.kind:
+		return false
+	case v.kind == concreteValue:
+		return v.word.Eq(&o.word)
+	case v.kind == symbolicValue:
+		return v.expr == o.expr
+	}
+	return false
+}
+
+// IsZero reports whether v is provably zero.
+func (v Value) IsZero() bool {
+	return v.kind == concreteValue && v.word.IsZero()
+}
+
+// String renders concrete values that fit in 64 bits in decimal and larger
+// ones in hex, so small storage slots read as "0", "1", ...
+func (v Value) String() string {
+	switch v.kind {
+	case concreteValue:
+		if v.word.IsUint64() {
+			return v.word.Dec()
+		}
+		return v.word.Hex()
+	case symbolicValue:
+		return v.expr
+	}
+	return UnresolvedSlot
+}
+
+// stableInputs are the opcodes whose result cannot change during a call,
+// so their symbols compare equal wherever they are read.
+var stableInputs = map[vm.OpCode]bool{
+	vm.ADDRESS: true, vm.ORIGIN: true, vm.CALLER: true, vm.CALLVALUE: true,
+	vm.CALLDATALOAD: true, vm.CALLDATASIZE: true, vm.CODESIZE: true,
+	vm.GASPRICE: true, vm.COINBASE: true, vm.TIMESTAMP: true, vm.NUMBER: true,
+	vm.PREVRANDAO: true, vm.GASLIMIT: true, vm.CHAINID: true, vm.BASEFEE: true,
+	vm.BLOBBASEFEE: true, vm.BLOCKHASH: true, vm.BLOBHASH: true,
+}
+
+// evalOp computes the value op pushes from its operands, args[0] being the
+// top of the stack. Arithmetic folds concrete operands exactly and builds an
+// expression over symbolic ones; inputs become symbols.
+func evalOp(op vm.OpCode, args []Value, pc int) Value {
+	v := evalOpValue(op, args, pc)
+	switch {
+	case op == vm.SLOAD && args[0].IsConcrete() && v.IsSymbolic():
+		v.src = slotSource{slot: args[0].String()}
+	case op == vm.SHR && args[1].src.slot != "" && v.IsSymbolic():
+		if n, ok := args[0].Uint64(); ok && n < 256 {
+			v.src = slotSource{slot: args[1].src.slot, shift: args[1].src.shift + n}
+		}
+	}
+	return v
+}
+
+func evalOpValue(op vm.OpCode, args []Value, pc int) Value {
+	if op == vm.PC {
+		return ConstUint64(uint64(pc))
+	}
+	switch len(args) {
+	case 1:
+		if v, ok := evalUnary(op, args[0]); ok {
+			return v
+		}
+	case 2:
+		if op == vm.ADD {
+			if v, ok := offsetSlot(args[0], args[1], pc); ok {
+				return v
+			}
+		}
+		if v, ok := evalBinaryValue(op, args[0], args[1]); ok {
+			return v
+		}
+	case 3:
+		if op == vm.ADDMOD || op == vm.MULMOD {
+			return evalModular(op, args)
+		}
+	}
+	if stableInputs[op] {
+		return symbolOf(op, args, "")
+	}
+	if len(args) > 2 {
+		// Calls and creates: the pc alone identifies the result.
+		args = nil
+	}
+	return symbolOf(op, args, fmt.Sprintf("@%d", pc))
+}
+
+// symbolOf names the result of op applied to args. suffix distinguishes
+// reads whose result may change during the call.
+func symbolOf(op vm.OpCode, args []Value, suffix string) Value {
+	name := strings.ToLower(op.String())
+	if len(args) == 0 {
+		return Symbol(name + suffix).withOp(op)
+	}
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = a.String()
+	}
+	return Symbol(name+"("+strings.Join(parts, ",")+")"+suffix).withOp(op, args...)
+}
+
+// pure reports whether every operand is concrete or symbolic, so the result
+// can be named by an expression.
+func pure(args ...Value) bool {
+	for _, a := range args {
+		if a.kind == unknownValue {
+			return false
+		}
+	}
+	return true
+}
+
+func evalUnary(op vm.OpCode, a Value) (Value, bool) {
+	switch op {
+	case vm.ISZERO, vm.NOT, vm.CLZ:
+	default:
+		return Value{}, false
+	}
+	if a.kind == concreteValue {
+		z := new(uint256.Int)
+		switch op {
+		case vm.ISZERO:
+			if a.word.IsZero() {
+				z.SetOne()
+			}
+		case vm.NOT:
+			z.Not(&a.word)
+		case vm.CLZ:
+			z.SetUint64(uint64(256 - a.word.BitLen()))
+		}
+		return Const(z), true
+	}
+	if !pure(a) {
+		return Value{}, true
+	}
+	return symbolOf(op, []Value{a}, ""), true
+}
+
+var allOnes = new(uint256.Int).SetAllOne()
+
+// evalBinaryValue applies a two-operand arithmetic, comparison or bitwise
+// instruction; a is the top of the stack.
+func evalBinaryValue(op vm.OpCode, a, b Value) (Value, bool) {
+	if a.kind == concreteValue && b.kind == concreteValue {
+		v, ok := evalBinary(op, &a.word, &b.word)
+		if !ok {
+			return Value{}, false
+		}
+		return Const(v), true
+	}
+	zero := ConstUint64(0)
+	switch op {
+	case vm.ADD, vm.OR, vm.XOR:
+		switch {
+		case a.IsZero():
+			return b, true
+		case b.IsZero():
+			return a, true
+		}
+	case vm.SUB:
+		if b.IsZero() {
+			return a, true
+		}
+		if a.Equal(b) {
+			return zero, true
+		}
+	case vm.MUL, vm.AND:
+		switch {
+		case a.IsZero(), b.IsZero():
+			return zero, true
+		case op == vm.MUL && a.kind == concreteValue && a.word.IsUint64() && a.word.Uint64() == 1:
+			return b, true
+		case op == vm.MUL && b.kind == concreteValue && b.word.IsUint64() && b.word.Uint64() == 1:
+			return a, true
+		case op == vm.AND && a.kind == concreteValue && a.word.Eq(allOnes):
+			return b, true
+		case op == vm.AND && b.kind == concreteValue && b.word.Eq(allOnes):
+			return a, true
+		case op == vm.AND:
+			if v, ok := maskValue(a, b); ok {
+				return v, true
+			}
+		}
+	case vm.SHL, vm.SHR:
+		// The shift amount is on top.
+		if a.IsZero() {
+			return b, true
+		}
+		if a.kind == concreteValue && !a.word.LtUint64(256) {
+			return zero, true
+		}
+	case vm.DIV, vm.SDIV, vm.MOD, vm.SMOD, vm.EXP, vm.SIGNEXTEND, vm.SAR, vm.BYTE:
+	case vm.LT, vm.GT, vm.SLT, vm.SGT, vm.EQ:
+		if a.Equal(b) {
+			if op == vm.EQ {
+				return ConstUint64(1), true
+			}
+			return zero, true
+		}
+	default:
+		return Value{}, false
+	}
+	if !pure(a, b) {
+		return Value{}, true
+	}
+	return symbolOf(op, []Value{a, b}, ""), true
+}
+
+// addressInputs are the inputs that are always 160-bit addresses.
+var addressInputs = map[string]bool{"address": true, "origin": true, "caller": true, "coinbase": true}
+
+// maskValue names x masked to its low bits by a constant 2^k-1 as
+// uint<k>(x), the way Solidity truncates to a smaller type. Masking an
+// address input to 160 bits or more leaves it unchanged.
+func maskValue(a, b Value) (Value, bool) {
+	mask, x := a, b
+	if !mask.IsConcrete() {
+		mask, x = b, a
+	}
+	if !mask.IsConcrete() || !x.IsSymbolic() {
+		return Value{}, false
+	}
+	bits := mask.word.BitLen()
+	all := new(uint256.Int).Lsh(uint256.NewInt(1), uint(bits))
+	all.SubUint64(all, 1)
+	if bits%8 != 0 || !mask.word.Eq(all) {
+		return Value{}, false
+	}
+	if bits >= 160 && addressInputs[x.expr] {
+		return x, true
+	}
+	return Symbol(fmt.Sprintf("uint%d(%s)", bits, x)).withOp(vm.AND, x, mask), true
+}
+
+func evalModular(op vm.OpCode, args []Value) Value {
+	if args[0].kind == concreteValue && args[1].kind == concreteValue && args[2].kind == concreteValue {
+		z := new(uint256.Int)
+		if op == vm.ADDMOD {
+			return Const(z.AddMod(&args[0].word, &args[1].word, &args[2].word))
+		}
+		return Const(z.MulMod(&args[0].word, &args[1].word, &args[2].word))
+	}
+	if !pure(args...) {
+		return Value{}
+	}
+	return symbolOf(op, args, "")
+}
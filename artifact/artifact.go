@@ -0,0 +1,253 @@
+// Package artifact reads compiled contracts from Foundry and Hardhat build
+// artifacts, solc's standard JSON output and solc --combined-json, with the
+// bytecode, ABI, source map and storage layout each one carries.
+package artifact
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gaslens/layout"
+	"gaslens/srcmap"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// Contract is one compiled contract. Bytecode is the creation code and
+// DeployedBytecode the runtime code; either is empty for interfaces and
+// abstract contracts, and both are when Unlinked is set, as the code calls
+// libraries whose addresses are not filled in yet.
+type Contract struct {
+	Name             string
+	File             string // source file the contract is declared in
+	Path             string // artifact it was read from
+	Bytecode         []byte
+	DeployedBytecode []byte
+	Unlinked         bool
+	ABI              *abi.ABI
+	SourceMap        *srcmap.Map
+	Layout           *layout.Layout
+}
+
+// Code returns the creation code when known, since it also prices the
+// deployment, and the runtime code otherwise.
+func (c *Contract) Code() []byte {
+	if len(c.Bytecode) > 0 {
+		return c.Bytecode
+	}
+	return c.DeployedBytecode
+}
+
+// Qualified names the contract with its source file, e.g.
+// "src/Vault.sol:Vault".
+func (c *Contract) Qualified() string {
+	if c.File == "" {
+		return c.Name
+	}
+	return c.File + ":" + c.Name
+}
+
+// IsArtifact reports whether path is a directory or JSON file that Load
+// should read rather than a file of hex bytecode.
+func IsArtifact(path string) bool {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return true
+	}
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// Load reads every contract in path, which may be an artifact or output
+// file, or a directory such as Foundry's out/ or Hardhat's artifacts/ that
+// is searched for them. Contracts are ordered by name; those sharing a
+// name are told apart by Qualified.
+func Load(path string) ([]*Contract, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		contracts, err := loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(contracts) == 0 {
+			return nil, fmt.Errorf("%s: no contracts found", path)
+		}
+		sortContracts(contracts)
+		return contracts, nil
+	}
+
+	var contracts []*Contract
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Build-info files repeat every contract of the artifacts
+			// next to them, and are read through those instead.
+			if d.Name() == "build-info" || d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(p) != ".json" || strings.HasSuffix(p, ".dbg.json") {
+			return nil
+		}
+		found, err := loadFile(p)
+		if errors.Is(err, errUnknownFormat) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		contracts = append(contracts, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(contracts) == 0 {
+		return nil, fmt.Errorf("%s: no contract artifacts found", path)
+	}
+	sortContracts(contracts)
+	return contracts, nil
+}
+
+var errUnknownFormat = errors.New("not a contract artifact or solc output")
+
+// loadFile reads the contracts in a single file, recognising its format by
+// its top-level keys.
+func loadFile(path string) ([]*Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, errUnknownFormat)
+	}
+	var contracts []*Contract
+	switch {
+	case keys["version"] != nil && keys["contracts"] != nil:
+		contracts, err = parseCombined(data)
+	case keys["output"] != nil:
+		contracts, err = parseBuildInfo(data)
+	case keys["contracts"] != nil:
+		contracts, err = parseStandard(data)
+	case keys["deployedBytecode"] != nil || keys["bytecode"] != nil:
+		var c *Contract
+		c, err = parseArtifact(path, data)
+		contracts = []*Contract{c}
+	default:
+		return nil, fmt.Errorf("%s: %w", path, errUnknownFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// A missing source map is not an error: artifacts often have none.
+	maps, _ := srcmap.Decode(data, filepath.Dir(path))
+	for _, c := range contracts {
+		c.Path = path
+		if maps == nil || len(c.DeployedBytecode) == 0 {
+			continue
+		}
+		if m, err := maps.Map(c.DeployedBytecode, nil); err == nil {
+			c.SourceMap = m
+		}
+	}
+	return contracts, nil
+}
+
+func sortContracts(contracts []*Contract) {
+	sort.SliceStable(contracts, func(i, j int) bool {
+		if contracts[i].Name != contracts[j].Name {
+			return contracts[i].Name < contracts[j].Name
+		}
+		return contracts[i].File < contracts[j].File
+	})
+}
+
+// Find returns the contract called name, which may be qualified with its
+// source file as in "src/Vault.sol:Vault".
+func Find(contracts []*Contract, name string) (*Contract, error) {
+	var found []*Contract
+	for _, c := range contracts {
+		if c.Name == name || c.Qualified() == name {
+			found = append(found, c)
+		}
+	}
+	switch len(found) {
+	case 1:
+		return found[0], nil
+	case 0:
+		return nil, fmt.Errorf("no contract named %s (found %s)", name, Names(contracts))
+	}
+	return nil, fmt.Errorf("%s is ambiguous (found %s)", name, Names(found))
+}
+
+// Names lists the contracts by qualified name.
+func Names(contracts []*Contract) string {
+	names := make([]string, len(contracts))
+	for i, c := range contracts {
+		names[i] = c.Qualified()
+	}
+	return strings.Join(names, ", ")
+}
+
+// decodeCode decodes a hex bytecode object. It reports unlinked for code
+// that still holds library placeholders such as __$53aea8...$__.
+func decodeCode(object string) (code []byte, unlinked bool, err error) {
+	object = strings.TrimPrefix(strings.TrimSpace(object), "0x")
+	if strings.Contains(object, "__") {
+		return nil, true, nil
+	}
+	code, err = hex.DecodeString(object)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid bytecode: %w", err)
+	}
+	return code, false, nil
+}
+
+// parseABI decodes an ABI given as JSON, or as a string holding the JSON
+// as older solc versions write it. It returns nil when there is none.
+func parseABI(raw json.RawMessage) (*abi.ABI, error) {
+	raw = unquote(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	parsed, err := abi.JSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ABI: %w", err)
+	}
+	return &parsed, nil
+}
+
+// parseLayout decodes a storage layout, or an object with a storageLayout
+// field, and returns nil when there is none.
+func parseLayout(raw json.RawMessage) *layout.Layout {
+	raw = unquote(raw)
+	if len(raw) == 0 {
+		return nil
+	}
+	l, err := layout.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	return l
+}
+
+// unquote returns the JSON inside raw when raw is a string.
+func unquote(raw json.RawMessage) json.RawMessage {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return json.RawMessage(s)
+	}
+	return raw
+}
@@ -0,0 +1,171 @@
+package artifact
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	creation   = "0x6005600c60003960056000f3"
+	runtime    = "0x6001600055"
+	abiJSON    = `[{"type":"function","name":"f","inputs":[],"outputs":[],"stateMutability":"nonpayable"}]`
+	layoutJSON = `{"storage":[{"label":"x","offset":0,"slot":"0","type":"t_uint256"}],` +
+		`"types":{"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"}}}`
+	srcmapJSON = `"0:8:0:-:0;;"`
+	source     = "contract A {}\n"
+
+	standardOutputJSON = `{"contracts":{"A.sol":{"A":{"abi":` + abiJSON + `,"evm":{` +
+		`"bytecode":{"object":"` + creation + `"},` +
+		`"deployedBytecode":{"object":"` + runtime + `","sourceMap":` + srcmapJSON + `}},` +
+		`"storageLayout":` + layoutJSON + `}}},"sources":{"A.sol":{"id":0}}}`
+)
+
+// writeFiles writes files, keyed by path relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		load      string
+		layout    bool
+		sourceMap bool
+	}{
+		{
+			name: "foundry",
+			files: map[string]string{
+				"A.sol": source,
+				"out/A.sol/A.json": `{"abi":` + abiJSON + `,` +
+					`"bytecode":{"object":"` + creation + `"},` +
+					`"deployedBytecode":{"object":"` + runtime + `","sourceMap":` + srcmapJSON + `},` +
+					`"storageLayout":` + layoutJSON + `,` +
+					`"metadata":{"settings":{"compilationTarget":{"A.sol":"A"}}},"id":0}`,
+			},
+			load:      "out/A.sol/A.json",
+			layout:    true,
+			sourceMap: true,
+		},
+		{
+			name: "hardhat, with layout and source map from build-info",
+			files: map[string]string{
+				"artifacts/contracts/A.sol/A.json": `{"contractName":"A","sourceName":"A.sol","abi":` + abiJSON + `,` +
+					`"bytecode":"` + creation + `","deployedBytecode":"` + runtime + `"}`,
+				"artifacts/contracts/A.sol/A.dbg.json": `{"buildInfo":"../../build-info/1.json"}`,
+				"artifacts/build-info/1.json":          `{"input":{"sources":{"A.sol":{"content":"contract A {}\n"}}},"output":` + standardOutputJSON + `}`,
+			},
+			load:      "artifacts/contracts/A.sol/A.json",
+			layout:    true,
+			sourceMap: true,
+		},
+		{
+			name: "solc standard JSON",
+			files: map[string]string{
+				"A.sol":    source,
+				"out.json": standardOutputJSON,
+			},
+			load:      "out.json",
+			layout:    true,
+			sourceMap: true,
+		},
+		{
+			name: "build-info",
+			files: map[string]string{
+				"bi.json": `{"input":{"sources":{"A.sol":{"content":"contract A {}\n"}}},"output":` + standardOutputJSON + `}`,
+			},
+			load:      "bi.json",
+			layout:    true,
+			sourceMap: true,
+		},
+		{
+			name: "solc combined JSON",
+			files: map[string]string{
+				"A.sol": source,
+				"combined.json": `{"version":"0.8.28","sourceList":["A.sol"],"contracts":{"A.sol:A":{"abi":` + abiJSON + `,` +
+					`"bin":"` + creation[2:] + `","bin-runtime":"` + runtime[2:] + `","srcmap-runtime":` + srcmapJSON + `}}}`,
+			},
+			load:      "combined.json",
+			sourceMap: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			contracts, err := Load(filepath.Join(dir, tt.load))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(contracts) != 1 {
+				t.Fatalf("loaded %s, want A.sol:A alone", Names(contracts))
+			}
+			c := contracts[0]
+			if c.Qualified() != "A.sol:A" {
+				t.Errorf("contract = %s, want A.sol:A", c.Qualified())
+			}
+			if got := "0x" + hex.EncodeToString(c.Bytecode); got != creation {
+				t.Errorf("creation code = %s, want %s", got, creation)
+			}
+			if got := "0x" + hex.EncodeToString(c.DeployedBytecode); got != runtime {
+				t.Errorf("runtime code = %s, want %s", got, runtime)
+			}
+			if c.ABI == nil || len(c.ABI.Methods) != 1 {
+				t.Errorf("ABI = %+v, want the method f", c.ABI)
+			}
+			if (c.Layout != nil) != tt.layout {
+				t.Errorf("layout = %+v, want one: %v", c.Layout, tt.layout)
+			}
+			if !tt.sourceMap {
+				return
+			}
+			if pos, ok := c.SourceMap.Position(0); !ok || pos.String() != "A.sol:1:1" {
+				t.Errorf("source of the first instruction = %s, %v; want A.sol:1:1", pos, ok)
+			}
+		})
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"out/A.sol/A.json": `{"abi":[],"bytecode":{"object":"` + creation + `"},"deployedBytecode":{"object":"` + runtime + `"},` +
+			`"metadata":{"settings":{"compilationTarget":{"A.sol":"A"}}}}`,
+		"out/I.sol/I.json":      `{"abi":[],"bytecode":{"object":"0x"},"deployedBytecode":{"object":"0x"},"metadata":"{\"settings\":{\"compilationTarget\":{\"I.sol\":\"I\"}}}"}`,
+		"out/L.sol/Uses.json":   `{"abi":[],"bytecode":{"object":"0x73__$53aea8$__"},"deployedBytecode":{"object":"0x73__$53aea8$__"}}`,
+		"out/build-info/1.json": `{"output":` + standardOutputJSON + `}`,
+		"out/notes.json":        `{"comment":"not an artifact"}`,
+		"out/A.sol/A.dbg.json":  `{"buildInfo":"missing.json"}`,
+		"out/README.md":         "not json",
+	})
+	contracts, err := Load(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Names(contracts); got != "A.sol:A, I.sol:I, Uses" {
+		t.Fatalf("loaded %s, want A.sol:A, I.sol:I, Uses", got)
+	}
+	if c := contracts[1]; len(c.Code()) != 0 || c.Unlinked {
+		t.Errorf("interface I has code %x, unlinked %v; want neither", c.Code(), c.Unlinked)
+	}
+	if c := contracts[2]; !c.Unlinked || len(c.Code()) != 0 {
+		t.Errorf("Uses has code %x, unlinked %v; want it unlinked without code", c.Code(), c.Unlinked)
+	}
+	if c, err := Find(contracts, "A"); err != nil || c != contracts[0] {
+		t.Errorf("Find(A) = %v, %v", c, err)
+	}
+	if _, err := Find(contracts, "B"); err == nil {
+		t.Error("Find(B) succeeded, want an error")
+	}
+}
@@ -0,0 +1,217 @@
+package artifact
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gaslens/layout"
+)
+
+// bytecode is a bytecode object as Foundry artifacts and solc's standard
+// JSON output give it. Hardhat artifacts give the hex string alone.
+type bytecode struct {
+	Object string `json:"object"`
+}
+
+func (b *bytecode) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &b.Object); err == nil {
+		return nil
+	}
+	type plain bytecode
+	return json.Unmarshal(data, (*plain)(b))
+}
+
+// standardContract is a contract in solc's standard JSON output.
+type standardContract struct {
+	ABI json.RawMessage `json:"abi"`
+	EVM struct {
+		Bytecode         bytecode `json:"bytecode"`
+		DeployedBytecode bytecode `json:"deployedBytecode"`
+	} `json:"evm"`
+	StorageLayout json.RawMessage `json:"storageLayout"`
+}
+
+// standardOutput is solc's standard JSON output, keyed by source file and
+// contract name.
+type standardOutput struct {
+	Contracts map[string]map[string]standardContract `json:"contracts"`
+}
+
+// parseStandard reads the contracts in solc's standard JSON output.
+func parseStandard(data []byte) ([]*Contract, error) {
+	var out standardOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out.contracts()
+}
+
+// parseBuildInfo reads the contracts in a Hardhat or Foundry build-info
+// file, which wraps solc's standard JSON output.
+func parseBuildInfo(data []byte) ([]*Contract, error) {
+	var bi struct {
+		Output standardOutput `json:"output"`
+	}
+	if err := json.Unmarshal(data, &bi); err != nil {
+		return nil, err
+	}
+	return bi.Output.contracts()
+}
+
+func (out *standardOutput) contracts() ([]*Contract, error) {
+	var contracts []*Contract
+	for file, byName := range out.Contracts {
+		for name, sc := range byName {
+			c := &Contract{Name: name, File: file}
+			if err := c.setCode(sc.EVM.Bytecode.Object, sc.EVM.DeployedBytecode.Object); err != nil {
+				return nil, fmt.Errorf("%s:%s: %w", file, name, err)
+			}
+			abi, err := parseABI(sc.ABI)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%s: %w", file, name, err)
+			}
+			c.ABI = abi
+			c.Layout = parseLayout(sc.StorageLayout)
+			contracts = append(contracts, c)
+		}
+	}
+	return contracts, nil
+}
+
+// parseCombined reads the output of solc --combined-json, whose contracts
+// are keyed "file:Name".
+func parseCombined(data []byte) ([]*Contract, error) {
+	var out struct {
+		Contracts map[string]struct {
+			ABI           json.RawMessage `json:"abi"`
+			Bin           string          `json:"bin"`
+			BinRuntime    string          `json:"bin-runtime"`
+			StorageLayout json.RawMessage `json:"storage-layout"`
+		} `json:"contracts"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	var contracts []*Contract
+	for key, cc := range out.Contracts {
+		c := &Contract{Name: key}
+		if i := strings.LastIndex(key, ":"); i >= 0 {
+			c.File, c.Name = key[:i], key[i+1:]
+		}
+		if err := c.setCode(cc.Bin, cc.BinRuntime); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		abi, err := parseABI(cc.ABI)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		c.ABI = abi
+		c.Layout = parseLayout(cc.StorageLayout)
+		contracts = append(contracts, c)
+	}
+	return contracts, nil
+}
+
+// parseArtifact reads a Foundry or Hardhat artifact. Hardhat names the
+// contract and its file; Foundry's metadata gives them as the compilation
+// target, and the artifact's file name is the last resort.
+func parseArtifact(path string, data []byte) (*Contract, error) {
+	var a struct {
+		ContractName     string          `json:"contractName"`
+		SourceName       string          `json:"sourceName"`
+		ABI              json.RawMessage `json:"abi"`
+		Bytecode         bytecode        `json:"bytecode"`
+		DeployedBytecode bytecode        `json:"deployedBytecode"`
+		StorageLayout    json.RawMessage `json:"storageLayout"`
+		Metadata         json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	c := &Contract{Name: a.ContractName, File: a.SourceName}
+	if c.Name == "" {
+		c.File, c.Name = compilationTarget(a.Metadata)
+	}
+	if c.Name == "" {
+		c.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := c.setCode(a.Bytecode.Object, a.DeployedBytecode.Object); err != nil {
+		return nil, err
+	}
+	abi, err := parseABI(a.ABI)
+	if err != nil {
+		return nil, err
+	}
+	c.ABI = abi
+	c.Layout = parseLayout(a.StorageLayout)
+	if c.Layout == nil {
+		c.Layout = hardhatLayout(path, c)
+	}
+	return c, nil
+}
+
+// setCode decodes the creation and runtime code.
+func (c *Contract) setCode(creation, runtime string) error {
+	var unlinked [2]bool
+	var err error
+	if c.Bytecode, unlinked[0], err = decodeCode(creation); err != nil {
+		return err
+	}
+	if c.DeployedBytecode, unlinked[1], err = decodeCode(runtime); err != nil {
+		return err
+	}
+	c.Unlinked = unlinked[0] || unlinked[1]
+	if c.Unlinked {
+		c.Bytecode, c.DeployedBytecode = nil, nil
+	}
+	return nil
+}
+
+// compilationTarget returns the file and name of the contract a Foundry
+// artifact's metadata, an object or a JSON string, was compiled for.
+func compilationTarget(metadata json.RawMessage) (file, name string) {
+	var md struct {
+		Settings struct {
+			CompilationTarget map[string]string `json:"compilationTarget"`
+		} `json:"settings"`
+	}
+	if json.Unmarshal(unquote(metadata), &md) != nil {
+		return "", ""
+	}
+	for file, name := range md.Settings.CompilationTarget {
+		return file, name
+	}
+	return "", ""
+}
+
+// hardhatLayout looks up a Hardhat contract's storage layout in the
+// build-info file its .dbg.json points to, which has one when the project
+// asks solc for it.
+func hardhatLayout(path string, c *Contract) *layout.Layout {
+	dbgPath := strings.TrimSuffix(path, ".json") + ".dbg.json"
+	var dbg struct {
+		BuildInfo string `json:"buildInfo"`
+	}
+	data, err := os.ReadFile(dbgPath)
+	if err != nil || json.Unmarshal(data, &dbg) != nil || dbg.BuildInfo == "" {
+		return nil
+	}
+	data, err = os.ReadFile(filepath.Join(filepath.Dir(dbgPath), dbg.BuildInfo))
+	if err != nil {
+		return nil
+	}
+	var bi struct {
+		Output standardOutput `json:"output"`
+	}
+	if json.Unmarshal(data, &bi) != nil {
+		return nil
+	}
+	sc, ok := bi.Output.Contracts[c.File][c.Name]
+	if !ok {
+		return nil
+	}
+	return parseLayout(sc.StorageLayout)
+}
@@ -0,0 +1,55 @@
+package disasm
+
+import "github.com/ethereum/go-ethereum/core/vm"
+
+// BasicBlock is a straight-line run of instructions with a single entry and a
+// single exit.
+type BasicBlock struct {
+	Start        int // pc of the first instruction
+	End          int // pc one past the last instruction byte
+	Instructions []Instruction
+}
+
+// Last returns the final instruction of the block.
+func (b *BasicBlock) Last() Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// IsTerminator reports whether op ends a basic block.
+func IsTerminator(op vm.OpCode) bool {
+	switch op {
+	case vm.JUMP, vm.JUMPI, vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID, vm.SELFDESTRUCT:
+		return true
+	}
+	return false
+}
+
+// SplitBlocks groups instrs into basic blocks. A block starts at every
+// JUMPDEST and ends after every terminating instruction.
+func SplitBlocks(instrs []Instruction) []BasicBlock {
+	var blocks []BasicBlock
+	var cur []Instruction
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		last := cur[len(cur)-1]
+		blocks = append(blocks, BasicBlock{
+			Start:        cur[0].PC,
+			End:          last.PC + last.Size,
+			Instructions: cur,
+		})
+		cur = nil
+	}
+	for _, ins := range instrs {
+		if ins.Op == vm.JUMPDEST {
+			flush()
+		}
+		cur = append(cur, ins)
+		if IsTerminator(ins.Op) {
+			flush()
+		}
+	}
+	flush()
+	return blocks
+}
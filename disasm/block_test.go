@@ -0,0 +1,57 @@
+package disasm
+
+import "testing"
+
+func TestSplitBlocks(t *testing.T) {
+	type span struct{ start, end, count int }
+	tests := []struct {
+		name string
+		code []byte
+		want []span
+	}{
+		{
+			name: "straight line",
+			// PUSH1 1 PUSH1 2 ADD
+			code: []byte{0x60, 0x01, 0x60, 0x02, 0x01},
+			want: []span{{0, 5, 3}},
+		},
+		{
+			name: "jumpdest starts a block",
+			// PUSH1 0 JUMPDEST STOP
+			code: []byte{0x60, 0x00, 0x5b, 0x00},
+			want: []span{{0, 2, 1}, {2, 4, 2}},
+		},
+		{
+			name: "terminators end a block",
+			// PUSH1 6 JUMPI CALLER STOP JUMPDEST STOP
+			code: []byte{0x60, 0x06, 0x57, 0x33, 0x00, 0x5b, 0x00},
+			want: []span{{0, 3, 2}, {3, 5, 2}, {5, 7, 2}},
+		},
+		{
+			name: "jumpdest in push data is not a block start",
+			// PUSH1 0x5b STOP
+			code: []byte{0x60, 0x5b, 0x00},
+			want: []span{{0, 3, 2}},
+		},
+		{
+			name: "consecutive jumpdests",
+			// JUMPDEST JUMPDEST INVALID
+			code: []byte{0x5b, 0x5b, 0xfe},
+			want: []span{{0, 1, 1}, {1, 3, 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := SplitBlocks(Disassemble(tt.code))
+			if len(blocks) != len(tt.want) {
+				t.Fatalf("got %d blocks, want %d", len(blocks), len(tt.want))
+			}
+			for i, b := range blocks {
+				got := span{b.Start, b.End, len(b.Instructions)}
+				if got != tt.want[i] {
+					t.Errorf("block %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
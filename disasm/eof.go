@@ -0,0 +1,112 @@
+package disasm
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// DisassembleEOF walks one EOF code section. EOF gives immediates to more
+// opcodes than PUSH, and RJUMPV's length depends on its first byte.
+func DisassembleEOF(code []byte) []Instruction {
+	instrs := make([]Instruction, 0, len(code))
+	for pc := 0; pc < len(code); {
+		op := vm.OpCode(code[pc])
+		ins := Instruction{PC: pc, Op: op, Size: 1}
+		if n := EOFImmediateSize(code, pc); n > 0 {
+			end := min(pc+1+n, len(code))
+			ins.Immediate = code[pc+1 : end]
+			ins.Size += len(ins.Immediate)
+		}
+		instrs = append(instrs, ins)
+		pc += ins.Size
+	}
+	return instrs
+}
+
+// EOFImmediateSize returns the number of immediate bytes that follow the
+// opcode at code[pc] in an EOF code section.
+func EOFImmediateSize(code []byte, pc int) int {
+	switch op := vm.OpCode(code[pc]); op {
+	case vm.RJUMP, vm.RJUMPI, vm.CALLF, vm.JUMPF, vm.DATALOADN:
+		return 2
+	case vm.DUPN, vm.SWAPN, vm.EXCHANGE, vm.EOFCREATE, vm.RETURNCONTRACT:
+		return 1
+	case vm.RJUMPV:
+		if pc+1 >= len(code) {
+			return 1
+		}
+		return 1 + 2*(int(code[pc+1])+1)
+	default:
+		return ImmediateSize(op)
+	}
+}
+
+// RelativeTargets returns the pcs an RJUMP, RJUMPI or RJUMPV may jump to.
+// Offsets are relative to the end of the instruction.
+func (ins Instruction) RelativeTargets() []int {
+	var offsets []byte
+	switch ins.Op {
+	case vm.RJUMP, vm.RJUMPI:
+		offsets = ins.Immediate
+	case vm.RJUMPV:
+		if len(ins.Immediate) > 0 {
+			offsets = ins.Immediate[1:]
+		}
+	default:
+		return nil
+	}
+	var targets []int
+	for i := 0; i+2 <= len(offsets); i += 2 {
+		rel := int16(binary.BigEndian.Uint16(offsets[i:]))
+		targets = append(targets, ins.PC+ins.Size+int(rel))
+	}
+	return targets
+}
+
+// IsEOFTerminator reports whether op ends a basic block in EOF code, where
+// relative jumps, function returns and tail calls replace JUMP and JUMPI.
+func IsEOFTerminator(op vm.OpCode) bool {
+	switch op {
+	case vm.RJUMP, vm.RJUMPI, vm.RJUMPV, vm.RETF, vm.JUMPF, vm.RETURNCONTRACT,
+		vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID:
+		return true
+	}
+	return false
+}
+
+// SplitEOFBlocks groups the instructions of one EOF code section into basic
+// blocks. A block starts at every relative jump target.
+func SplitEOFBlocks(instrs []Instruction) []BasicBlock {
+	targets := map[int]bool{}
+	for _, ins := range instrs {
+		for _, t := range ins.RelativeTargets() {
+			targets[t] = true
+		}
+	}
+	var blocks []BasicBlock
+	var cur []Instruction
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		last := cur[len(cur)-1]
+		blocks = append(blocks, BasicBlock{
+			Start:        cur[0].PC,
+			End:          last.PC + last.Size,
+			Instructions: cur,
+		})
+		cur = nil
+	}
+	for _, ins := range instrs {
+		if targets[ins.PC] {
+			flush()
+		}
+		cur = append(cur, ins)
+		if IsEOFTerminator(ins.Op) {
+			flush()
+		}
+	}
+	flush()
+	return blocks
+}
@@ -0,0 +1,70 @@
+// Package disasm decodes raw EVM bytecode into typed instructions and groups
+// them into basic blocks.
+package disasm
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// Instruction is a single decoded opcode together with its immediate data.
+type Instruction struct {
+	PC        int
+	Op        vm.OpCode
+	Immediate []byte
+	Size      int
+}
+
+// Disassemble walks code and returns one Instruction per opcode. PUSH data is
+// attached to the PUSH as its immediate and never decoded as opcodes. A PUSH
+// cut short by the end of the code keeps whatever bytes are present.
+func Disassemble(code []byte) []Instruction {
+	instrs := make([]Instruction, 0, len(code))
+	for pc := 0; pc < len(code); {
+		op := vm.OpCode(code[pc])
+		ins := Instruction{PC: pc, Op: op, Size: 1}
+		if n := ImmediateSize(op); n > 0 {
+			end := pc + 1 + n
+			if end > len(code) {
+				end = len(code)
+			}
+			ins.Immediate = code[pc+1 : end]
+			ins.Size += len(ins.Immediate)
+		}
+		instrs = append(instrs, ins)
+		pc += ins.Size
+	}
+	return instrs
+}
+
+// ImmediateSize returns the number of immediate bytes that follow op.
+func ImmediateSize(op vm.OpCode) int {
+	if op >= vm.PUSH1 && op <= vm.PUSH32 {
+		return int(op-vm.PUSH1) + 1
+	}
+	return 0
+}
+
+// Truncated reports whether the instruction's immediate runs past the end of
+// the code.
+func (ins Instruction) Truncated() bool {
+	return len(ins.Immediate) < ImmediateSize(ins.Op)
+}
+
+// Value returns the immediate as a big-endian integer, keeping the low 64 bits.
+func (ins Instruction) Value() uint64 {
+	var v uint64
+	for _, b := range ins.Immediate {
+		v = (v << 8) | uint64(b)
+	}
+	return v
+}
+
+func (ins Instruction) String() string {
+	if len(ins.Immediate) == 0 {
+		return fmt.Sprintf("%04d: %s", ins.PC, ins.Op.String())
+	}
+	return fmt.Sprintf("%04d: %s 0x%s", ins.PC, ins.Op.String(), hex.EncodeToString(ins.Immediate))
+}
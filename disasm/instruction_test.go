@@ -0,0 +1,85 @@
+package disasm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		want []Instruction
+	}{
+		{
+			name: "empty",
+			code: nil,
+			want: nil,
+		},
+		{
+			name: "push data is not decoded as opcodes",
+			// PUSH2 0x5b00 JUMPDEST STOP
+			code: []byte{0x61, 0x5b, 0x00, 0x5b, 0x00},
+			want: []Instruction{
+				{PC: 0, Op: vm.PUSH2, Immediate: []byte{0x5b, 0x00}, Size: 3},
+				{PC: 3, Op: vm.JUMPDEST, Size: 1},
+				{PC: 4, Op: vm.STOP, Size: 1},
+			},
+		},
+		{
+			name: "push0 has no immediate",
+			code: []byte{0x5f, 0x60, 0x01, 0x01},
+			want: []Instruction{
+				{PC: 0, Op: vm.PUSH0, Size: 1},
+				{PC: 1, Op: vm.PUSH1, Immediate: []byte{0x01}, Size: 2},
+				{PC: 3, Op: vm.ADD, Size: 1},
+			},
+		},
+		{
+			name: "truncated push keeps the bytes present",
+			code: []byte{0x00, 0x63, 0xaa, 0xbb},
+			want: []Instruction{
+				{PC: 0, Op: vm.STOP, Size: 1},
+				{PC: 1, Op: vm.PUSH4, Immediate: []byte{0xaa, 0xbb}, Size: 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Disassemble(tt.code)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d instructions, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i, ins := range got {
+				w := tt.want[i]
+				if ins.PC != w.PC || ins.Op != w.Op || ins.Size != w.Size || !bytes.Equal(ins.Immediate, w.Immediate) {
+					t.Errorf("instruction %d = %v (size %d), want %v (size %d)", i, ins, ins.Size, w, w.Size)
+				}
+			}
+		})
+	}
+}
+
+func TestInstructionValue(t *testing.T) {
+	tests := []struct {
+		code      []byte
+		value     uint64
+		truncated bool
+	}{
+		{[]byte{0x60, 0x2a}, 42, false},
+		{[]byte{0x61, 0x01, 0x00}, 256, false},
+		{[]byte{0x62, 0x01}, 1, true},
+		{[]byte{0x5f}, 0, false},
+	}
+	for _, tt := range tests {
+		ins := Disassemble(tt.code)[0]
+		if got := ins.Value(); got != tt.value {
+			t.Errorf("%v: Value() = %d, want %d", ins, got, tt.value)
+		}
+		if got := ins.Truncated(); got != tt.truncated {
+			t.Errorf("%v: Truncated() = %v, want %v", ins, got, tt.truncated)
+		}
+	}
+}
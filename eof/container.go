@@ -0,0 +1,286 @@
+// Package eof parses and validates EVM Object Format containers
+// (EIP-3540, EIP-3670, EIP-4200, EIP-4750, EIP-5450, EIP-7480, EIP-7620).
+//
+// A container is the magic 0xEF00, a version byte, a header listing the
+// sizes of its sections, and then the sections themselves: one type entry
+// per code section, the code sections, optional nested containers used by
+// EOFCREATE and RETURNCONTRACT, and the data section.
+package eof
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	Version = 1
+
+	kindTypes      = 0x01
+	kindCode       = 0x02
+	kindContainer  = 0x03
+	kindData       = 0xff
+	headerTerminus = 0x00
+
+	maxCodeSections      = 1024
+	maxContainerSections = 256
+	maxStackHeight       = 1023
+	maxIO                = 0x7f
+
+	// NonReturning is the outputs value of a code section that never
+	// returns to its caller.
+	NonReturning = 0x80
+)
+
+// FunctionType is a code section's entry in the type section.
+type FunctionType struct {
+	Inputs         int
+	Outputs        int // NonReturning for sections that never return
+	MaxStackHeight int // inputs plus the declared maximum stack increase
+}
+
+// Container is a parsed and validated EOF container.
+type Container struct {
+	Version     int
+	Types       []FunctionType
+	Code        [][]byte
+	CodeOffsets []int // position of each code section in the container
+	Containers  []*Container
+	Data        []byte
+	DataSize    int // declared size; Data may be shorter in a subcontainer
+	Size        int
+}
+
+// ValidationError locates what makes a container invalid. Section is -1
+// for errors in the header or section layout, whose Offset is then a
+// position in the container rather than in a code section.
+type ValidationError struct {
+	Section int
+	Offset  int
+	Reason  string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Section < 0 {
+		return fmt.Sprintf("offset %d: %s", e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("code section %d, pc %d: %s", e.Section, e.Offset, e.Reason)
+}
+
+func layoutError(offset int, format string, args ...interface{}) error {
+	return &ValidationError{Section: -1, Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
+
+// IsEOF reports whether code starts with the EOF magic.
+func IsEOF(code []byte) bool {
+	return len(code) >= 2 && code[0] == 0xef && code[1] == 0x00
+}
+
+// Parse parses code as a top-level container and validates it and every
+// container nested in it.
+func Parse(code []byte) (*Container, error) {
+	return parse(code, true)
+}
+
+func parse(code []byte, topLevel bool) (*Container, error) {
+	c, err := parseLayout(code, topLevel)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseLayout reads the header and splits the body into sections.
+func parseLayout(code []byte, topLevel bool) (*Container, error) {
+	r := &reader{data: code}
+	if !IsEOF(code) {
+		return nil, layoutError(0, "missing EOF magic 0xef00")
+	}
+	r.pos = 2
+	version, ok := r.u8()
+	if !ok || version != Version {
+		return nil, layoutError(2, "unsupported EOF version %d", version)
+	}
+
+	if err := r.expectKind(kindTypes, "type"); err != nil {
+		return nil, err
+	}
+	typesSize, ok := r.u16()
+	if !ok {
+		return nil, layoutError(r.pos, "truncated header")
+	}
+
+	if err := r.expectKind(kindCode, "code"); err != nil {
+		return nil, err
+	}
+	codeSizes, err := r.sizes(maxCodeSections, "code", r.u16)
+	if err != nil {
+		return nil, err
+	}
+	if typesSize != 4*len(codeSizes) {
+		return nil, layoutError(3, "type section is %d bytes, want 4 per code section (%d)", typesSize, 4*len(codeSizes))
+	}
+
+	var containerSizes []int
+	if kind, ok := r.peek(); ok && kind == kindContainer {
+		r.pos++
+		if containerSizes, err = r.sizes(maxContainerSections, "container", r.u32); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.expectKind(kindData, "data"); err != nil {
+		return nil, err
+	}
+	dataSize, ok := r.u16()
+	if !ok {
+		return nil, layoutError(r.pos, "truncated header")
+	}
+	if err := r.expectKind(headerTerminus, "header terminator"); err != nil {
+		return nil, err
+	}
+
+	c := &Container{Version: int(version), DataSize: dataSize}
+	types, ok := r.bytes(typesSize)
+	if !ok {
+		return nil, layoutError(r.pos, "type section truncated")
+	}
+	for i := 0; i < len(codeSizes); i++ {
+		t := FunctionType{
+			Inputs:  int(types[4*i]),
+			Outputs: int(types[4*i+1]),
+		}
+		increase := int(binary.BigEndian.Uint16(types[4*i+2:]))
+		t.MaxStackHeight = t.Inputs + increase
+		at := r.pos - typesSize + 4*i
+		switch {
+		case i == 0 && (t.Inputs != 0 || t.Outputs != NonReturning):
+			return nil, layoutError(at, "first code section must take no inputs and be non-returning")
+		case t.Inputs > maxIO:
+			return nil, layoutError(at, "code section %d takes %d inputs, more than %d", i, t.Inputs, maxIO)
+		case t.Outputs > maxIO && t.Outputs != NonReturning:
+			return nil, layoutError(at, "code section %d returns %d outputs, more than %d", i, t.Outputs, maxIO)
+		case t.MaxStackHeight > maxStackHeight:
+			return nil, layoutError(at, "code section %d declares a stack height of %d, more than %d", i, t.MaxStackHeight, maxStackHeight)
+		}
+		c.Types = append(c.Types, t)
+	}
+
+	for i, size := range codeSizes {
+		c.CodeOffsets = append(c.CodeOffsets, r.pos)
+		section, ok := r.bytes(size)
+		if !ok {
+			return nil, layoutError(r.pos, "code section %d truncated", i)
+		}
+		c.Code = append(c.Code, section)
+	}
+	for i, size := range containerSizes {
+		at := r.pos
+		raw, ok := r.bytes(size)
+		if !ok {
+			return nil, layoutError(at, "container section %d truncated", i)
+		}
+		sub, err := parse(raw, false)
+		if err != nil {
+			return nil, fmt.Errorf("container section %d: %w", i, err)
+		}
+		c.Containers = append(c.Containers, sub)
+	}
+
+	c.Data = code[r.pos:]
+	switch {
+	case len(c.Data) > dataSize:
+		return nil, layoutError(r.pos+dataSize, "%d bytes after the end of the data section", len(c.Data)-dataSize)
+	case len(c.Data) < dataSize && topLevel:
+		// Only a container still waiting for RETURNCONTRACT's auxiliary
+		// data may be short.
+		return nil, layoutError(len(code), "data section is %d bytes, header declares %d", len(c.Data), dataSize)
+	}
+	c.Size = len(code)
+	return c, nil
+}
+
+// reader reads big-endian header fields.
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) peek() (byte, bool) {
+	if r.pos >= len(r.data) {
+		return 0, false
+	}
+	return r.data[r.pos], true
+}
+
+func (r *reader) u8() (int, bool) {
+	b, ok := r.peek()
+	if ok {
+		r.pos++
+	}
+	return int(b), ok
+}
+
+func (r *reader) u16() (int, bool) {
+	b, ok := r.bytes(2)
+	if !ok {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(b)), true
+}
+
+func (r *reader) u32() (int, bool) {
+	b, ok := r.bytes(4)
+	if !ok {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint32(b)), true
+}
+
+func (r *reader) bytes(n int) ([]byte, bool) {
+	if n > len(r.data)-r.pos {
+		return nil, false
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, true
+}
+
+func (r *reader) expectKind(kind byte, name string) error {
+	b, ok := r.peek()
+	if !ok {
+		return layoutError(r.pos, "truncated header, expected %s section", name)
+	}
+	if b != kind {
+		return layoutError(r.pos, "expected %s section kind 0x%02x, found 0x%02x", name, kind, b)
+	}
+	r.pos++
+	return nil
+}
+
+// sizes reads a section count followed by that many non-zero sizes.
+func (r *reader) sizes(limit int, name string, read func() (int, bool)) ([]int, error) {
+	at := r.pos
+	n, ok := r.u16()
+	switch {
+	case !ok:
+		return nil, layoutError(at, "truncated header")
+	case n == 0:
+		return nil, layoutError(at, "no %s sections", name)
+	case n > limit:
+		return nil, layoutError(at, "%d %s sections, more than %d", n, name, limit)
+	}
+	sizes := make([]int, n)
+	for i := range sizes {
+		at := r.pos
+		if sizes[i], ok = read(); !ok {
+			return nil, layoutError(at, "truncated header")
+		}
+		if sizes[i] == 0 {
+			return nil, layoutError(at, "%s section %d is empty", name, i)
+		}
+	}
+	return sizes, nil
+}
@@ -0,0 +1,112 @@
+package eof
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// section is a code section with its type entry.
+type section struct {
+	inputs, outputs, increase int
+	code                      []byte
+}
+
+// container assembles a version 1 container without subcontainers.
+func container(sections []section, data []byte) []byte {
+	out := []byte{0xef, 0x00, Version, kindTypes}
+	out = binary.BigEndian.AppendUint16(out, uint16(4*len(sections)))
+	out = append(out, kindCode)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(sections)))
+	for _, s := range sections {
+		out = binary.BigEndian.AppendUint16(out, uint16(len(s.code)))
+	}
+	out = append(out, kindData)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(data)))
+	out = append(out, headerTerminus)
+	for _, s := range sections {
+		out = append(out, byte(s.inputs), byte(s.outputs))
+		out = binary.BigEndian.AppendUint16(out, uint16(s.increase))
+	}
+	for _, s := range sections {
+		out = append(out, s.code...)
+	}
+	return append(out, data...)
+}
+
+// entry is a first code section running code.
+func entry(increase int, code ...byte) section {
+	return section{outputs: NonReturning, increase: increase, code: code}
+}
+
+func TestParse(t *testing.T) {
+	stop := container([]section{entry(0, 0x00)}, nil)
+	c, err := Parse(stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Types) != 1 || c.Types[0] != (FunctionType{Outputs: NonReturning}) {
+		t.Errorf("types = %+v, want one non-returning section", c.Types)
+	}
+	if len(c.Code) != 1 || string(c.Code[0]) != "\x00" || c.CodeOffsets[0] != 19 || c.Size != len(stop) {
+		t.Errorf("code = %x at %v, size %d; want 00 at 19, size %d", c.Code, c.CodeOffsets, c.Size, len(stop))
+	}
+
+	// 0: PUSH1 1  2: DATALOADN 0  5: CALLF 1  8: STOP; section 1 returns its input.
+	withCall := container([]section{
+		entry(2, 0x60, 0x01, 0xd1, 0x00, 0x00, 0xe3, 0x00, 0x01, 0x00),
+		{inputs: 1, outputs: 1, code: []byte{0xe4}},
+	}, make([]byte, 32))
+	c, err = Parse(withCall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Code) != 2 || c.Types[1].MaxStackHeight != 1 || c.DataSize != 32 {
+		t.Errorf("parsed %+v, want two sections and 32 bytes of data", c)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	stop := container([]section{entry(0, 0x00)}, nil)
+	tests := []struct {
+		name    string
+		code    []byte
+		section int
+		reason  string
+	}{
+		{"legacy code", []byte{0x60, 0x00}, -1, "missing EOF magic"},
+		{"unknown version", append([]byte{0xef, 0x00, 0x02}, stop[3:]...), -1, "unsupported EOF version 2"},
+		{"trailing bytes", append(stop, 0x00), -1, "1 bytes after the end of the data section"},
+		{"truncated code", stop[:len(stop)-1], -1, "code section 0 truncated"},
+		{"returning first section", container([]section{{outputs: 0, code: []byte{0x00}}}, nil), -1, "first code section must take no inputs"},
+		{"legacy opcode", container([]section{entry(1, 0x5f, 0x56)}, nil), 0, "not allowed in EOF code"},
+		{"jump into an immediate", container([]section{entry(1, 0x60, 0x00, 0xe0, 0xff, 0xfc)}, nil), 0, "RJUMP targets 1"},
+		{"falls off the end", container([]section{entry(1, 0x5f)}, nil), 0, "falls off the end"},
+		{"stack underflow", container([]section{entry(0, 0x01, 0x00)}, nil), 0, "stack underflow"},
+		{"wrong max stack height", container([]section{entry(0, 0x5f, 0x00)}, nil), 0, "maximum stack height is 1, type section declares 0"},
+		{"data read past the end", container([]section{entry(1, 0xd1, 0x00, 0x00, 0x00)}, make([]byte, 16)), 0, "DATALOADN reads 32 bytes at 0"},
+		{"unreachable section", container([]section{entry(0, 0x00), entry(0, 0x00)}, nil), 1, "unreachable"},
+		{"CALLF to a missing section", container([]section{entry(0, 0xe3, 0x00, 0x01, 0x00)}, nil), 0, "only 1 exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.code)
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Parse = %v, want a ValidationError", err)
+			}
+			if verr.Section != tt.section || !strings.Contains(verr.Reason, tt.reason) {
+				t.Errorf("error = %q in section %d, want %q in section %d", verr.Reason, verr.Section, tt.reason, tt.section)
+			}
+		})
+	}
+}
+
+func TestIsEOF(t *testing.T) {
+	for code, want := range map[string]bool{"\xef\x00\x01": true, "\xef\x00": true, "\xef": false, "\x60\x00": false, "": false} {
+		if got := IsEOF([]byte(code)); got != want {
+			t.Errorf("IsEOF(%x) = %v, want %v", code, got, want)
+		}
+	}
+}
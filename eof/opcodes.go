@@ -0,0 +1,103 @@
+package eof
+
+import (
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// deprecated are the legacy opcodes EOF code may not use: dynamic jumps,
+// code and gas introspection, and the legacy call and create family.
+var deprecated = []vm.OpCode{
+	vm.JUMP, vm.JUMPI, vm.PC, vm.GAS,
+	vm.CODESIZE, vm.CODECOPY, vm.EXTCODESIZE, vm.EXTCODECOPY, vm.EXTCODEHASH,
+	vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL,
+	vm.CREATE, vm.CREATE2, vm.SELFDESTRUCT,
+}
+
+// arity is the fixed stack effect of the EOF opcodes. DUPN, SWAPN, EXCHANGE
+// and the function opcodes depend on their immediate or on the type section
+// and are handled separately.
+var arity = map[vm.OpCode][2]int{
+	vm.DATALOAD:        {1, 1},
+	vm.DATALOADN:       {0, 1},
+	vm.DATASIZE:        {0, 1},
+	vm.DATACOPY:        {3, 0},
+	vm.RJUMP:           {0, 0},
+	vm.RJUMPI:          {1, 0},
+	vm.RJUMPV:          {1, 0},
+	vm.EOFCREATE:       {4, 1},
+	vm.RETURNCONTRACT:  {2, 0},
+	vm.RETURNDATALOAD:  {1, 1},
+	vm.EXTCALL:         {4, 1},
+	vm.EXTDELEGATECALL: {3, 1},
+	vm.EXTSTATICCALL:   {3, 1},
+}
+
+var (
+	valid          [256]bool
+	pops, pushes   [256]int
+	functionOpcode = map[vm.OpCode]bool{vm.CALLF: true, vm.RETF: true, vm.JUMPF: true}
+)
+
+func init() {
+	// EOF keeps every opcode of the latest legacy instruction set except
+	// the deprecated ones. go-ethereum does not export whether an opcode
+	// is defined, so reflection reads it.
+	jt, _ := vm.LookupInstructionSet(params.Rules{IsOsaka: true})
+	for i, op := range jt {
+		valid[i] = !reflect.ValueOf(op).Elem().FieldByName("undefined").Bool()
+		minStack, maxStack := op.Stack()
+		pops[i] = minStack
+		pushes[i] = minStack + int(params.StackLimit) - maxStack
+	}
+	valid[vm.INVALID] = true
+	for _, op := range deprecated {
+		valid[op] = false
+	}
+	for op, a := range arity {
+		valid[op] = true
+		pops[op], pushes[op] = a[0], a[1]
+	}
+	for op := range functionOpcode {
+		valid[op] = true
+	}
+	for _, op := range []vm.OpCode{vm.DUPN, vm.SWAPN, vm.EXCHANGE} {
+		valid[op] = true
+	}
+}
+
+// IsValid reports whether op may appear in EOF code.
+func IsValid(op vm.OpCode) bool {
+	return valid[op]
+}
+
+// StackArity returns how many items op pops and pushes, given its
+// immediate. It is not meaningful for CALLF, RETF and JUMPF, whose effect
+// comes from the type section.
+func StackArity(op vm.OpCode, immediate []byte) (int, int) {
+	var imm int
+	if len(immediate) > 0 {
+		imm = int(immediate[0])
+	}
+	switch op {
+	case vm.DUPN:
+		return imm + 1, imm + 2
+	case vm.SWAPN:
+		return imm + 2, imm + 2
+	case vm.EXCHANGE:
+		n, m := imm>>4+1, imm&0x0f+1
+		return n + m + 1, n + m + 1
+	}
+	return pops[op], pushes[op]
+}
+
+// IsTerminating reports whether op ends execution of its code section.
+func IsTerminating(op vm.OpCode) bool {
+	switch op {
+	case vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID, vm.RETF, vm.JUMPF, vm.RETURNCONTRACT:
+		return true
+	}
+	return false
+}
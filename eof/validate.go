@@ -0,0 +1,227 @@
+package eof
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gaslens/disasm"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// validate checks every code section and that every code section and
+// subcontainer is reachable.
+func (c *Container) validate() error {
+	calls := make([][]int, len(c.Code))
+	referenced := make([]bool, len(c.Containers))
+	for i := range c.Code {
+		v := &sectionValidator{c: c, index: i}
+		if err := v.run(); err != nil {
+			return err
+		}
+		calls[i] = v.calls
+		for _, sub := range v.subcontainers {
+			referenced[sub] = true
+		}
+	}
+
+	visited := map[int]bool{0: true}
+	queue := []int{0}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range calls[cur] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	for i := range c.Code {
+		if !visited[i] {
+			return &ValidationError{Section: i, Reason: "code section is unreachable from section 0"}
+		}
+	}
+	for i, ok := range referenced {
+		if !ok {
+			return layoutError(0, "container section %d is never used by EOFCREATE or RETURNCONTRACT", i)
+		}
+	}
+	return nil
+}
+
+// sectionValidator checks one code section: its opcodes and immediates,
+// its relative jumps and its stack heights.
+type sectionValidator struct {
+	c             *Container
+	index         int
+	calls         []int // sections entered by CALLF or JUMPF
+	subcontainers []int
+}
+
+func (v *sectionValidator) fail(pc int, format string, args ...interface{}) error {
+	return &ValidationError{Section: v.index, Offset: pc, Reason: fmt.Sprintf(format, args...)}
+}
+
+// stackRange is the lowest and highest stack height an instruction can be
+// reached with.
+type stackRange struct {
+	min, max int
+	set      bool
+}
+
+func (v *sectionValidator) run() error {
+	code := v.c.Code[v.index]
+	typ := v.c.Types[v.index]
+	instrs := disasm.DisassembleEOF(code)
+
+	boundary := map[int]bool{}
+	for _, ins := range instrs {
+		boundary[ins.PC] = true
+	}
+	returns := false
+	for _, ins := range instrs {
+		if err := v.checkInstruction(ins, boundary); err != nil {
+			return err
+		}
+		switch ins.Op {
+		case vm.RETF:
+			returns = true
+		case vm.JUMPF:
+			if v.c.Types[v.target(ins)].Outputs != NonReturning {
+				returns = true
+			}
+		}
+	}
+	if typ.Outputs == NonReturning && returns {
+		return v.fail(0, "non-returning section contains RETF or a JUMPF to a returning section")
+	}
+	if typ.Outputs != NonReturning && !returns {
+		return v.fail(0, "section declares %d outputs but never returns", typ.Outputs)
+	}
+	return v.checkStack(instrs, typ)
+}
+
+// target returns the code section index of a CALLF or JUMPF.
+func (v *sectionValidator) target(ins disasm.Instruction) int {
+	return int(binary.BigEndian.Uint16(ins.Immediate))
+}
+
+func (v *sectionValidator) checkInstruction(ins disasm.Instruction, boundary map[int]bool) error {
+	if !IsValid(ins.Op) {
+		return v.fail(ins.PC, "opcode 0x%02x (%s) is not allowed in EOF code", byte(ins.Op), ins.Op)
+	}
+	if len(ins.Immediate) < disasm.EOFImmediateSize(v.c.Code[v.index], ins.PC) {
+		return v.fail(ins.PC, "%s immediate runs past the end of the section", ins.Op)
+	}
+	for _, t := range ins.RelativeTargets() {
+		if !boundary[t] {
+			return v.fail(ins.PC, "%s targets %d, which is not the start of an instruction", ins.Op, t)
+		}
+	}
+	switch ins.Op {
+	case vm.CALLF, vm.JUMPF:
+		t := v.target(ins)
+		if t >= len(v.c.Code) {
+			return v.fail(ins.PC, "%s to code section %d, only %d exist", ins.Op, t, len(v.c.Code))
+		}
+		if ins.Op == vm.CALLF && v.c.Types[t].Outputs == NonReturning {
+			return v.fail(ins.PC, "CALLF to non-returning code section %d", t)
+		}
+		v.calls = append(v.calls, t)
+	case vm.DATALOADN:
+		if off := int(binary.BigEndian.Uint16(ins.Immediate)); off+32 > v.c.DataSize {
+			return v.fail(ins.PC, "DATALOADN reads 32 bytes at %d, data section is %d bytes", off, v.c.DataSize)
+		}
+	case vm.EOFCREATE, vm.RETURNCONTRACT:
+		sub := int(ins.Immediate[0])
+		if sub >= len(v.c.Containers) {
+			return v.fail(ins.PC, "%s uses container section %d, only %d exist", ins.Op, sub, len(v.c.Containers))
+		}
+		v.subcontainers = append(v.subcontainers, sub)
+	}
+	return nil
+}
+
+// checkStack implements EIP-5450: every instruction must be reachable,
+// never underflow the stack, and be reached by backward jumps with the
+// exact height it has on the forward path. The highest height reached must
+// match the declared maximum.
+func (v *sectionValidator) checkStack(instrs []disasm.Instruction, typ FunctionType) error {
+	index := map[int]int{}
+	for i, ins := range instrs {
+		index[ins.PC] = i
+	}
+	heights := make([]stackRange, len(instrs))
+	heights[0] = stackRange{typ.Inputs, typ.Inputs, true}
+	highest := typ.Inputs
+
+	for i, ins := range instrs {
+		h := heights[i]
+		if !h.set {
+			return v.fail(ins.PC, "unreachable instruction %s", ins.Op)
+		}
+
+		pop, push := StackArity(ins.Op, ins.Immediate)
+		switch ins.Op {
+		case vm.CALLF:
+			t := v.c.Types[v.target(ins)]
+			pop, push = t.Inputs, t.Outputs
+			if h.max+t.MaxStackHeight-t.Inputs > int(params.StackLimit) {
+				return v.fail(ins.PC, "CALLF may overflow the stack")
+			}
+		case vm.JUMPF:
+			t := v.c.Types[v.target(ins)]
+			if h.max+t.MaxStackHeight-t.Inputs > int(params.StackLimit) {
+				return v.fail(ins.PC, "JUMPF may overflow the stack")
+			}
+			pop = t.Inputs
+			if t.Outputs != NonReturning {
+				want := typ.Outputs + t.Inputs - t.Outputs
+				if typ.Outputs < t.Outputs || h.min != want || h.max != want {
+					return v.fail(ins.PC, "JUMPF needs a stack height of exactly %d, found %d..%d", want, h.min, h.max)
+				}
+			}
+		case vm.RETF:
+			pop = typ.Outputs
+			if h.min != typ.Outputs || h.max != typ.Outputs {
+				return v.fail(ins.PC, "RETF needs a stack height of exactly %d, found %d..%d", typ.Outputs, h.min, h.max)
+			}
+		}
+		if h.min < pop {
+			return v.fail(ins.PC, "stack underflow: %s needs %d items, %d may be present", ins.Op, pop, h.min)
+		}
+		next := stackRange{h.min - pop + push, h.max - pop + push, true}
+		highest = max(highest, next.max)
+
+		var succs []int
+		if !IsTerminating(ins.Op) && ins.Op != vm.RJUMP {
+			succs = append(succs, ins.PC+ins.Size)
+		}
+		succs = append(succs, ins.RelativeTargets()...)
+		for _, pc := range succs {
+			j, ok := index[pc]
+			if !ok {
+				return v.fail(ins.PC, "execution falls off the end of the section")
+			}
+			cur := &heights[j]
+			switch {
+			case j <= i:
+				if cur.min != next.min || cur.max != next.max {
+					return v.fail(ins.PC, "backward jump to pc %d with stack height %d..%d, expected %d..%d", pc, next.min, next.max, cur.min, cur.max)
+				}
+			case !cur.set:
+				*cur = next
+			default:
+				cur.min, cur.max = min(cur.min, next.min), max(cur.max, next.max)
+			}
+		}
+	}
+	if highest > maxStackHeight {
+		return v.fail(0, "stack height reaches %d, more than %d", highest, maxStackHeight)
+	}
+	if highest != typ.MaxStackHeight {
+		return v.fail(0, "maximum stack height is %d, type section declares %d", highest, typ.MaxStackHeight)
+	}
+	return nil
+}
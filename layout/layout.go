@@ -0,0 +1,208 @@
+// Package layout reads the storage layout solc emits with --storage-layout,
+// either on its own or inside a Foundry or Hardhat artifact, and names the
+// state variables that occupy each storage slot.
+package layout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/holiman/uint256"
+)
+
+// Type encodings used by solc.
+const (
+	Inplace      = "inplace"
+	Mapping      = "mapping"
+	DynamicArray = "dynamic_array"
+	Bytes        = "bytes"
+)
+
+// Layout is a contract's storage layout.
+type Layout struct {
+	Storage []Entry         `json:"storage"`
+	Types   map[string]Type `json:"types"`
+}
+
+// Entry is a state variable or struct member: it starts at Offset bytes
+// into Slot, counted from the low-order end of the slot.
+type Entry struct {
+	Label  string `json:"label"`
+	Slot   string `json:"slot"`
+	Offset int    `json:"offset"`
+	Type   string `json:"type"`
+}
+
+// Type describes a type identifier used by the entries.
+type Type struct {
+	Label         string  `json:"label"`
+	Encoding      string  `json:"encoding"`
+	NumberOfBytes string  `json:"numberOfBytes"`
+	Key           string  `json:"key,omitempty"`
+	Value         string  `json:"value,omitempty"`
+	Base          string  `json:"base,omitempty"`
+	Members       []Entry `json:"members,omitempty"`
+}
+
+// Field is a variable, or part of one, that occupies a slot.
+type Field struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Encoding string `json:"encoding"`
+	Offset   int    `json:"offset"`
+	Bytes    int    `json:"bytes"`
+}
+
+// Slot is a storage slot and the fields packed into it. Movable is set
+// when it holds only top-level value variables, whose slots depend on
+// nothing but declaration order.
+type Slot struct {
+	Slot    *uint256.Int
+	Fields  []Field
+	Used    int
+	Movable bool
+}
+
+// Load reads a storage layout from path. The file may be solc's layout
+// itself, or an artifact with a storageLayout field.
+func Load(path string) (*Layout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes a storage layout, or an artifact with a storageLayout field.
+func Parse(data []byte) (*Layout, error) {
+	var doc struct {
+		Layout
+		StorageLayout *Layout `json:"storageLayout"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("not a storage layout or artifact: %w", err)
+	}
+	l := doc.StorageLayout
+	if l == nil {
+		l = &doc.Layout
+	}
+	if l.Storage == nil {
+		return nil, errors.New("no storage layout found")
+	}
+	for _, e := range l.Storage {
+		if _, err := parseSlot(e.Slot); err != nil {
+			return nil, fmt.Errorf("variable %s: %w", e.Label, err)
+		}
+		if _, ok := l.Types[e.Type]; !ok {
+			return nil, fmt.Errorf("variable %s: unknown type %s", e.Label, e.Type)
+		}
+	}
+	return l, nil
+}
+
+func parseSlot(s string) (*uint256.Int, error) {
+	slot, err := uint256.FromDecimal(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid slot %q", s)
+	}
+	return slot, nil
+}
+
+// size returns a type's numberOfBytes.
+func (l *Layout) size(typ string) int {
+	n, _ := strconv.Atoi(l.Types[typ].NumberOfBytes)
+	return n
+}
+
+// leaf is a field together with the slots it spans.
+type leaf struct {
+	field  Field
+	start  *uint256.Int
+	slots  uint64
+	member bool
+}
+
+// walk calls fn for every variable and, inside structs, every member, with
+// the slot it starts at. Static arrays are reported whole.
+func (l *Layout) walk(fn func(leaf)) {
+	var visit func(entries []Entry, base *uint256.Int, prefix string, member bool)
+	visit = func(entries []Entry, base *uint256.Int, prefix string, member bool) {
+		for _, e := range entries {
+			rel, err := parseSlot(e.Slot)
+			if err != nil {
+				continue
+			}
+			start := new(uint256.Int).Add(base, rel)
+			t := l.Types[e.Type]
+			name := prefix + e.Label
+			if t.Encoding == Inplace && len(t.Members) > 0 {
+				visit(t.Members, start, name+".", true)
+				continue
+			}
+			bytes := l.size(e.Type)
+			slots := uint64(1)
+			if t.Encoding != Inplace {
+				bytes = 32
+			} else if bytes > 32 {
+				slots = uint64(bytes+31) / 32
+				bytes = 32
+			}
+			fn(leaf{
+				field:  Field{Name: name, Type: t.Label, Encoding: t.Encoding, Offset: e.Offset, Bytes: bytes},
+				start:  start,
+				slots:  slots,
+				member: member || t.Base != "",
+			})
+		}
+	}
+	visit(l.Storage, new(uint256.Int), "", false)
+}
+
+// At returns the fields that occupy slot, ordered by offset.
+func (l *Layout) At(slot *uint256.Int) []Field {
+	var out []Field
+	l.walk(func(f leaf) {
+		if slot.Lt(f.start) {
+			return
+		}
+		end := new(uint256.Int).AddUint64(f.start, f.slots)
+		if slot.Lt(end) {
+			out = append(out, f.field)
+		}
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Offset < out[j].Offset })
+	return out
+}
+
+// Slots returns every slot that holds value variables, struct members or
+// the base of a mapping or dynamic array, ordered by slot. Static arrays
+// spanning several slots are left out.
+func (l *Layout) Slots() []Slot {
+	bySlot := map[uint256.Int]*Slot{}
+	l.walk(func(f leaf) {
+		if f.slots > 1 {
+			return
+		}
+		s := bySlot[*f.start]
+		if s == nil {
+			s = &Slot{Slot: f.start, Movable: true}
+			bySlot[*f.start] = s
+		}
+		s.Fields = append(s.Fields, f.field)
+		s.Used = max(s.Used, f.field.Offset+f.field.Bytes)
+		if f.member || f.field.Encoding != Inplace {
+			s.Movable = false
+		}
+	})
+	out := make([]Slot, 0, len(bySlot))
+	for _, s := range bySlot {
+		sort.Slice(s.Fields, func(i, j int) bool { return s.Fields[i].Offset < s.Fields[j].Offset })
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Slot.Lt(out[j].Slot) })
+	return out
+}
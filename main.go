@@ -1,11 +1,21 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"math/big"
 	"os"
+	"strings"
+
 	"gaslens/analyzer"
+	"gaslens/artifact"
+	"gaslens/layout"
+	"gaslens/signatures"
+	"gaslens/srcmap"
 	"gaslens/utils"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/joho/godotenv"
 )
 
@@ -16,32 +26,442 @@ func main() {
 		log.Println("No .env file found, falling back to environment variables")
 	}
 
-	if len(os.Args) < 2 {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "execute":
+			runExecute(os.Args[2:])
+			return
+		case "profile":
+			runProfile(os.Args[2:])
+			return
+		case "signatures":
+			runSignatures(os.Args[2:])
+			return
+		}
+	}
+
+	address := flag.String("address", "", "analyze the deployed contract at this address")
+	detailed := flag.Bool("detailed", false, "print the detailed technical analysis")
+	fork := flag.String("fork", analyzer.DefaultFork, "hardfork whose gas rules are used ("+strings.Join(analyzer.Forks, ", ")+")")
+	abiPath := flag.String("abi", "", "JSON ABI whose function and event names are added to the signature database")
+	sigDB := flag.String("sigdb", signatures.DefaultPath(), "local signature database loaded on top of the bundled one")
+	layoutPath := flag.String("layout", "", "solc storage layout JSON (or an artifact containing one) used to name storage slots")
+	srcmapPath := flag.String("srcmap", "", "solc deployedBytecode.sourceMap, standard JSON output, build-info or artifact mapping instructions to source lines")
+	sources := flag.String("sources", "", "comma-separated source files in solc's source index order (required for a bare source map)")
+	contract := flag.String("contract", "", "analyze only this contract of an artifact directory or solc output")
+	flag.Usage = func() {
 		fmt.Println("Usage:")
 		fmt.Println("  gaslens <bytecode_file>                    # Simple analysis")
 		fmt.Println("  gaslens -address <contract_address>        # Analyze deployed contract")
 		fmt.Println("  gaslens -detailed <bytecode_file>          # Detailed technical analysis")
+		fmt.Println("  gaslens -fork cancun <bytecode_file>       # Price under a specific hardfork")
+		fmt.Println("  gaslens -srcmap <build-info.json> <bytecode_file> # Gas per source line")
+		fmt.Println("  gaslens out/                               # Every contract in Foundry/Hardhat artifacts")
+		fmt.Println("  gaslens -contract Vault combined.json      # One contract of solc JSON output")
+		fmt.Println("  gaslens execute [flags] <bytecode_file>    # Run a call in a local EVM")
+		fmt.Println("  gaslens profile -abi <abi.json> <bytecode_file> # Gas per function")
+		fmt.Println("  gaslens signatures import <abi.json>...    # Save ABI signatures locally")
+		fmt.Println()
+		fmt.Println("Flags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	schedule, err := analyzer.NewGasSchedule(*fork)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *address == "" && flag.NArg() >= 1 && artifact.IsArtifact(flag.Arg(0)) {
+		contracts := loadContracts(flag.Arg(0), *contract)
+		sigs := loadSignatures(*sigDB, *abiPath)
+		for _, c := range contracts {
+			if len(contracts) > 1 {
+				fmt.Printf("\n===== %s =====\n", c.Qualified())
+			}
+			if len(c.Code()) == 0 {
+				fmt.Println(skipReason(c))
+				continue
+			}
+			opts := analyzer.Options{
+				Detailed:   *detailed,
+				Schedule:   schedule,
+				Signatures: withArtifact(sigs, c),
+				Layout:     c.Layout,
+				SourceMap:  c.SourceMap,
+				Contract:   c.Qualified(),
+			}
+			if *layoutPath != "" {
+				opts.Layout = loadLayout(*layoutPath)
+			}
+			if *srcmapPath != "" {
+				opts.SourceMap = loadSourceMap(*srcmapPath, *sources, c.Code())
+			}
+			if len(contracts) > 1 {
+				opts.ReportName = reportName(c, contracts)
+			}
+			if err := analyzer.AnalyzeBytecode(c.Code(), opts); err != nil {
+				log.Fatalf("Analysis of %s failed: %v", c.Qualified(), err)
+			}
+		}
+		return
+	}
+
+	code, _ := loadCode(*address, "", flag.CommandLine)
+	if code == nil {
+		flag.Usage()
+		return
+	}
+
+	err = analyzer.AnalyzeBytecode(code, analyzer.Options{
+		Detailed:   *detailed,
+		Schedule:   schedule,
+		Signatures: loadSignatures(*sigDB, *abiPath),
+		Layout:     loadLayout(*layoutPath),
+		SourceMap:  loadSourceMap(*srcmapPath, *sources, code),
+	})
+	if err != nil {
+		log.Fatalf("Analysis failed: %v", err)
+	}
+}
+
+// runExecute implements the execute subcommand: the bytecode is deployed into
+// an in-memory state and called once with the given calldata.
+func runExecute(args []string) {
+	fs := flag.NewFlagSet("execute", flag.ExitOnError)
+	address := fs.String("address", "", "execute the deployed code of this contract address")
+	detailed := fs.Bool("detailed", false, "print the detailed technical analysis")
+	fork := fs.String("fork", analyzer.DefaultFork, "hardfork whose rules the EVM runs under")
+	calldata := fs.String("calldata", "", "hex-encoded calldata for the call")
+	value := fs.String("value", "0", "wei sent with the call")
+	caller := fs.String("caller", "0x0000000000000000000000000000000000001000", "address making the call")
+	gasLimit := fs.Uint64("gas", analyzer.DefaultExecGasLimit, "gas limit for the call")
+	abiPath := fs.String("abi", "", "JSON ABI whose function and event names are added to the signature database")
+	sigDB := fs.String("sigdb", signatures.DefaultPath(), "local signature database loaded on top of the bundled one")
+	layoutPath := fs.String("layout", "", "solc storage layout JSON (or an artifact containing one) used to name storage slots")
+	srcmapPath := fs.String("srcmap", "", "solc deployedBytecode.sourceMap, standard JSON output, build-info or artifact mapping instructions to source lines")
+	sources := fs.String("sources", "", "comma-separated source files in solc's source index order (required for a bare source map)")
+	contract := fs.String("contract", "", "execute this contract of an artifact directory or solc output")
+	fs.Usage = func() {
+		fmt.Println("Usage:")
+		fmt.Println("  gaslens execute [flags] <bytecode_file>")
+		fmt.Println("  gaslens execute [flags] -address <contract_address>")
+		fmt.Println("  gaslens execute [-contract <name>] [flags] <artifact>")
+		fmt.Println()
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	schedule, err := analyzer.NewGasSchedule(*fork)
+	if err != nil {
+		log.Fatal(err)
+	}
+	input, err := utils.ParseHex(*calldata)
+	if err != nil {
+		log.Fatalf("Invalid calldata: %v", err)
+	}
+	wei, ok := new(big.Int).SetString(*value, 0)
+	if !ok || wei.Sign() < 0 {
+		log.Fatalf("Invalid value: %s", *value)
+	}
+	if !common.IsHexAddress(*caller) {
+		log.Fatalf("Invalid caller address: %s", *caller)
+	}
+
+	code, c := loadCode(*address, *contract, fs)
+	if code == nil {
+		fs.Usage()
+		return
+	}
+
+	err = analyzer.ExecuteBytecode(code, analyzer.ExecOptions{
+		Detailed:   *detailed,
+		Schedule:   schedule,
+		Signatures: withArtifact(loadSignatures(*sigDB, *abiPath), c),
+		Layout:     artifactLayout(*layoutPath, c),
+		SourceMap:  artifactSourceMap(*srcmapPath, *sources, code, c),
+		Calldata:   input,
+		Value:      wei,
+		Caller:     common.HexToAddress(*caller),
+		GasLimit:   *gasLimit,
+	})
+	if err != nil {
+		log.Fatalf("Execution failed: %v", err)
+	}
+}
+
+// runProfile implements the profile subcommand: every function in the ABI
+// is called in a local EVM and its gas reported by name.
+func runProfile(args []string) {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	address := fs.String("address", "", "profile the deployed code of this contract address")
+	detailed := fs.Bool("detailed", false, "list every call made for each function")
+	fork := fs.String("fork", analyzer.DefaultFork, "hardfork whose rules the EVM runs under")
+	abiPath := fs.String("abi", "", "JSON ABI of the contract (required unless the contract is an artifact with one)")
+	argsPath := fs.String("args", "", "JSON file mapping function names or signatures to argument sets")
+	caller := fs.String("caller", "0x0000000000000000000000000000000000001000", "address making the calls")
+	gasLimit := fs.Uint64("gas", analyzer.DefaultExecGasLimit, "gas limit for each call")
+	sigDB := fs.String("sigdb", signatures.DefaultPath(), "local signature database loaded on top of the bundled one")
+	layoutPath := fs.String("layout", "", "solc storage layout JSON (or an artifact containing one) used to name storage slots")
+	srcmapPath := fs.String("srcmap", "", "solc deployedBytecode.sourceMap, standard JSON output, build-info or artifact mapping instructions to source lines")
+	sources := fs.String("sources", "", "comma-separated source files in solc's source index order (required for a bare source map)")
+	contract := fs.String("contract", "", "profile this contract of an artifact directory or solc output")
+	fs.Usage = func() {
+		fmt.Println("Usage:")
+		fmt.Println("  gaslens profile -abi <abi.json> [-args <args.json>] [flags] <bytecode_file>")
+		fmt.Println("  gaslens profile [-args <args.json>] [-contract <name>] [flags] <artifact>")
+		fmt.Println("  gaslens profile -abi <abi.json> [flags] -address <contract_address>")
+		fmt.Println()
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	schedule, err := analyzer.NewGasSchedule(*fork)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !common.IsHexAddress(*caller) {
+		log.Fatalf("Invalid caller address: %s", *caller)
+	}
+	var callArgs analyzer.ProfileArgs
+	if *argsPath != "" {
+		utils.ReadJSONFile(*argsPath, &callArgs)
+	}
+
+	code, c := loadCode(*address, *contract, fs)
+	var contractABI abi.ABI
+	switch {
+	case code == nil:
+		fs.Usage()
+		return
+	case *abiPath != "":
+		contractABI = utils.ReadABI(*abiPath)
+	case c != nil && c.ABI != nil:
+		contractABI = *c.ABI
+	default:
+		fs.Usage()
+		return
+	}
+
+	err = analyzer.ProfileBytecode(code, analyzer.ProfileOptions{
+		Detailed:   *detailed,
+		Schedule:   schedule,
+		Signatures: withArtifact(loadSignatures(*sigDB, *abiPath), c),
+		Layout:     artifactLayout(*layoutPath, c),
+		SourceMap:  artifactSourceMap(*srcmapPath, *sources, code, c),
+		ABI:        contractABI,
+		Args:       callArgs,
+		Caller:     common.HexToAddress(*caller),
+		GasLimit:   *gasLimit,
+	})
+	if err != nil {
+		log.Fatalf("Profiling failed: %v", err)
+	}
+}
+
+// runSignatures implements the signatures subcommand, which imports ABI
+// signatures into the local database or looks selectors and topics up.
+func runSignatures(args []string) {
+	fs := flag.NewFlagSet("signatures", flag.ExitOnError)
+	dbPath := fs.String("db", signatures.DefaultPath(), "local signature database")
+	fs.Usage = func() {
+		fmt.Println("Usage:")
+		fmt.Println("  gaslens signatures [-db <file>] import <abi.json>...   # Add ABI signatures")
+		fmt.Println("  gaslens signatures [-db <file>] lookup <selector|topic>...")
+		fmt.Println()
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
 		return
 	}
 
-	var code []byte
-	detailed := false
+	local, err := signatures.Load(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to load signature database: %v", err)
+	}
+	switch fs.Arg(0) {
+	case "import":
+		before := len(local.Functions) + len(local.Events)
+		for _, path := range fs.Args()[1:] {
+			local.AddABI(utils.ReadABI(path))
+		}
+		if err := local.Save(*dbPath); err != nil {
+			log.Fatalf("Failed to save signature database: %v", err)
+		}
+		fmt.Printf("Imported %d new selectors and topics into %s\n", len(local.Functions)+len(local.Events)-before, *dbPath)
+	case "lookup":
+		db := signatures.Bundled()
+		db.Merge(local)
+		for _, key := range fs.Args()[1:] {
+			sigs := db.Function(key)
+			if len(key) > 10 {
+				sigs = db.Event(key)
+			}
+			if len(sigs) == 0 {
+				fmt.Printf("%s: unknown\n", key)
+				continue
+			}
+			fmt.Printf("%s: %s\n", key, strings.Join(sigs, " | "))
+		}
+	default:
+		fs.Usage()
+	}
+}
+
+// loadSignatures returns the bundled signature database merged with the
+// local one at dbPath and, when abiPath is set, the signatures of that ABI.
+func loadSignatures(dbPath, abiPath string) *signatures.DB {
+	db := signatures.Bundled()
+	local, err := signatures.Load(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to load signature database: %v", err)
+	}
+	db.Merge(local)
+	if abiPath != "" {
+		db.AddABI(utils.ReadABI(abiPath))
+	}
+	return db
+}
+
+// withArtifact returns db with the signatures of c's ABI added, leaving db
+// as it is, or db itself when c is nil or has no ABI.
+func withArtifact(db *signatures.DB, c *artifact.Contract) *signatures.DB {
+	if c == nil || c.ABI == nil {
+		return db
+	}
+	out := signatures.New()
+	out.Merge(db)
+	out.AddABI(*c.ABI)
+	return out
+}
+
+// artifactLayout reads the storage layout at path, or falls back to c's.
+func artifactLayout(path string, c *artifact.Contract) *layout.Layout {
+	if path == "" && c != nil {
+		return c.Layout
+	}
+	return loadLayout(path)
+}
+
+// artifactSourceMap reads the source map of code at path, or falls back to
+// c's.
+func artifactSourceMap(path, sources string, code []byte, c *artifact.Contract) *srcmap.Map {
+	if path == "" && c != nil {
+		return c.SourceMap
+	}
+	return loadSourceMap(path, sources, code)
+}
+
+// loadLayout reads a storage layout, or returns nil when no path is given.
+func loadLayout(path string) *layout.Layout {
+	if path == "" {
+		return nil
+	}
+	l, err := layout.Load(path)
+	if err != nil {
+		log.Fatalf("Failed to load storage layout: %v", err)
+	}
+	return l
+}
+
+// loadSourceMap reads the source map of code, or returns nil when no path
+// is given. The map covers the runtime code, so creation code is split
+// first.
+func loadSourceMap(path, sources string, code []byte) *srcmap.Map {
+	if path == "" {
+		return nil
+	}
+	runtime := code
+	if creation, ok := analyzer.SplitCreationCode(code); ok {
+		runtime = creation.Runtime
+	}
+	var names []string
+	if sources != "" {
+		names = strings.Split(sources, ",")
+	}
+	m, err := srcmap.Load(path, runtime, names)
+	if err != nil {
+		log.Fatalf("Failed to load source map: %v", err)
+	}
+	return m
+}
+
+// loadContracts reads the contracts in an artifact file or directory, or
+// only the one called name when it is given.
+func loadContracts(path, name string) []*artifact.Contract {
+	contracts, err := artifact.Load(path)
+	if err != nil {
+		log.Fatalf("Failed to load artifacts: %v", err)
+	}
+	if name == "" {
+		return contracts
+	}
+	c, err := artifact.Find(contracts, name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return []*artifact.Contract{c}
+}
 
-	// Check for flags
-	if os.Args[1] == "-address" && len(os.Args) >= 3 {
+// skipReason explains why a contract has no code to analyze.
+func skipReason(c *artifact.Contract) string {
+	if c.Unlinked {
+		return fmt.Sprintf("Skipping %s: it links libraries whose addresses are not filled in", c.Qualified())
+	}
+	return fmt.Sprintf("Skipping %s: no bytecode (interface or abstract contract)", c.Qualified())
+}
+
+// reportName names the exported reports of a contract analyzed with
+// others after it, qualified by its file when another shares the name.
+func reportName(c *artifact.Contract, contracts []*artifact.Contract) string {
+	name := c.Name
+	for _, other := range contracts {
+		if other != c && other.Name == c.Name {
+			name = strings.NewReplacer("/", "_", "\\", "_", ":", "_", ".sol", "").Replace(c.Qualified())
+			break
+		}
+	}
+	return "analysis_report_" + name
+}
+
+// loadCode fetches bytecode for address from Etherscan, or reads it from the
+// first positional argument, which may also be an artifact; the contract
+// called name, or its only contract with bytecode, is returned too, for its
+// ABI, layout and source map. It returns nil code when neither was given.
+func loadCode(address, name string, fs *flag.FlagSet) ([]byte, *artifact.Contract) {
+	if address != "" {
 		apiKey := os.Getenv("ETHERSCAN_API_KEY")
 		if apiKey == "" {
 			log.Fatal("ETHERSCAN_API_KEY not set. Please set it in your environment or .env file")
 		}
 
-		address := os.Args[2]
-		code = utils.FetchBytecode(address, apiKey)
-	} else if os.Args[1] == "-detailed" && len(os.Args) >= 3 {
-		detailed = true
-		code = utils.ReadHexFile(os.Args[2])
-	} else {
-		code = utils.ReadHexFile(os.Args[1])
+		return utils.FetchBytecode(address, apiKey), nil
 	}
-
-	analyzer.AnalyzeBytecode(code, detailed)
+	if fs.NArg() >= 1 && artifact.IsArtifact(fs.Arg(0)) {
+		var withCode []*artifact.Contract
+		for _, c := range loadContracts(fs.Arg(0), name) {
+			if len(c.Code()) == 0 && name != "" {
+				log.Fatal(skipReason(c))
+			}
+			if len(c.Code()) > 0 {
+				withCode = append(withCode, c)
+			}
+		}
+		if len(withCode) != 1 {
+			log.Fatalf("%s holds %d contracts with bytecode; pick one with -contract (%s)", fs.Arg(0), len(withCode), artifact.Names(withCode))
+		}
+		return withCode[0].Code(), withCode[0]
+	}
+	if name != "" {
+		log.Fatal("-contract needs an artifact file or directory")
+	}
+	if fs.NArg() >= 1 {
+		return utils.ReadHexFile(fs.Arg(0)), nil
+	}
+	return nil, nil
 }
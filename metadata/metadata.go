@@ -0,0 +1,254 @@
+// Package metadata detects and decodes the CBOR metadata trailer that solc
+// and Vyper append to runtime bytecode.
+//
+// The trailer is a CBOR value followed by its length as a two-byte big-endian
+// integer. solc encodes a map such as {"ipfs": <multihash>, "solc": 0x00081c};
+// Vyper encodes {"vyper": [0, 3, 10]} or, since 0.4, a list whose last
+// element is that map, and from 0.3.10 on counts the length suffix in the
+// length.
+package metadata
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// Metadata is the decoded trailer. Size counts the CBOR bytes and the
+// two-byte length suffix, all of which are excluded from analysis.
+type Metadata struct {
+	Compiler     string `json:"compiler,omitempty"`
+	Version      string `json:"version,omitempty"`
+	SourceHash   string `json:"source_hash,omitempty"`
+	Experimental bool   `json:"experimental,omitempty"`
+	Size         int    `json:"size"`
+}
+
+// Split returns code without its metadata trailer, and the decoded trailer.
+// When no valid trailer is found it returns code unchanged and nil.
+//
+// solc and older Vyper give the length of the CBOR value alone; Vyper
+// 0.3.10 and later count the two length bytes too, so both are tried.
+func Split(code []byte) ([]byte, *Metadata) {
+	if len(code) < 2 {
+		return code, nil
+	}
+	length := int(binary.BigEndian.Uint16(code[len(code)-2:]))
+	if length == 0 {
+		return code, nil
+	}
+	for _, start := range []int{len(code) - 2 - length, len(code) - length} {
+		if start < 0 || start > len(code)-2 {
+			continue
+		}
+		if md := decodeTrailer(code[start : len(code)-2]); md != nil {
+			md.Size = len(code) - start
+			return code[:start], md
+		}
+	}
+	return code, nil
+}
+
+// decodeTrailer decodes data as a single CBOR value holding compiler
+// metadata, or returns nil.
+func decodeTrailer(data []byte) *Metadata {
+	d := &decoder{data: data}
+	value, err := d.value(0)
+	if err != nil || d.pos != len(d.data) {
+		return nil
+	}
+	return fromValue(value)
+}
+
+// fromValue interprets a decoded trailer, returning nil if it holds no
+// known compiler key.
+func fromValue(value interface{}) *Metadata {
+	if list, ok := value.([]interface{}); ok && len(list) > 0 {
+		// Vyper 0.4 puts the compiler map last, after section sizes.
+		value = list[len(list)-1]
+	}
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	md := &Metadata{}
+	found := false
+	for key, v := range m {
+		switch key {
+		case "solc":
+			md.Compiler, found = "solc", true
+			switch version := v.(type) {
+			case []byte:
+				if len(version) == 3 {
+					md.Version = fmt.Sprintf("%d.%d.%d", version[0], version[1], version[2])
+				}
+			case string:
+				md.Version = version
+			}
+		case "vyper":
+			md.Compiler, found = "vyper", true
+			if parts, ok := v.([]interface{}); ok {
+				md.Version = joinVersion(parts)
+			}
+		case "ipfs":
+			if b, ok := v.([]byte); ok {
+				md.SourceHash, found = "ipfs://"+base58(b), true
+			}
+		case "bzzr0", "bzzr1":
+			if b, ok := v.([]byte); ok {
+				md.SourceHash, found = key+"://"+hex.EncodeToString(b), true
+			}
+		case "experimental":
+			md.Experimental, _ = v.(bool)
+		}
+	}
+	if !found {
+		return nil
+	}
+	if md.Compiler == "" {
+		// Versions of solc before 0.5.9 did not record themselves.
+		md.Compiler = "solc"
+	}
+	return md
+}
+
+func joinVersion(parts []interface{}) string {
+	version := ""
+	for i, p := range parts {
+		n, ok := p.(uint64)
+		if !ok {
+			return ""
+		}
+		if i > 0 {
+			version += "."
+		}
+		version += fmt.Sprint(n)
+	}
+	return version
+}
+
+// maxDepth bounds nesting so malformed trailers cannot recurse deeply.
+const maxDepth = 8
+
+// decoder reads the subset of CBOR used by compiler metadata: unsigned and
+// negative integers, byte and text strings, arrays, maps with text keys and
+// the simple values false, true and null.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("nesting too deep")
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		return arg, nil
+	case 1:
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("string overruns trailer")
+		}
+		b := d.data[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		if major == 3 {
+			return string(b), nil
+		}
+		return b, nil
+	case 4:
+		if arg > uint64(len(d.data)) {
+			return nil, fmt.Errorf("array overruns trailer")
+		}
+		list := make([]interface{}, arg)
+		for i := range list {
+			if list[i], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case 5:
+		if arg > uint64(len(d.data)) {
+			return nil, fmt.Errorf("map overruns trailer")
+		}
+		m := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-text map key")
+			}
+			if m[k], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case 7:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported CBOR item (major type %d)", major)
+}
+
+// head reads an item's major type and argument.
+func (d *decoder) head() (major byte, arg uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, fmt.Errorf("unexpected end of trailer")
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info := b>>5, b&0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, fmt.Errorf("indefinite or reserved length")
+	}
+	size := 1 << (info - 24)
+	if d.pos+size > len(d.data) {
+		return 0, 0, fmt.Errorf("unexpected end of trailer")
+	}
+	for _, c := range d.data[d.pos : d.pos+size] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.pos += size
+	return major, arg, nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58 encodes b in the Bitcoin alphabet used by IPFS content IDs.
+func base58(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	base, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
@@ -0,0 +1,81 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSplit(t *testing.T) {
+	ipfsHash := "1220" + "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	code := "6080604052600080fd00fe"
+	tests := []struct {
+		name    string
+		trailer string
+		want    *Metadata
+	}{
+		{
+			name: "solc ipfs and version",
+			// {"ipfs": h'1220...', "solc": h'00081c'}
+			trailer: "a2" + "6469706673" + "5822" + ipfsHash + "64736f6c63" + "4300081c" + "0033",
+			want: &Metadata{
+				Compiler:   "solc",
+				Version:    "0.8.28",
+				SourceHash: "ipfs://QmNLfbof5rLekrACjeuLk9JmGZD2HDBHCU4z16iYKmx5SE",
+				Size:       53,
+			},
+		},
+		{
+			name: "solc before 0.5.9 records only the swarm hash",
+			// {"bzzr0": h'aabb'}
+			trailer: "a1" + "65627a7a7230" + "42aabb" + "000a",
+			want:    &Metadata{Compiler: "solc", SourceHash: "bzzr0://aabb", Size: 12},
+		},
+		{
+			name: "vyper 0.3.7 excludes the suffix from the length",
+			// {"vyper": [0, 3, 7]}
+			trailer: "a1" + "657679706572" + "83000307" + "000b",
+			want:    &Metadata{Compiler: "vyper", Version: "0.3.7", Size: 13},
+		},
+		{
+			name: "vyper 0.4 list counts the suffix in the length",
+			// [291, [], 0, {"vyper": [0, 4, 0]}]
+			trailer: "84" + "190123" + "80" + "00" + "a1" + "657679706572" + "83000400" + "0013",
+			want:    &Metadata{Compiler: "vyper", Version: "0.4.0", Size: 19},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			full := mustHex(t, code+tt.trailer)
+			rest, md := Split(full)
+			if md == nil {
+				t.Fatal("no trailer found")
+			}
+			if *md != *tt.want {
+				t.Errorf("metadata = %+v, want %+v", *md, *tt.want)
+			}
+			if !bytes.Equal(rest, mustHex(t, code)) {
+				t.Errorf("code = %x, want %s", rest, code)
+			}
+		})
+	}
+}
+
+func TestSplitWithoutTrailer(t *testing.T) {
+	for _, s := range []string{"", "00", "6001600055", "600160005500ff", "6001a1000004"} {
+		code := mustHex(t, s)
+		rest, md := Split(code)
+		if md != nil || !bytes.Equal(rest, code) {
+			t.Errorf("Split(%s) = %x, %+v; want the code unchanged", s, rest, md)
+		}
+	}
+}
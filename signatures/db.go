@@ -0,0 +1,169 @@
+// Package signatures maps function selectors and event topics back to the
+// text signatures they were hashed from.
+package signatures
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+//go:embed bundled.json
+var bundled []byte
+
+// DB holds every known text signature for a selector or topic. A key maps
+// to several signatures when they collide.
+type DB struct {
+	Functions map[string][]string `json:"functions"`
+	Events    map[string][]string `json:"events"`
+}
+
+func New() *DB {
+	return &DB{
+		Functions: map[string][]string{},
+		Events:    map[string][]string{},
+	}
+}
+
+// Bundled returns the database shipped with gaslens, covering common token,
+// access control, proxy and DEX interfaces.
+func Bundled() *DB {
+	db := New()
+	if err := json.Unmarshal(bundled, db); err != nil {
+		panic("signatures: corrupt bundled database: " + err.Error())
+	}
+	return db
+}
+
+// DefaultPath is the local database that imports are written to and that
+// is loaded on top of the bundled one.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "signatures.json"
+	}
+	return filepath.Join(home, ".gaslens", "signatures.json")
+}
+
+// Load reads a database file. A missing file yields an empty database.
+func Load(path string) (*DB, error) {
+	db := New()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, err
+	}
+	// Normalise keys written by hand or by other tools.
+	functions, events := db.Functions, db.Events
+	db.Functions, db.Events = map[string][]string{}, map[string][]string{}
+	for key, sigs := range functions {
+		for _, sig := range sigs {
+			add(db.Functions, key, sig)
+		}
+	}
+	for key, sigs := range events {
+		for _, sig := range sigs {
+			add(db.Events, key, sig)
+		}
+	}
+	return db, nil
+}
+
+// Save writes the database to path, creating its directory if needed.
+func (db *DB) Save(path string) error {
+	for _, sigs := range db.Functions {
+		sort.Strings(sigs)
+	}
+	for _, sigs := range db.Events {
+		sort.Strings(sigs)
+	}
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Merge adds every signature in other to db.
+func (db *DB) Merge(other *DB) {
+	for key, sigs := range other.Functions {
+		for _, sig := range sigs {
+			add(db.Functions, key, sig)
+		}
+	}
+	for key, sigs := range other.Events {
+		for _, sig := range sigs {
+			add(db.Events, key, sig)
+		}
+	}
+}
+
+// AddFunction adds a function signature such as "withdraw(uint256)".
+func (db *DB) AddFunction(sig string) {
+	add(db.Functions, Selector(sig), sig)
+}
+
+// AddEvent adds an event signature such as "Transfer(address,address,uint256)".
+func (db *DB) AddEvent(sig string) {
+	add(db.Events, Topic(sig), sig)
+}
+
+// AddABI adds the signature of every function and event in a.
+func (db *DB) AddABI(a abi.ABI) {
+	for _, m := range a.Methods {
+		db.AddFunction(m.Sig)
+	}
+	for _, e := range a.Events {
+		db.AddEvent(e.Sig)
+	}
+}
+
+// Function returns the signatures whose selector is selector.
+func (db *DB) Function(selector string) []string {
+	return db.Functions[strings.ToLower(selector)]
+}
+
+// Event returns the signatures whose topic is topic.
+func (db *DB) Event(topic string) []string {
+	return db.Events[strings.ToLower(topic)]
+}
+
+// Selector returns the 4-byte selector of a function signature.
+func Selector(sig string) string {
+	return hexutil.Encode(crypto.Keccak256([]byte(sig))[:4])
+}
+
+// Topic returns the topic of an event signature.
+func Topic(sig string) string {
+	return hexutil.Encode(crypto.Keccak256([]byte(sig)))
+}
+
+func add(m map[string][]string, key, sig string) {
+	key = strings.ToLower(key)
+	if !strings.HasPrefix(key, "0x") {
+		key = "0x" + key
+	}
+	for _, s := range m[key] {
+		if s == sig {
+			return
+		}
+	}
+	m[key] = append(m[key], sig)
+}
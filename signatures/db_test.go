@@ -0,0 +1,96 @@
+package signatures
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHashes(t *testing.T) {
+	tests := []struct {
+		sig  string
+		hash func(string) string
+		want string
+	}{
+		{"transfer(address,uint256)", Selector, "0xa9059cbb"},
+		{"balanceOf(address)", Selector, "0x70a08231"},
+		{"Transfer(address,address,uint256)", Topic, "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"},
+	}
+	for _, tt := range tests {
+		if got := tt.hash(tt.sig); got != tt.want {
+			t.Errorf("hash of %s = %s, want %s", tt.sig, got, tt.want)
+		}
+	}
+}
+
+func TestBundled(t *testing.T) {
+	db := Bundled()
+	if got := db.Function("0xA9059CBB"); !slices.Contains(got, "transfer(address,uint256)") {
+		t.Errorf("Function(0xa9059cbb) = %v, want transfer(address,uint256)", got)
+	}
+	if got := db.Event("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"); !slices.Contains(got, "Transfer(address,address,uint256)") {
+		t.Errorf("Event(Transfer) = %v, want Transfer(address,address,uint256)", got)
+	}
+}
+
+func TestMergeKeepsCollisionsOnce(t *testing.T) {
+	db := New()
+	db.AddFunction("transfer(address,uint256)")
+	other := New()
+	other.AddFunction("transfer(address,uint256)")
+	other.AddFunction("many_msg_babbage(bytes1)") // collides with transfer
+	db.Merge(other)
+	want := []string{"transfer(address,uint256)", "many_msg_babbage(bytes1)"}
+	if got := db.Function("0xa9059cbb"); !slices.Equal(got, want) {
+		t.Errorf("Function(0xa9059cbb) = %v, want %v", got, want)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "signatures.json")
+	db := New()
+	db.AddFunction("withdraw(uint256)")
+	db.AddEvent("Deposit(address,uint256)")
+	if err := db.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Function(Selector("withdraw(uint256)")); !slices.Equal(got, []string{"withdraw(uint256)"}) {
+		t.Errorf("loaded function = %v, want withdraw(uint256)", got)
+	}
+	if got := loaded.Event(Topic("Deposit(address,uint256)")); !slices.Equal(got, []string{"Deposit(address,uint256)"}) {
+		t.Errorf("loaded event = %v, want Deposit(address,uint256)", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil || len(db.Functions) != 0 || len(db.Events) != 0 {
+		t.Errorf("Load of a missing file = %+v, %v; want an empty database", db, err)
+	}
+
+	// Keys written by hand are normalised.
+	path := filepath.Join(dir, "hand.json")
+	if err := os.WriteFile(path, []byte(`{"functions":{"A9059CBB":["transfer(address,uint256)"]}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Function("0xa9059cbb"); len(got) != 1 {
+		t.Errorf("Function(0xa9059cbb) = %v, want the hand-written entry", got)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load of a corrupt file succeeded, want an error")
+	}
+}
@@ -0,0 +1,390 @@
+package srcmap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gaslens/metadata"
+)
+
+// maxParentDirs bounds how far above a file Load looks for sources and
+// build-info directories.
+const maxParentDirs = 4
+
+// Bytecode is compiled code with its source map, as solc's standard JSON
+// output and Foundry artifacts give it.
+type Bytecode struct {
+	Object    string `json:"object"`
+	SourceMap string `json:"sourceMap"`
+}
+
+// buildInfo is solc's standard JSON output, optionally with the input that
+// produced it, as Hardhat and Foundry save it in build-info files.
+type buildInfo struct {
+	Input *struct {
+		Sources map[string]struct {
+			Content *string `json:"content"`
+		} `json:"sources"`
+	} `json:"input"`
+	Output *Output `json:"output"`
+}
+
+// Output is the part of solc's standard JSON output a source map needs.
+type Output struct {
+	Contracts map[string]map[string]struct {
+		EVM struct {
+			DeployedBytecode Bytecode `json:"deployedBytecode"`
+		} `json:"evm"`
+	} `json:"contracts"`
+	Sources map[string]struct {
+		ID int `json:"id"`
+	} `json:"sources"`
+}
+
+// combinedJSON is the output of solc --combined-json with srcmap-runtime,
+// whose sourceList names the sources in index order.
+type combinedJSON struct {
+	Contracts map[string]struct {
+		BinRuntime    string `json:"bin-runtime"`
+		SrcmapRuntime string `json:"srcmap-runtime"`
+	} `json:"contracts"`
+	SourceList []string `json:"sourceList"`
+}
+
+// artifact is a Foundry or Hardhat artifact. Foundry's deployedBytecode is
+// a Bytecode and its id the source index of the contract's file; Hardhat's
+// is the hex string alone.
+type artifact struct {
+	DeployedBytecode json.RawMessage `json:"deployedBytecode"`
+	ID               *int            `json:"id"`
+	Metadata         json.RawMessage `json:"metadata"`
+}
+
+// File is a parsed file source maps are read from, which may hold
+//   - a bare compressed source map, whose sources names lists in index order;
+//   - solc's standard JSON output, a build-info file, or the output of
+//     solc --combined-json, from which the contract whose deployed bytecode
+//     is the code asked for is taken;
+//   - a Foundry or Hardhat artifact, looked up in a build-info directory
+//     above it when there is one.
+//
+// A file holding many contracts is parsed once, and each source file read
+// once, however many of their source maps are taken from it.
+type File struct {
+	dir     string
+	bare    string
+	cj      *combinedJSON
+	bi      *buildInfo
+	art     *artifact
+	sources map[string][]byte
+}
+
+// Load reads the source map of runtime from path; see File.
+//
+// names, when given, overrides the source names found in the file. Source
+// contents come from a build-info input, or are read from disk relative to
+// the working directory or a directory above path.
+func Load(path string, runtime []byte, names []string) (*Map, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Decode(data, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	return f.Map(runtime, names)
+}
+
+// Decode parses the contents of a file in dir, where the sources it names
+// are looked for.
+func Decode(data []byte, dir string) (*File, error) {
+	f := &File{dir: dir, sources: map[string][]byte{}}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		f.bare = string(trimmed)
+		return f, nil
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("not a source map or artifact: %w", err)
+	}
+	switch {
+	case keys["sourceList"] != nil:
+		f.cj = &combinedJSON{}
+		if err := json.Unmarshal(data, f.cj); err != nil {
+			return nil, err
+		}
+	case keys["output"] != nil:
+		f.bi = &buildInfo{}
+		if err := json.Unmarshal(data, f.bi); err != nil {
+			return nil, err
+		}
+	case keys["contracts"] != nil:
+		f.bi = &buildInfo{Output: &Output{}}
+		if err := json.Unmarshal(data, f.bi.Output); err != nil {
+			return nil, err
+		}
+	case keys["deployedBytecode"] != nil:
+		f.art = &artifact{}
+		if err := json.Unmarshal(data, f.art); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("no source map found")
+	}
+	return f, nil
+}
+
+// Map returns the source map of runtime. names, when given, overrides the
+// source names found in the file.
+func (f *File) Map(runtime []byte, names []string) (*Map, error) {
+	switch {
+	case f.cj != nil:
+		return f.cj.sourceMap(f, runtime, names)
+	case f.bi != nil:
+		if f.bi.Output == nil {
+			return nil, errors.New("no source map found")
+		}
+		return f.bi.sourceMap(f, runtime, names)
+	case f.art != nil:
+		return f.art.sourceMap(f, names)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("a bare source map needs the list of source files")
+	}
+	return f.newMap(f.bare, nil, names, nil)
+}
+
+// sourceMap picks the contract whose deployed bytecode is runtime, or the
+// only contract that has a source map.
+func (bi *buildInfo) sourceMap(f *File, runtime []byte, names []string) (*Map, error) {
+	var mapped []string
+	var found, last *Bytecode
+	for file, contracts := range bi.Output.Contracts {
+		for name, c := range contracts {
+			bc := c.EVM.DeployedBytecode
+			if bc.SourceMap == "" {
+				continue
+			}
+			mapped = append(mapped, file+":"+name)
+			last = &bc
+			if sameCode(bc.Object, runtime) {
+				found = &bc
+			}
+		}
+	}
+	if found == nil && len(mapped) == 1 {
+		found = last
+	}
+	if found == nil {
+		sort.Strings(mapped)
+		return nil, fmt.Errorf("no contract's deployed bytecode matches the code (contracts with source maps: %s)", strings.Join(mapped, ", "))
+	}
+	return f.newMap(found.SourceMap, bi, names, nil)
+}
+
+// sourceMap picks the contract whose runtime bytecode is runtime, or the
+// only contract that has a source map.
+func (cj *combinedJSON) sourceMap(f *File, runtime []byte, names []string) (*Map, error) {
+	var mapped []string
+	var found, last string
+	for name, c := range cj.Contracts {
+		if c.SrcmapRuntime == "" {
+			continue
+		}
+		mapped = append(mapped, name)
+		last = c.SrcmapRuntime
+		if sameCode(c.BinRuntime, runtime) {
+			found = c.SrcmapRuntime
+		}
+	}
+	if found == "" && len(mapped) == 1 {
+		found = last
+	}
+	if found == "" {
+		sort.Strings(mapped)
+		return nil, fmt.Errorf("no contract's runtime bytecode matches the code (contracts with source maps: %s)", strings.Join(mapped, ", "))
+	}
+	if len(names) == 0 {
+		names = cj.SourceList
+	}
+	return f.newMap(found, nil, names, nil)
+}
+
+// sourceMap returns an artifact's source map. A build-info file that
+// compiled the same bytecode gives the sources of every index; without
+// one, only the contract's own file is known.
+func (a *artifact) sourceMap(f *File, names []string) (*Map, error) {
+	var bc Bytecode
+	if err := json.Unmarshal(a.DeployedBytecode, &bc); err != nil {
+		if err := json.Unmarshal(a.DeployedBytecode, &bc.Object); err != nil {
+			return nil, fmt.Errorf("invalid deployedBytecode: %w", err)
+		}
+	}
+	if bi, found := findBuildInfo(f.dir, bc.Object); found != nil {
+		return f.newMap(found.SourceMap, bi, names, nil)
+	}
+	if bc.SourceMap == "" {
+		return nil, errors.New("the artifact has no source map, and no build-info file compiled it")
+	}
+	known := map[int]string{}
+	if target := a.compilationTarget(); target != "" && a.ID != nil {
+		known[*a.ID] = target
+	}
+	return f.newMap(bc.SourceMap, nil, names, known)
+}
+
+// compilationTarget returns the file the artifact's contract is declared
+// in, from its metadata.
+func (a *artifact) compilationTarget() string {
+	raw := a.Metadata
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		raw = json.RawMessage(text)
+	}
+	var md struct {
+		Settings struct {
+			CompilationTarget map[string]string `json:"compilationTarget"`
+		} `json:"settings"`
+	}
+	if json.Unmarshal(raw, &md) != nil {
+		return ""
+	}
+	for file := range md.Settings.CompilationTarget {
+		return file
+	}
+	return ""
+}
+
+// findBuildInfo looks in the build-info directories above dir for the
+// compilation that produced object, and returns it with the contract's
+// deployed bytecode.
+func findBuildInfo(dir, object string) (*buildInfo, *Bytecode) {
+	object = normalizeHex(object)
+	if object == "" {
+		return nil, nil
+	}
+	for _, d := range parents(dir) {
+		files, _ := filepath.Glob(filepath.Join(d, "build-info", "*.json"))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil || !bytes.Contains(data, []byte(object)) {
+				continue
+			}
+			var bi buildInfo
+			if json.Unmarshal(data, &bi) != nil || bi.Output == nil {
+				continue
+			}
+			for _, contracts := range bi.Output.Contracts {
+				for _, c := range contracts {
+					if bc := c.EVM.DeployedBytecode; normalizeHex(bc.Object) == object {
+						return &bi, &bc
+					}
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// newMap builds a Map from a compressed source map. Source names come
+// from names when given, then from the build-info, then from known.
+func (f *File) newMap(compressed string, bi *buildInfo, names []string, known map[int]string) (*Map, error) {
+	entries, err := Parse(compressed)
+	if err != nil {
+		return nil, err
+	}
+	m := &Map{Entries: entries, Sources: map[int]*Source{}}
+	byIndex := map[int]string{}
+	for i, name := range known {
+		byIndex[i] = name
+	}
+	if bi != nil {
+		for name, s := range bi.Output.Sources {
+			byIndex[s.ID] = name
+		}
+	}
+	if len(names) > 0 {
+		byIndex = map[int]string{}
+		for i, name := range names {
+			byIndex[i] = name
+		}
+	}
+	for i, name := range byIndex {
+		var content []byte
+		if bi != nil && bi.Input != nil {
+			if s, ok := bi.Input.Sources[name]; ok && s.Content != nil {
+				content = []byte(*s.Content)
+			}
+		}
+		if content == nil {
+			content = f.readSource(name)
+		}
+		m.Sources[i] = NewSource(name, content)
+	}
+	return m, nil
+}
+
+// readSource reads a source file relative to the working directory or a
+// directory above the file's, and returns nil when it is not found.
+func (f *File) readSource(name string) []byte {
+	data, ok := f.sources[name]
+	if !ok {
+		data = readSource(name, f.dir)
+		f.sources[name] = data
+	}
+	return data
+}
+
+func readSource(name, dir string) []byte {
+	if data, err := os.ReadFile(name); err == nil {
+		return data
+	}
+	if filepath.IsAbs(name) {
+		return nil
+	}
+	for _, d := range parents(dir) {
+		if data, err := os.ReadFile(filepath.Join(d, name)); err == nil {
+			return data
+		}
+	}
+	return nil
+}
+
+// parents returns dir and up to maxParentDirs directories above it.
+func parents(dir string) []string {
+	out := []string{dir}
+	for i := 0; i < maxParentDirs; i++ {
+		up := filepath.Dir(dir)
+		if up == dir {
+			break
+		}
+		dir = up
+		out = append(out, dir)
+	}
+	return out
+}
+
+// sameCode reports whether object, a hex string, is runtime, ignoring the
+// metadata trailers.
+func sameCode(object string, runtime []byte) bool {
+	code, err := hex.DecodeString(normalizeHex(object))
+	if err != nil || len(code) == 0 {
+		return false
+	}
+	a, _ := metadata.Split(code)
+	b, _ := metadata.Split(runtime)
+	return bytes.Equal(a, b)
+}
+
+func normalizeHex(s string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+}
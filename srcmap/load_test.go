@@ -0,0 +1,57 @@
+package srcmap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeCombinedJSON(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "A.sol"), []byte("contract A {}\ncontract B {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"sourceList":["A.sol"],"contracts":{
+		"A.sol:A":{"bin-runtime":"6001600055","srcmap-runtime":"0:13:0;;"},
+		"A.sol:B":{"bin-runtime":"6002600055","srcmap-runtime":"14:13:0;;"}}}`)
+	f, err := Decode(data, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		runtime []byte
+		want    string
+	}{
+		{[]byte{0x60, 0x01, 0x60, 0x00, 0x55}, "A.sol:1:1"},
+		{[]byte{0x60, 0x02, 0x60, 0x00, 0x55}, "A.sol:2:1"},
+	}
+	for _, tt := range tests {
+		m, err := f.Map(tt.runtime, nil)
+		if err != nil {
+			t.Fatalf("Map(%x): %v", tt.runtime, err)
+		}
+		if pos, ok := m.Position(0); !ok || pos.String() != tt.want {
+			t.Errorf("Map(%x).Position(0) = %s, %v; want %s", tt.runtime, pos, ok, tt.want)
+		}
+	}
+	if _, err := f.Map([]byte{0x00}, nil); err == nil {
+		t.Error("Map of code no contract has succeeded, want an error")
+	}
+}
+
+func TestDecodeBareSourceMap(t *testing.T) {
+	f, err := Decode([]byte("1:2:0;;\n"), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Map(nil, nil); err == nil {
+		t.Error("Map of a bare source map without source names succeeded, want an error")
+	}
+	m, err := f.Map(nil, []string{"Missing.sol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos, ok := m.Position(1); !ok || pos.String() != "Missing.sol" {
+		t.Errorf("Position(1) = %s, %v; want Missing.sol without a line", pos, ok)
+	}
+}
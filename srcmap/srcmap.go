@@ -0,0 +1,154 @@
+// Package srcmap reads the source maps solc emits next to bytecode, which
+// tie every instruction to a range of a source file, and turns them into
+// file, line and column positions.
+package srcmap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Entry is the source range of one instruction: Length bytes at Offset in
+// the source with index File. File is -1 for code the compiler generated.
+type Entry struct {
+	Offset        int
+	Length        int
+	File          int
+	Jump          string // "i" into a function, "o" out of one, "-" otherwise
+	ModifierDepth int
+}
+
+// Parse decodes a compressed source map, "s:l:f:j:m;s:l:f:j:m;...", in
+// which a missing field repeats the value of the entry before it.
+func Parse(s string) ([]Entry, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var out []Entry
+	prev := Entry{File: -1, Jump: "-"}
+	for i, item := range strings.Split(s, ";") {
+		e := prev
+		for j, field := range strings.Split(item, ":") {
+			if field == "" {
+				continue
+			}
+			if j == 3 {
+				e.Jump = field
+				continue
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil || j > 4 {
+				return nil, fmt.Errorf("source map entry %d: invalid field %q", i, field)
+			}
+			switch j {
+			case 0:
+				e.Offset = n
+			case 1:
+				e.Length = n
+			case 2:
+				e.File = n
+			case 4:
+				e.ModifierDepth = n
+			}
+		}
+		out = append(out, e)
+		prev = e
+	}
+	return out, nil
+}
+
+// Position is a place in a source file. Line and Column count from 1, and
+// are 0 when the file's contents are not available.
+type Position struct {
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// String formats the position as "file:line:column".
+func (p Position) String() string {
+	if p.Line == 0 {
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Source is a source file and the offsets its lines start at.
+type Source struct {
+	Name    string
+	content []byte
+	lines   []int
+}
+
+// NewSource indexes the lines of content. A nil content leaves positions
+// in the file without line numbers.
+func NewSource(name string, content []byte) *Source {
+	s := &Source{Name: name, content: content}
+	if content == nil {
+		return s
+	}
+	s.lines = []int{0}
+	for i, c := range content {
+		if c == '\n' {
+			s.lines = append(s.lines, i+1)
+		}
+	}
+	return s
+}
+
+// Position returns the line and column of a byte offset into the source.
+func (s *Source) Position(offset int) Position {
+	if s.lines == nil {
+		return Position{File: s.Name}
+	}
+	line := sort.Search(len(s.lines), func(i int) bool { return s.lines[i] > offset })
+	return Position{File: s.Name, Line: line, Column: offset - s.lines[line-1] + 1}
+}
+
+// Line returns the text of a line, counted from 1, without its line
+// break, or "" when it is not known.
+func (s *Source) Line(n int) string {
+	if n < 1 || n > len(s.lines) {
+		return ""
+	}
+	end := len(s.content)
+	if n < len(s.lines) {
+		end = s.lines[n] - 1
+	}
+	return strings.TrimRight(string(s.content[s.lines[n-1]:end]), "\r")
+}
+
+// Map ties the instructions of some bytecode, counted in order, to their
+// positions in the sources, which are keyed by solc's source index.
+type Map struct {
+	Entries []Entry
+	Sources map[int]*Source
+}
+
+// Position returns where the instruction with the given index comes from.
+// It reports false for code the compiler generated and for sources that
+// are not known.
+func (m *Map) Position(index int) (Position, bool) {
+	if m == nil || index < 0 || index >= len(m.Entries) {
+		return Position{}, false
+	}
+	e := m.Entries[index]
+	src, ok := m.Sources[e.File]
+	if !ok {
+		return Position{}, false
+	}
+	return src.Position(e.Offset), true
+}
+
+// Line returns the text of a line of the named source, or "".
+func (m *Map) Line(file string, n int) string {
+	for _, src := range m.Sources {
+		if src.Name == file {
+			return src.Line(n)
+		}
+	}
+	return ""
+}
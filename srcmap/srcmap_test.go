@@ -0,0 +1,100 @@
+package srcmap
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Entry
+	}{
+		{
+			name: "empty",
+			in:   " ",
+		},
+		{
+			name: "missing fields repeat the entry before",
+			in:   "1:2:0:-:0;;3;:4:1:i;::-1:o:2",
+			want: []Entry{
+				{Offset: 1, Length: 2, File: 0, Jump: "-"},
+				{Offset: 1, Length: 2, File: 0, Jump: "-"},
+				{Offset: 3, Length: 2, File: 0, Jump: "-"},
+				{Offset: 3, Length: 4, File: 1, Jump: "i"},
+				{Offset: 3, Length: 4, File: -1, Jump: "o", ModifierDepth: 2},
+			},
+		},
+		{
+			name: "first entry defaults to generated code",
+			in:   "5:6",
+			want: []Entry{{Offset: 5, Length: 6, File: -1, Jump: "-"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseRejectsBadFields(t *testing.T) {
+	for _, in := range []string{"1:x", "1:2:3:-:4:5"} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestSourcePosition(t *testing.T) {
+	src := NewSource("A.sol", []byte("contract A {\r\n  uint x;\n}"))
+	tests := []struct {
+		offset int
+		want   string
+	}{
+		{0, "A.sol:1:1"},
+		{9, "A.sol:1:10"},
+		{16, "A.sol:2:3"},
+		{24, "A.sol:3:1"},
+	}
+	for _, tt := range tests {
+		if got := src.Position(tt.offset).String(); got != tt.want {
+			t.Errorf("Position(%d) = %s, want %s", tt.offset, got, tt.want)
+		}
+	}
+	for n, want := range map[int]string{0: "", 1: "contract A {", 2: "  uint x;", 3: "}", 4: ""} {
+		if got := src.Line(n); got != want {
+			t.Errorf("Line(%d) = %q, want %q", n, got, want)
+		}
+	}
+	if got := NewSource("B.sol", nil).Position(7).String(); got != "B.sol" {
+		t.Errorf("Position without contents = %s, want B.sol", got)
+	}
+}
+
+func TestMapPosition(t *testing.T) {
+	m := &Map{
+		Entries: []Entry{{Offset: 2, File: 0}, {Offset: 0, File: -1}, {Offset: 0, File: 3}},
+		Sources: map[int]*Source{0: NewSource("A.sol", []byte("a\nb\n"))},
+	}
+	if pos, ok := m.Position(0); !ok || pos.String() != "A.sol:2:1" {
+		t.Errorf("Position(0) = %s, %v; want A.sol:2:1", pos, ok)
+	}
+	for _, i := range []int{-1, 1, 2, 3} {
+		if pos, ok := m.Position(i); ok {
+			t.Errorf("Position(%d) = %s, want none", i, pos)
+		}
+	}
+	if got := m.Line("A.sol", 2); got != "b" {
+		t.Errorf("Line = %q, want b", got)
+	}
+}
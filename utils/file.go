@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"io/ioutil"
 	"log"
 	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
 )
 
 // ReadHexFile reads a file and decodes hex, removing 0x prefix if present.
@@ -32,3 +36,37 @@ func ReadHexFile(path string) []byte {
 
 	return code
 }
+
+// ParseHex decodes a hex string such as calldata given on the command line,
+// with or without a 0x prefix.
+func ParseHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	return hex.DecodeString(s)
+}
+
+// ReadABI reads a contract ABI from a JSON file.
+func ReadABI(path string) abi.ABI {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read ABI: %v", err)
+	}
+
+	parsed, err := abi.JSON(bytes.NewReader(data))
+	if err != nil {
+		log.Fatalf("Failed to parse ABI: %v", err)
+	}
+
+	return parsed
+}
+
+// ReadJSONFile decodes the JSON file at path into v.
+func ReadJSONFile(path string, v interface{}) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read file: %v", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Fatalf("Failed to parse %s: %v", path, err)
+	}
+}